@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"gocrud/db"
+	"gocrud/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	energyRegisterMeasurand = "Energy.Active.Import.Register"
+)
+
+// GetTransactions liste les sessions de charge avec filtres et pagination.
+// Filtres: charger_id, user_id, id_tag, status, from, to (RFC3339 ou YYYY-MM-DD).
+func GetTransactions(c *gin.Context) {
+	page, pageSize, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transactions := []models.Transaction{}
+	query := db.DB.NewSelect().Model(&transactions)
+
+	if chargerID := c.Query("charger_id"); chargerID != "" {
+		query = query.Where("charger_id = ?", chargerID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
+			return
+		}
+		query = query.Where("user_id = ?", id)
+	}
+	if idTag := c.Query("id_tag"); idTag != "" {
+		query = query.Where("id_tag = ?", idTag)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseDateParam(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		query = query.Where("started_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseDateParam(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+		// Une date seule inclut toute la journée
+		if len(to) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+		}
+		query = query.Where("started_at < ?", t)
+	}
+
+	total, err := query.
+		Order("started_at DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		ScanAndCount(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats := make([]*models.Transaction, len(transactions))
+	for i := range transactions {
+		stats[i] = &transactions[i]
+	}
+	if err := fillTransactionStats(c, stats...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"total":        total,
+		"page":         page,
+		"page_size":    pageSize,
+	})
+}
+
+// GetTransaction récupère une session avec sa série de mesures
+func GetTransaction(c *gin.Context) {
+	// Convertir l'ID en entier
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	detail := new(models.TransactionDetail)
+	err = db.DB.NewSelect().Model(&detail.Transaction).Where("id = ?", id).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	err = db.DB.NewSelect().
+		Model(&detail.MeterValues).
+		Where("transaction_id = ?", id).
+		Order("timestamp ASC", "id ASC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if detail.MeterValues == nil {
+		detail.MeterValues = []models.MeterValue{}
+	}
+
+	if err := fillTransactionStats(c, &detail.Transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// fillTransactionStats calcule l'énergie (kWh) et la durée des sessions.
+// Pour une session en cours, l'énergie vient du dernier relevé du compteur,
+// total toutes phases et déjà converti en Wh (si_value) par le serveur OCPP ;
+// une seule requête sert toute la page.
+func fillTransactionStats(c *gin.Context, transactions ...*models.Transaction) error {
+	now := time.Now()
+	running := make(map[int64]*models.Transaction)
+	for _, tx := range transactions {
+		end := now
+		if tx.StoppedAt != nil {
+			end = *tx.StoppedAt
+		}
+		tx.DurationSeconds = int64(end.Sub(tx.StartedAt).Seconds())
+
+		if tx.MeterStop != nil {
+			tx.EnergyKWh = float64(*tx.MeterStop-tx.MeterStart) / 1000
+		} else {
+			running[tx.ID] = tx
+		}
+	}
+	if len(running) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(running))
+	for id := range running {
+		ids = append(ids, id)
+	}
+	var last []models.MeterValue
+	err := db.DB.NewSelect().
+		Model(&last).
+		DistinctOn("transaction_id").
+		Where("transaction_id IN (?)", bun.In(ids)).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("measurand = ?", energyRegisterMeasurand).WhereOr("measurand = ''")
+		}).
+		Where("phase = ''").
+		Where("si_value IS NOT NULL").
+		Order("transaction_id", "timestamp DESC").
+		Scan(c)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	for _, value := range last {
+		if tx := running[*value.TransactionID]; tx != nil {
+			tx.EnergyKWh = (*value.SIValue - float64(tx.MeterStart)) / 1000
+		}
+	}
+	return nil
+}
+
+// parsePagination lit page et page_size depuis la requête
+func parsePagination(c *gin.Context) (int, int, error) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("Invalid page")
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 {
+		return 0, 0, errors.New("Invalid page_size")
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize, nil
+}
+
+// parseDateParam accepte une date RFC3339 ou YYYY-MM-DD
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,67 @@
+// models/transaction.go
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Transaction est une session de charge enregistrée par le serveur OCPP.
+// OCPPTransactionID est l'identifiant choisi par une borne OCPP 2.0.1 ;
+// Reconciliation décrit comment le serveur a rapproché un StopTransaction
+// incohérent.
+type Transaction struct {
+	bun.BaseModel `bun:"table:transaction" json:"-"`
+
+	ID                int64      `bun:",pk,autoincrement" json:"id"`
+	OCPPTransactionID *string    `bun:"ocpp_transaction_id" json:"ocpp_transaction_id,omitempty"`
+	ChargerID         string     `json:"charger_id"`
+	ConnectorID       int        `json:"connector_id"`
+	IdTag             string     `json:"id_tag"`
+	UserID            *int64     `json:"user_id,omitempty"`
+	ReservationID     *int       `json:"reservation_id,omitempty"`
+	MeterStart        int        `json:"meter_start"`
+	MeterStop         *int       `json:"meter_stop"`
+	StartedAt         time.Time  `json:"started_at"`
+	StoppedAt         *time.Time `json:"stopped_at"`
+	StopIdTag         string     `json:"stop_id_tag,omitempty"`
+	StopReason        string     `json:"stop_reason,omitempty"`
+	Status            string     `json:"status"`
+	Reconciliation    string     `json:"reconciliation,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Calculés pour la réponse API, non stockés
+	EnergyKWh       float64 `bun:"-" json:"energy_kwh"`
+	DurationSeconds int64   `bun:"-" json:"duration_seconds"`
+}
+
+// MeterValue est une valeur mesurée pendant une session de charge. Value et Unit
+// sont tels que reçus ; une valeur numérique est aussi convertie dans SIValue,
+// en SIUnit (Wh, W, A...).
+type MeterValue struct {
+	bun.BaseModel `bun:"table:meter_value" json:"-"`
+
+	ID            int64     `bun:",pk,autoincrement" json:"id"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	ChargerID     string    `json:"charger_id"`
+	ConnectorID   int       `json:"connector_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Value         string    `json:"value"`
+	Context       string    `json:"context,omitempty"`
+	Format        string    `json:"format,omitempty"`
+	Measurand     string    `json:"measurand,omitempty"`
+	Phase         string    `json:"phase,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	Unit          string    `json:"unit,omitempty"`
+	SIValue       *float64  `bun:"si_value" json:"si_value,omitempty"`
+	SIUnit        string    `bun:"si_unit" json:"si_unit,omitempty"`
+}
+
+// TransactionDetail est la réponse détaillée d'une session avec sa série de mesures
+type TransactionDetail struct {
+	Transaction
+	MeterValues []MeterValue `json:"meter_values"`
+}
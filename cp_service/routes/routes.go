@@ -37,5 +37,13 @@ func SetupRoutes(r *gin.Engine) {
 			cps.PUT("/:id", controller.UpdateCP)
 			cps.DELETE("/:id", controller.DeleteCP)
 		}
+
+		// Routes des sessions de charge (protégées)
+		transactions := api.Group("/transactions")
+		transactions.Use(middleware.AuthMiddleware())
+		{
+			transactions.GET("", controller.GetTransactions)
+			transactions.GET("/:id", controller.GetTransaction)
+		}
 	}
 }
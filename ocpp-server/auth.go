@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+
+	db "ocpp-server/db"
+)
+
+// errUnauthenticated is returned when a request carries no valid user_service access token
+var errUnauthenticated = errors.New("unauthenticated")
+
+// errForbidden is returned when the authenticated user may not operate the charger network
+var errForbidden = errors.New("forbidden")
+
+// operatorRoles are the user_service roles allowed to operate the charger network
+var operatorRoles = map[string]bool{
+	"admin":    true,
+	"operator": true,
+}
+
+// accessSecret is the HS256 secret of the access tokens issued by user_service
+func accessSecret() []byte {
+	if secret := os.Getenv("ACCESS_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte("cpm")
+}
+
+// authenticatedUser returns the ID of the user_service user holding the bearer
+// token of r, validated the same way user_service and cp_service do
+func authenticatedUser(r *http.Request) (int64, error) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return 0, errUnauthenticated
+	}
+	return parseAccessToken(parts[1])
+}
+
+// parseAccessToken validates an access token and returns its user_id claim
+func parseAccessToken(tokenString string) (int64, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return accessSecret(), nil
+	})
+	if err != nil {
+		return 0, errUnauthenticated
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0, errUnauthenticated
+	}
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return 0, errUnauthenticated
+	}
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return 0, errUnauthenticated
+	}
+	return id, nil
+}
+
+// authenticatedOperator returns the ID of the user holding the bearer token of r,
+// provided their role allows operating the charger network
+func authenticatedOperator(r *http.Request) (int64, error) {
+	userID, err := authenticatedUser(r)
+	if err != nil {
+		return 0, err
+	}
+	role, err := db.GetUserRole(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errUnauthenticated
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !operatorRoles[role] {
+		return 0, errForbidden
+	}
+	return userID, nil
+}
+
+// requireOperator answers r with an error unless it comes from an operator and
+// reports whether the handler may go on
+func requireOperator(w http.ResponseWriter, r *http.Request) bool {
+	_, err := authenticatedOperator(r)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errUnauthenticated):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	case errors.Is(err, errForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// userStatusActive is the user_service status of users allowed to charge
+const userStatusActive = "active"
+
+// authorizeIdTag looks an idTag up in the id_tag table and builds the IdTagInfo to answer with,
+// as it stood at time at. It also returns the ID of the user owning the tag, or nil if the tag
+// is unknown.
+func authorizeIdTag(ctx context.Context, idTag string, at time.Time) (ocpp16.IdTagInfo, *int64, error) {
+	tag, err := db.GetIdTag(ctx, idTag)
+	if errors.Is(err, db.ErrIdTagNotFound) {
+		return ocpp16.IdTagInfo{Status: ocpp16.AuthorizationStatusInvalid}, nil, nil
+	}
+	if err != nil {
+		return ocpp16.IdTagInfo{}, nil, err
+	}
+
+	info := idTagInfoFor(tag, at)
+	return info, &tag.UserID, nil
+}
+
+// idTagInfoFor derives the OCPP authorization status of a registered idTag at time now
+func idTagInfoFor(tag *models.IdTag, now time.Time) ocpp16.IdTagInfo {
+	info := ocpp16.IdTagInfo{
+		Status:      ocpp16.AuthorizationStatus(tag.Status),
+		ParentIdTag: tag.ParentIdTag,
+	}
+	if tag.ExpiryDate != nil {
+		info.ExpiryDate = ocpp16.NewDateTime(*tag.ExpiryDate)
+	}
+
+	switch {
+	case info.Status == "":
+		info.Status = ocpp16.AuthorizationStatusInvalid
+	case info.Status != ocpp16.AuthorizationStatusAccepted:
+		// Blocked, Expired and Invalid are answered as stored
+	case tag.UserStatus != "" && tag.UserStatus != userStatusActive:
+		info.Status = ocpp16.AuthorizationStatusBlocked
+	case tag.ExpiryDate != nil && tag.ExpiryDate.Before(now):
+		info.Status = ocpp16.AuthorizationStatusExpired
+	}
+	return info
+}
+
+// checkConcurrentTx downgrades an accepted idTag to ConcurrentTx if it is already charging
+func checkConcurrentTx(ctx context.Context, idTag string, info *ocpp16.IdTagInfo) error {
+	if info.Status != ocpp16.AuthorizationStatusAccepted {
+		return nil
+	}
+	active, err := db.HasActiveTransaction(ctx, idTag)
+	if err != nil {
+		return err
+	}
+	if active {
+		log.Printf("idTag %s is already involved in an active transaction", idTag)
+		info.Status = ocpp16.AuthorizationStatusConcurrentTx
+	}
+	return nil
+}
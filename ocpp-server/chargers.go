@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp15"
+	"ocpp-server/ocpp16"
+)
+
+// chargerDetail is the body of GET /api/chargers/{id}
+type chargerDetail struct {
+	ID           string                    `json:"id"`
+	Connected    bool                      `json:"connected"`
+	Protocol     string                    `json:"protocol,omitempty"`
+	Registration ocpp16.RegistrationStatus `json:"registration,omitempty"`
+	LastSeen     *time.Time                `json:"last_seen,omitempty"`
+	Generation   uint64                    `json:"connection_generation"`
+	Info         *models.ChargerInfo       `json:"info"`
+	Connectors   []models.Connector        `json:"connectors"`
+}
+
+// handleChargerDetail serves the boot information and connector statuses of one charger
+func (s *OCPPServer) handleChargerDetail(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chargerID := r.PathValue("id")
+	detail := chargerDetail{ID: chargerID}
+
+	// ?refresh=true asks a connected charger for its current connector status first
+	if r.URL.Query().Get("refresh") == "true" && s.getCharger(chargerID) != nil {
+		s.refreshConnectors(r.Context(), chargerID)
+	}
+
+	if charger := s.getCharger(chargerID); charger != nil {
+		lastSeen := charger.LastSeen()
+		detail.Connected = true
+		detail.Protocol = charger.Protocol
+		detail.Registration = charger.RegistrationStatus()
+		detail.LastSeen = &lastSeen
+	} else if charger := s.getSOAPCharger(chargerID); charger != nil {
+		detail.Connected = true
+		detail.Protocol = ocpp15.Protocol
+		detail.LastSeen = &charger.LastSeen
+	}
+	detail.Generation = s.connectionGeneration(chargerID)
+
+	var err error
+	detail.Info, err = db.GetChargerInfo(r.Context(), chargerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	detail.Connectors, err = db.GetConnectors(r.Context(), chargerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !detail.Connected && detail.Info == nil && len(detail.Connectors) == 0 {
+		http.Error(w, "Unknown charger", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// connectionGeneration returns how many connections a charger opened since startup
+func (s *OCPPServer) connectionGeneration(chargerID string) uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.generations[chargerID]
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+)
+
+// chargerCommands maps the command endpoints under /api/chargers/{id}/ onto the
+// Central System → Charge Point request they send. The request body is decoded
+// straight into the OCPP request, so it uses the OCPP field names. OCPP 2.0.1
+// commands are refused for 1.6 chargers and the other way round.
+var chargerCommands = map[string]func() ocpp16.Request{
+	"reset":                  func() ocpp16.Request { return &ocpp16.ResetRequest{} },
+	"change-availability":    func() ocpp16.Request { return &ocpp16.ChangeAvailabilityRequest{} },
+	"change-configuration":   func() ocpp16.Request { return &ocpp16.ChangeConfigurationRequest{} },
+	"get-configuration":      func() ocpp16.Request { return &ocpp16.GetConfigurationRequest{} },
+	"clear-cache":            func() ocpp16.Request { return &ocpp16.ClearCacheRequest{} },
+	"unlock-connector":       func() ocpp16.Request { return &ocpp16.UnlockConnectorRequest{} },
+	"data-transfer":          func() ocpp16.Request { return &ocpp16.DataTransferRequest{} },
+	"remote-start":           func() ocpp16.Request { return &ocpp16.RemoteStartTransactionRequest{} },
+	"remote-stop":            func() ocpp16.Request { return &ocpp16.RemoteStopTransactionRequest{} },
+	"get-composite-schedule": func() ocpp16.Request { return &ocpp16.GetCompositeScheduleRequest{} },
+	"get-local-list-version": func() ocpp16.Request { return &ocpp16.GetLocalListVersionRequest{} },
+
+	"request-start-transaction": func() ocpp16.Request { return &ocpp201.RequestStartTransactionRequest{} },
+	"request-stop-transaction":  func() ocpp16.Request { return &ocpp201.RequestStopTransactionRequest{} },
+	"get-variables":             func() ocpp16.Request { return &ocpp201.GetVariablesRequest{} },
+	"set-variables":             func() ocpp16.Request { return &ocpp201.SetVariablesRequest{} },
+}
+
+// registerCommandRoutes exposes one POST endpoint per charger command
+func (s *OCPPServer) registerCommandRoutes(mux *http.ServeMux) {
+	for name, newRequest := range chargerCommands {
+		mux.HandleFunc("/api/chargers/{id}/"+name, s.commandHandler(newRequest))
+	}
+}
+
+// commandHandler decodes the body into a new OCPP request, sends it to the charger
+// named in the URL and replies with the charger's answer
+func (s *OCPPServer) commandHandler(newRequest func() ocpp16.Request) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enableCORS(w)
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireOperator(w, r) {
+			return
+		}
+
+		command := newRequest()
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(command); err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("%s decode error: %v", r.URL.Path, err)
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		chargerID := r.PathValue("id")
+		log.Printf("Received %s command for %s: %+v", command.Action(), chargerID, command)
+
+		response, err := s.SendRemoteCommand(r.Context(), chargerID, command)
+		if change, ok := command.(*ocpp16.ChangeConfigurationRequest); ok && err == nil {
+			s.configurationChanged(chargerID, change.Key, change.Value, response.(*ocpp16.ChangeConfigurationConfirmation).Status)
+		}
+		writeCommandResponse(w, command.Action(), response, err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// heartbeatIntervalKey is the configuration key holding the heartbeat interval in seconds
+const heartbeatIntervalKey = "HeartbeatInterval"
+
+// configDrift is a key whose reported value differs from its template
+type configDrift struct {
+	Key      string  `json:"key"`
+	Reported *string `json:"reported"`
+	Desired  string  `json:"desired"`
+	Readonly bool    `json:"readonly,omitempty"`
+	// why the key is not pushed again, if it is not
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// configChange is one ChangeConfiguration sent while correcting drift
+type configChange struct {
+	Key    string                     `json:"key"`
+	Value  string                     `json:"value"`
+	Status ocpp16.ConfigurationStatus `json:"status,omitempty"`
+	Error  string                     `json:"error,omitempty"`
+}
+
+// configSyncResult reports what a configuration synchronisation did
+type configSyncResult struct {
+	Keys       int            `json:"keys"`
+	TemplateID *int64         `json:"template_id,omitempty"`
+	Drift      []configDrift  `json:"drift"`
+	Changes    []configChange `json:"changes"`
+}
+
+// normalizeConfigValue makes list values such as MeterValuesSampledData comparable
+// regardless of the spacing a charger reports them with
+func normalizeConfigValue(value string) string {
+	parts := strings.Split(value, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return strings.Join(parts, ",")
+}
+
+// findDrift compares the stored keys of a charger with a template. A value the
+// charger already refused is not pushed again, nor is one waiting for a reboot
+// the charger has not done yet.
+func findDrift(template *models.ConfigTemplate, keys []models.ChargerConfigKey, lastBoot time.Time) []configDrift {
+	byKey := make(map[string]*models.ChargerConfigKey, len(keys))
+	for i := range keys {
+		byKey[keys[i].Key] = &keys[i]
+	}
+
+	drift := []configDrift{}
+	for key, desired := range template.Settings {
+		d := configDrift{Key: key, Desired: desired}
+		if k, ok := byKey[key]; ok {
+			if k.Value != nil && normalizeConfigValue(*k.Value) == normalizeConfigValue(desired) {
+				continue
+			}
+			d.Reported = k.Value
+			d.Readonly = k.Readonly
+
+			retried := k.Requested != nil && *k.Requested == desired
+			switch {
+			case k.Readonly:
+				d.Skipped = "readonly"
+			case retried && k.ChangeStatus == string(ocpp16.ConfigurationStatusNotSupported),
+				retried && k.ChangeStatus == string(ocpp16.ConfigurationStatusRejected):
+				d.Skipped = k.ChangeStatus
+			case retried && k.ChangeStatus == string(ocpp16.ConfigurationStatusRebootRequired) &&
+				k.ChangedAt != nil && !lastBoot.After(*k.ChangedAt):
+				d.Skipped = k.ChangeStatus
+			}
+		}
+		drift = append(drift, d)
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Key < drift[j].Key })
+	return drift
+}
+
+// chargerTemplate returns the template for the model a charger reported at boot,
+// together with its boot information; both are nil when there is none
+func chargerTemplate(ctx context.Context, chargerID string) (*models.ConfigTemplate, *models.ChargerInfo, error) {
+	info, err := db.GetChargerInfo(ctx, chargerID)
+	if err != nil || info == nil {
+		return nil, nil, err
+	}
+	template, err := db.FindConfigTemplate(ctx, info.Vendor, info.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+	return template, info, nil
+}
+
+// syncConfiguration fetches the full key set of a charger, stores it and pushes
+// ChangeConfiguration for every key drifting from the template of its model
+func (s *OCPPServer) syncConfiguration(ctx context.Context, chargerID string) (*configSyncResult, error) {
+	response, err := s.SendRemoteCommand(ctx, chargerID, &ocpp16.GetConfigurationRequest{})
+	if err != nil {
+		return nil, err
+	}
+	conf := response.(*ocpp16.GetConfigurationConfirmation)
+
+	now := time.Now()
+	keys := make([]models.ChargerConfigKey, 0, len(conf.ConfigurationKey))
+	for _, kv := range conf.ConfigurationKey {
+		keys = append(keys, models.ChargerConfigKey{
+			ChargerID:  chargerID,
+			Key:        kv.Key,
+			Value:      kv.Value,
+			Readonly:   kv.Readonly,
+			ReportedAt: now,
+		})
+	}
+	if err := db.SaveChargerConfiguration(ctx, chargerID, keys); err != nil {
+		return nil, err
+	}
+
+	result := &configSyncResult{Keys: len(keys), Drift: []configDrift{}, Changes: []configChange{}}
+	template, info, err := chargerTemplate(ctx, chargerID)
+	if err != nil || template == nil {
+		return result, err
+	}
+	result.TemplateID = &template.ID
+
+	// Stored keys carry the outcome of earlier ChangeConfiguration calls
+	keys, err = db.ListChargerConfiguration(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	result.Drift = findDrift(template, keys, info.LastBootAt)
+
+	for _, d := range result.Drift {
+		if d.Skipped != "" {
+			continue
+		}
+		change := configChange{Key: d.Key, Value: d.Desired}
+		response, err := s.SendRemoteCommand(ctx, chargerID, &ocpp16.ChangeConfigurationRequest{Key: d.Key, Value: d.Desired})
+		var callErr *ocpp16.Error
+		switch {
+		case errors.As(err, &callErr):
+			change.Error = callErr.Error()
+		case err != nil:
+			return result, err
+		default:
+			change.Status = response.(*ocpp16.ChangeConfigurationConfirmation).Status
+			if err := db.RecordConfigurationChange(ctx, chargerID, d.Key, d.Desired, string(change.Status), time.Now()); err != nil {
+				return result, err
+			}
+			s.configurationChanged(chargerID, d.Key, d.Desired, change.Status)
+		}
+		log.Printf("ChangeConfiguration %s=%s on %s: %s%s", d.Key, d.Desired, chargerID, change.Status, change.Error)
+		result.Changes = append(result.Changes, change)
+	}
+	return result, nil
+}
+
+// configurationChanged keeps the server in step with a configuration change the
+// charger answered: an accepted HeartbeatInterval moves its silence timeout, so that
+// a longer interval does not get a healthy charger disconnected
+func (s *OCPPServer) configurationChanged(chargerID, key, value string, status ocpp16.ConfigurationStatus) {
+	if status != ocpp16.ConfigurationStatusAccepted || key != heartbeatIntervalKey {
+		return
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return
+	}
+	interval := time.Duration(seconds) * time.Second
+	if charger := s.getCharger(chargerID); charger != nil {
+		charger.setHeartbeatInterval(interval)
+	}
+	s.setSOAPHeartbeatInterval(chargerID, interval)
+	log.Printf("Heartbeat interval of %s set to %s", chargerID, interval)
+}
+
+// resyncConfiguration synchronises the configuration of a charger in the background,
+// e.g. after it booted
+func (s *OCPPServer) resyncConfiguration(chargerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*remoteCommandTimeout)
+	defer cancel()
+
+	_, err := s.syncConfiguration(ctx, chargerID)
+	switch {
+	case err == nil, errors.Is(err, errChargerNotConnected):
+	case errors.Is(err, errInvalidCommand):
+		// e.g. an OCPP 2.0.1 station, which has no GetConfiguration
+		log.Printf("Configuration not synchronised: %v", err)
+	default:
+		log.Printf("Failed to synchronise configuration of %s: %v", chargerID, err)
+	}
+}
+
+// applyConfigTemplate resynchronises every connected charger a template applies to
+func (s *OCPPServer) applyConfigTemplate(template *models.ConfigTemplate) {
+	for _, chargerID := range s.GetConnectedChargers() {
+		current, _, err := chargerTemplate(context.Background(), chargerID)
+		if err != nil {
+			log.Printf("Failed to look up configuration template of %s: %v", chargerID, err)
+			continue
+		}
+		if current != nil && current.ID == template.ID {
+			go s.resyncConfiguration(chargerID)
+		}
+	}
+}
+
+// handleChargerConfiguration serves the stored key set of a charger and its drift
+// from the template of its model
+func (s *OCPPServer) handleChargerConfiguration(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chargerID := r.PathValue("id")
+	keys, err := db.ListChargerConfiguration(r.Context(), chargerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	template, info, err := chargerTemplate(r.Context(), chargerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	drift := []configDrift{}
+	if template != nil {
+		drift = findDrift(template, keys, info.LastBootAt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys":     keys,
+		"template": template,
+		"drift":    drift,
+	})
+}
+
+// handleChargerConfigurationSync fetches the configuration of a charger now and
+// corrects its drift
+func (s *OCPPServer) handleChargerConfigurationSync(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	result, err := s.syncConfiguration(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeCommandResponse(w, "GetConfiguration", nil, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// validateConfigTemplate checks a template before it is stored
+func validateConfigTemplate(template *models.ConfigTemplate) error {
+	if template.Model == "" {
+		return errors.New("model is required")
+	}
+	if len(template.Settings) == 0 {
+		return errors.New("settings must not be empty")
+	}
+	for key, value := range template.Settings {
+		if key == "" || len(key) > 50 {
+			return errors.New("configuration keys must be 1 to 50 characters")
+		}
+		if len(value) > 500 {
+			return errors.New("configuration values must be at most 500 characters")
+		}
+	}
+	return nil
+}
+
+func writeConfigTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrConfigTemplateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrConfigTemplateExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleConfigTemplates lists (GET) or creates (POST) configuration templates
+func (s *OCPPServer) handleConfigTemplates(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := db.ListConfigTemplates(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"templates": templates,
+		})
+
+	case http.MethodPost:
+		template := new(models.ConfigTemplate)
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		if err := json.NewDecoder(r.Body).Decode(template); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateConfigTemplate(template); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template.ID = 0
+		if err := db.CreateConfigTemplate(r.Context(), template); err != nil {
+			writeConfigTemplateError(w, err)
+			return
+		}
+		s.applyConfigTemplate(template)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(template)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleConfigTemplate reads (GET), replaces (PUT) or deletes (DELETE) one configuration template
+func (s *OCPPServer) handleConfigTemplate(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		template, err := db.GetConfigTemplate(r.Context(), id)
+		if err != nil {
+			writeConfigTemplateError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+
+	case http.MethodPut:
+		template := new(models.ConfigTemplate)
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		if err := json.NewDecoder(r.Body).Decode(template); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateConfigTemplate(template); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template.ID = id
+		if err := db.UpdateConfigTemplate(r.Context(), template); err != nil {
+			writeConfigTemplateError(w, err)
+			return
+		}
+		s.applyConfigTemplate(template)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+
+	case http.MethodDelete:
+		if err := db.DeleteConfigTemplate(r.Context(), id); err != nil {
+			writeConfigTemplateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds how long the writer may block on a single frame
+	writeWait = 10 * time.Second
+
+	// outboundQueueSize is the number of frames that may wait for the writer
+	outboundQueueSize = 64
+
+	// inboundQueueSize is the number of CALLs that may wait for processing; chargers
+	// are supposed to wait for each answer, so it only absorbs misbehaving ones
+	inboundQueueSize = 16
+)
+
+// errConnectionClosed is returned when a frame is queued on a connection that is shutting down
+var errConnectionClosed = errors.New("connection closed")
+
+// Charger represents a connected charger.
+//
+// The connection is run as an actor: the read loop in HandleWebSocket is the only
+// reader, writeLoop is the only writer and processCalls handles inbound CALLs one
+// at a time in the order they arrived. Everything else talks to the charger by
+// queueing frames with send.
+type Charger struct {
+	ID         string
+	Connection *websocket.Conn
+
+	// Generation numbers the connections of this identity, starting at 1
+	Generation uint64
+
+	// Protocol is the negotiated OCPP subprotocol, ocpp1.6 or ocpp2.0.1
+	Protocol string
+
+	outbound chan *ocpp16.Frame
+	inbound  chan *ocpp16.Frame
+	done     chan struct{}
+	once     sync.Once
+
+	// callSlot holds a token while a server-initiated CALL is outstanding;
+	// OCPP allows a single one per charger
+	callSlot chan struct{}
+
+	// localListSync runs the local list resynchronisation of the connection
+	localListSync sync.Once
+
+	mu                sync.RWMutex
+	lastSeen          time.Time
+	registration      ocpp16.RegistrationStatus
+	heartbeatInterval time.Duration
+	reason            string
+}
+
+// newCharger wraps an upgraded connection; run must be called to start its goroutines
+func newCharger(id string, conn *websocket.Conn, registration ocpp16.RegistrationStatus) *Charger {
+	// Chargers that do not ask for a subprotocol are treated as 1.6, as before negotiation existed
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		protocol = ocpp16.Subprotocol
+	}
+
+	return &Charger{
+		ID:                id,
+		Connection:        conn,
+		Protocol:          protocol,
+		outbound:          make(chan *ocpp16.Frame, outboundQueueSize),
+		inbound:           make(chan *ocpp16.Frame, inboundQueueSize),
+		done:              make(chan struct{}),
+		callSlot:          make(chan struct{}, 1),
+		lastSeen:          time.Now(),
+		registration:      registration,
+		heartbeatInterval: heartbeatInterval * time.Second,
+	}
+}
+
+// LastSeen returns when the last frame was received from the charger
+func (c *Charger) LastSeen() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSeen
+}
+
+func (c *Charger) touch() {
+	c.mu.Lock()
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+}
+
+// RegistrationStatus returns the registration status last answered to the charger
+func (c *Charger) RegistrationStatus() ocpp16.RegistrationStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.registration
+}
+
+func (c *Charger) setRegistrationStatus(status ocpp16.RegistrationStatus) {
+	c.mu.Lock()
+	c.registration = status
+	c.mu.Unlock()
+}
+
+// HeartbeatInterval returns the interval last sent to the charger in a BootNotification answer
+func (c *Charger) HeartbeatInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.heartbeatInterval
+}
+
+func (c *Charger) setHeartbeatInterval(interval time.Duration) {
+	c.mu.Lock()
+	c.heartbeatInterval = interval
+	c.mu.Unlock()
+}
+
+// send queues a frame for the writer goroutine
+func (c *Charger) send(frame *ocpp16.Frame) error {
+	select {
+	case <-c.done:
+		return errConnectionClosed
+	default:
+	}
+
+	select {
+	case c.outbound <- frame:
+		return nil
+	case <-c.done:
+		return errConnectionClosed
+	}
+}
+
+// newCall builds a CALL in the protocol of the connection
+func (c *Charger) newCall(messageID string, request ocpp16.Request) (*ocpp16.Frame, error) {
+	if c.Protocol == ocpp201.Subprotocol {
+		return ocpp201.NewCall(messageID, request)
+	}
+	return ocpp16.NewCall(messageID, request)
+}
+
+// newCallResult builds a CALLRESULT in the protocol of the connection
+func (c *Charger) newCallResult(messageID string, response ocpp16.Confirmation) (*ocpp16.Frame, error) {
+	if c.Protocol == ocpp201.Subprotocol {
+		return ocpp201.NewCallResult(messageID, response)
+	}
+	return ocpp16.NewCallResult(messageID, response)
+}
+
+// parseResult decodes the CALLRESULT payload answering a CALL of action
+func (c *Charger) parseResult(action string, payload []byte) (ocpp16.Confirmation, error) {
+	if c.Protocol == ocpp201.Subprotocol {
+		return ocpp201.ParseResponse(action, payload)
+	}
+	return ocpp16.ParseConfirmation(action, payload)
+}
+
+// enqueueCall hands an inbound CALL to processCalls, blocking the reader while the queue is full
+func (c *Charger) enqueueCall(frame *ocpp16.Frame) error {
+	select {
+	case c.inbound <- frame:
+		return nil
+	case <-c.done:
+		return errConnectionClosed
+	}
+}
+
+// close stops the writer and call processor and closes the socket; it is safe to call more than once
+func (c *Charger) close() {
+	c.closeWithReason("disconnected")
+}
+
+// closeWithReason closes the connection, remembering why if it is the first close
+func (c *Charger) closeWithReason(reason string) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.reason = reason
+		c.mu.Unlock()
+
+		close(c.done)
+		c.Connection.Close()
+	})
+}
+
+// closeReason returns why the connection was closed
+func (c *Charger) closeReason() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.reason
+}
+
+// closed is closed once the connection shuts down
+func (c *Charger) closed() <-chan struct{} {
+	return c.done
+}
+
+// writeLoop is the only goroutine writing to the socket. It also sends a ping
+// every pingInterval, unless pingInterval is 0.
+func (c *Charger) writeLoop(pingInterval time.Duration) {
+	defer c.close()
+
+	var ping <-chan time.Time
+	if pingInterval > 0 {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case frame := <-c.outbound:
+			c.Connection.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Connection.WriteJSON(frame); err != nil {
+				log.Printf("Error writing to %s: %v", c.ID, err)
+				return
+			}
+		case <-ping:
+			c.Connection.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Connection.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Error pinging %s: %v", c.ID, err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// processCalls handles the charger's CALLs sequentially so that their answers go out in order
+func (s *OCPPServer) processCalls(charger *Charger) {
+	for {
+		select {
+		case frame := <-charger.inbound:
+			if charger.Protocol == ocpp201.Subprotocol {
+				s.handleCallFrame201(charger, frame)
+			} else {
+				s.handleCallFrame(charger, frame)
+			}
+		case <-charger.done:
+			return
+		}
+	}
+}
+
+// run starts the writer and call processor of the connection and arms its read deadline
+func (s *OCPPServer) run(charger *Charger) {
+	charger.extendReadDeadline()
+	charger.Connection.SetPongHandler(func(string) error {
+		charger.extendReadDeadline()
+		return nil
+	})
+
+	go charger.writeLoop(s.pingInterval)
+	go s.processCalls(charger)
+}
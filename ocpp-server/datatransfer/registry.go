@@ -0,0 +1,175 @@
+// Package datatransfer dispatches vendor-specific DataTransfer messages to Go
+// handlers registered per vendorId and messageId, in both directions.
+//
+// Inbound handlers answer the DataTransfer CALLs chargers send. Outbound messages
+// describe how API parameters become the data of a DataTransfer sent to a charger
+// and how the data of its answer is read back.
+package datatransfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"ocpp-server/ocpp16"
+)
+
+// ErrUnknownMessage is returned when no outbound message is registered for a vendorId and messageId
+var ErrUnknownMessage = errors.New("unknown DataTransfer message")
+
+// ErrInvalidParams is returned by Encode functions for parameters they cannot send
+var ErrInvalidParams = errors.New("invalid DataTransfer parameters")
+
+// Key identifies a DataTransfer message. An empty MessageID stands for every
+// message of the vendor without a handler of its own.
+type Key struct {
+	VendorID  string `json:"vendor_id"`
+	MessageID string `json:"message_id"`
+}
+
+// InboundHandler answers a DataTransfer sent by a charger. Returning an error
+// answers with a CALLERROR instead.
+type InboundHandler func(ctx context.Context, chargerID, messageID, data string) (ocpp16.DataTransferStatus, string, error)
+
+// Outbound describes a DataTransfer the server sends to chargers
+type Outbound struct {
+	// Encode turns the parameters of an API call into the data field
+	Encode func(params json.RawMessage) (string, error)
+	// Decode reads the data of an Accepted answer; nil returns the data unchanged
+	Decode func(data string) (interface{}, error)
+}
+
+// Sender delivers a request to a connected charger and returns its answer
+type Sender interface {
+	SendRemoteCommand(ctx context.Context, chargerID string, request ocpp16.Request) (ocpp16.Confirmation, error)
+}
+
+// Result is the answer of a charger to an outbound DataTransfer
+type Result struct {
+	Status ocpp16.DataTransferStatus `json:"status"`
+	Data   interface{}               `json:"data,omitempty"`
+}
+
+// Registry holds the DataTransfer handlers. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	inbound  map[Key]InboundHandler
+	outbound map[Key]Outbound
+}
+
+// NewRegistry creates an empty registry; every inbound DataTransfer is answered
+// with UnknownVendorId until handlers are registered
+func NewRegistry() *Registry {
+	return &Registry{
+		inbound:  make(map[Key]InboundHandler),
+		outbound: make(map[Key]Outbound),
+	}
+}
+
+// HandleInbound registers the handler of DataTransfer CALLs for vendorID and
+// messageID; an empty messageID handles every other message of the vendor
+func (r *Registry) HandleInbound(vendorID, messageID string, handler InboundHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inbound[Key{vendorID, messageID}] = handler
+}
+
+// RegisterOutbound registers a DataTransfer message the server can send
+func (r *Registry) RegisterOutbound(vendorID, messageID string, message Outbound) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outbound[Key{vendorID, messageID}] = message
+}
+
+// Dispatch answers a DataTransfer CALL with the handler registered for it, or
+// with UnknownVendorId / UnknownMessageId when there is none
+func (r *Registry) Dispatch(ctx context.Context, chargerID string, req *ocpp16.DataTransferRequest) (*ocpp16.DataTransferConfirmation, error) {
+	r.mu.RLock()
+	handler, ok := r.inbound[Key{req.VendorId, req.MessageId}]
+	if !ok {
+		handler, ok = r.inbound[Key{req.VendorId, ""}]
+	}
+	knownVendor := ok
+	if !ok {
+		for key := range r.inbound {
+			if key.VendorID == req.VendorId {
+				knownVendor = true
+				break
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	if !ok {
+		if knownVendor {
+			return &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusUnknownMessageId}, nil
+		}
+		return &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusUnknownVendorId}, nil
+	}
+
+	status, data, err := handler(ctx, chargerID, req.MessageId, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &ocpp16.DataTransferConfirmation{Status: status, Data: data}, nil
+}
+
+// OutboundMessages lists the registered outbound messages, sorted
+func (r *Registry) OutboundMessages() []Key {
+	r.mu.RLock()
+	keys := make([]Key, 0, len(r.outbound))
+	for key := range r.outbound {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].VendorID != keys[j].VendorID {
+			return keys[i].VendorID < keys[j].VendorID
+		}
+		return keys[i].MessageID < keys[j].MessageID
+	})
+	return keys
+}
+
+// Send encodes params with the outbound message registered for vendorID and
+// messageID, sends the DataTransfer to a charger and decodes its answer
+func (r *Registry) Send(ctx context.Context, sender Sender, chargerID, vendorID, messageID string, params json.RawMessage) (*Result, error) {
+	r.mu.RLock()
+	message, ok := r.outbound[Key{vendorID, messageID}]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnknownMessage, vendorID, messageID)
+	}
+
+	data, err := message.Encode(params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := sender.SendRemoteCommand(ctx, chargerID, &ocpp16.DataTransferRequest{
+		VendorId:  vendorID,
+		MessageId: messageID,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conf := response.(*ocpp16.DataTransferConfirmation)
+	result := &Result{Status: conf.Status}
+	if conf.Data == "" {
+		return result, nil
+	}
+	if message.Decode == nil || conf.Status != ocpp16.DataTransferStatusAccepted {
+		result.Data = conf.Data
+		return result, nil
+	}
+	result.Data, err = message.Decode(conf.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s/%s answer from %s: %w", vendorID, messageID, chargerID, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,213 @@
+package datatransfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"ocpp-server/ocpp16"
+)
+
+// echo answers Accepted with the messageId and data it was given
+func echo(ctx context.Context, chargerID, messageID, data string) (ocpp16.DataTransferStatus, string, error) {
+	return ocpp16.DataTransferStatusAccepted, messageID + ":" + data, nil
+}
+
+func TestDispatch(t *testing.T) {
+	r := NewRegistry()
+	r.HandleInbound("acme", "status", echo)
+	r.HandleInbound("globex", "", echo)
+	r.HandleInbound("initech", "fail", func(ctx context.Context, chargerID, messageID, data string) (ocpp16.DataTransferStatus, string, error) {
+		return "", "", errors.New("broken")
+	})
+
+	tests := []struct {
+		name    string
+		req     ocpp16.DataTransferRequest
+		want    *ocpp16.DataTransferConfirmation
+		wantErr bool
+	}{
+		{
+			name: "registered message",
+			req:  ocpp16.DataTransferRequest{VendorId: "acme", MessageId: "status", Data: "x"},
+			want: &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusAccepted, Data: "status:x"},
+		},
+		{
+			name: "unknown vendor",
+			req:  ocpp16.DataTransferRequest{VendorId: "umbrella", MessageId: "status"},
+			want: &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusUnknownVendorId},
+		},
+		{
+			name: "unknown message of a known vendor",
+			req:  ocpp16.DataTransferRequest{VendorId: "acme", MessageId: "reset"},
+			want: &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusUnknownMessageId},
+		},
+		{
+			name: "wildcard messageId",
+			req:  ocpp16.DataTransferRequest{VendorId: "globex", MessageId: "anything", Data: "y"},
+			want: &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusAccepted, Data: "anything:y"},
+		},
+		{
+			name: "wildcard without messageId",
+			req:  ocpp16.DataTransferRequest{VendorId: "globex"},
+			want: &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusAccepted, Data: ":"},
+		},
+		{
+			name:    "handler error",
+			req:     ocpp16.DataTransferRequest{VendorId: "initech", MessageId: "fail"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Dispatch(context.Background(), "cp1", &tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSender answers every DataTransfer with conf, or err, and keeps the request
+type fakeSender struct {
+	conf *ocpp16.DataTransferConfirmation
+	err  error
+	sent *ocpp16.DataTransferRequest
+}
+
+func (s *fakeSender) SendRemoteCommand(ctx context.Context, chargerID string, request ocpp16.Request) (ocpp16.Confirmation, error) {
+	s.sent = request.(*ocpp16.DataTransferRequest)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.conf, nil
+}
+
+func TestSend(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterOutbound("acme", "setLimit", Outbound{
+		Encode: func(params json.RawMessage) (string, error) {
+			var p struct {
+				Limit int `json:"limit"`
+			}
+			if err := json.Unmarshal(params, &p); err != nil || p.Limit <= 0 {
+				return "", ErrInvalidParams
+			}
+			return fmt.Sprint(p.Limit), nil
+		},
+		Decode: func(data string) (interface{}, error) {
+			var v map[string]interface{}
+			err := json.Unmarshal([]byte(data), &v)
+			return v, err
+		},
+	})
+	r.RegisterOutbound("acme", "raw", Outbound{
+		Encode: func(params json.RawMessage) (string, error) { return string(params), nil },
+	})
+
+	tests := []struct {
+		name      string
+		messageID string
+		params    string
+		conf      *ocpp16.DataTransferConfirmation
+		sendErr   error
+		wantData  string
+		want      *Result
+		wantErr   error
+	}{
+		{
+			name:      "accepted answer is decoded",
+			messageID: "setLimit",
+			params:    `{"limit":16}`,
+			conf:      &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusAccepted, Data: `{"applied":true}`},
+			wantData:  "16",
+			want:      &Result{Status: ocpp16.DataTransferStatusAccepted, Data: map[string]interface{}{"applied": true}},
+		},
+		{
+			name:      "rejected answer keeps its data",
+			messageID: "setLimit",
+			params:    `{"limit":16}`,
+			conf:      &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusRejected, Data: "busy"},
+			wantData:  "16",
+			want:      &Result{Status: ocpp16.DataTransferStatusRejected, Data: "busy"},
+		},
+		{
+			name:      "answer without data",
+			messageID: "setLimit",
+			params:    `{"limit":16}`,
+			conf:      &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusAccepted},
+			wantData:  "16",
+			want:      &Result{Status: ocpp16.DataTransferStatusAccepted},
+		},
+		{
+			name:      "no decoder returns the data unchanged",
+			messageID: "raw",
+			params:    `"abc"`,
+			conf:      &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatusAccepted, Data: "def"},
+			wantData:  `"abc"`,
+			want:      &Result{Status: ocpp16.DataTransferStatusAccepted, Data: "def"},
+		},
+		{
+			name:      "unknown message",
+			messageID: "reset",
+			params:    `{}`,
+			wantErr:   ErrUnknownMessage,
+		},
+		{
+			name:      "invalid parameters",
+			messageID: "setLimit",
+			params:    `{"limit":0}`,
+			wantErr:   ErrInvalidParams,
+		},
+		{
+			name:      "charger not reachable",
+			messageID: "setLimit",
+			params:    `{"limit":16}`,
+			sendErr:   errOffline,
+			wantData:  "16",
+			wantErr:   errOffline,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeSender{conf: tt.conf, err: tt.sendErr}
+			got, err := r.Send(context.Background(), sender, "cp1", "acme", tt.messageID, json.RawMessage(tt.params))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %+v, %v, want %v", got, err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			if tt.wantData == "" {
+				if sender.sent != nil {
+					t.Errorf("sent %+v, want nothing", sender.sent)
+				}
+				return
+			}
+			want := ocpp16.DataTransferRequest{VendorId: "acme", MessageId: tt.messageID, Data: tt.wantData}
+			if sender.sent == nil || *sender.sent != want {
+				t.Errorf("sent %+v, want %+v", sender.sent, want)
+			}
+		})
+	}
+}
+
+var errOffline = errors.New("charger not connected")
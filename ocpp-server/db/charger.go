@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"ocpp-server/models"
+)
+
+// SaveChargerInfo stores the identification reported in a BootNotification
+func SaveChargerInfo(ctx context.Context, info *models.ChargerInfo) error {
+	_, err := DB.NewInsert().
+		Model(info).
+		On("CONFLICT (charger_id) DO UPDATE").
+		Set("vendor = EXCLUDED.vendor").
+		Set("model = EXCLUDED.model").
+		Set("charge_point_serial_number = EXCLUDED.charge_point_serial_number").
+		Set("charge_box_serial_number = EXCLUDED.charge_box_serial_number").
+		Set("firmware_version = EXCLUDED.firmware_version").
+		Set("iccid = EXCLUDED.iccid").
+		Set("imsi = EXCLUDED.imsi").
+		Set("meter_type = EXCLUDED.meter_type").
+		Set("meter_serial_number = EXCLUDED.meter_serial_number").
+		Set("last_boot_at = EXCLUDED.last_boot_at").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save charger info: %w", err)
+	}
+	return nil
+}
+
+// GetChargerInfo fetches the boot information of a charger, or nil if it never booted
+func GetChargerInfo(ctx context.Context, chargerID string) (*models.ChargerInfo, error) {
+	info := new(models.ChargerInfo)
+	err := DB.NewSelect().Model(info).Where("charger_id = ?", chargerID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch charger info: %w", err)
+	}
+	return info, nil
+}
+
+// UpdateConnectorStatus records a StatusNotification for a connector. Notifications
+// older than the stored one are ignored so that out-of-order frames cannot roll it back;
+// it reports whether the notification was recorded.
+func UpdateConnectorStatus(ctx context.Context, connector *models.Connector) (bool, error) {
+	res, err := DB.NewInsert().
+		Model(connector).
+		On("CONFLICT (charger_id, connector_id) DO UPDATE").
+		Set("status = EXCLUDED.status").
+		Set("error_code = EXCLUDED.error_code").
+		Set("info = EXCLUDED.info").
+		Set("vendor_id = EXCLUDED.vendor_id").
+		Set("vendor_error_code = EXCLUDED.vendor_error_code").
+		Set("timestamp = EXCLUDED.timestamp").
+		Set("updated_at = current_timestamp").
+		Where("connector.timestamp <= EXCLUDED.timestamp").
+		Exec(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to update connector status: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetConnectors fetches the latest status of every connector of a charger
+func GetConnectors(ctx context.Context, chargerID string) ([]models.Connector, error) {
+	connectors := []models.Connector{}
+	err := DB.NewSelect().
+		Model(&connectors).
+		Where("charger_id = ?", chargerID).
+		Order("connector_id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch connectors: %w", err)
+	}
+	return connectors, nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"ocpp-server/models"
+
+	"github.com/uptrace/bun"
+)
+
+// ChargingProfileFilter selects charging profiles the way ClearChargingProfile does:
+// a profile matches when it meets every criterion that is set
+type ChargingProfileFilter struct {
+	ChargingProfileID *int
+	ConnectorID       *int
+	Purpose           string
+	StackLevel        *int
+}
+
+func (f ChargingProfileFilter) apply(q bun.QueryBuilder) bun.QueryBuilder {
+	if f.ChargingProfileID != nil {
+		q = q.Where("charging_profile_id = ?", *f.ChargingProfileID)
+	}
+	if f.ConnectorID != nil {
+		q = q.Where("connector_id = ?", *f.ConnectorID)
+	}
+	if f.Purpose != "" {
+		q = q.Where("purpose = ?", f.Purpose)
+	}
+	if f.StackLevel != nil {
+		q = q.Where("stack_level = ?", *f.StackLevel)
+	}
+	return q
+}
+
+// SaveChargingProfile stores a profile accepted by a charger. Like the charger
+// itself, it replaces any profile with the same id or with the same connector,
+// purpose and stack level.
+func SaveChargingProfile(ctx context.Context, profile *models.ChargingProfile) error {
+	err := DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().
+			Model((*models.ChargingProfile)(nil)).
+			Where("charger_id = ?", profile.ChargerID).
+			Where("(charging_profile_id = ? OR (connector_id = ? AND purpose = ? AND stack_level = ?))",
+				profile.ChargingProfileID, profile.ConnectorID, profile.Purpose, profile.StackLevel).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(profile).Returning("*").Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save charging profile: %w", err)
+	}
+	return nil
+}
+
+// ListChargingProfiles fetches the profiles installed on a charger
+func ListChargingProfiles(ctx context.Context, chargerID string) ([]models.ChargingProfile, error) {
+	profiles := []models.ChargingProfile{}
+	err := DB.NewSelect().
+		Model(&profiles).
+		Where("charger_id = ?", chargerID).
+		Order("connector_id ASC", "purpose ASC", "stack_level DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch charging profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// DeleteChargingProfiles removes the profiles of a charger matching filter and
+// returns how many were removed
+func DeleteChargingProfiles(ctx context.Context, chargerID string, filter ChargingProfileFilter) (int64, error) {
+	res, err := DB.NewDelete().
+		Model((*models.ChargingProfile)(nil)).
+		Where("charger_id = ?", chargerID).
+		ApplyQueryBuilder(filter.apply).
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete charging profiles: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// DeleteTransactionProfiles removes the TxProfiles of a transaction, which the
+// charger discards when the transaction ends
+func DeleteTransactionProfiles(ctx context.Context, chargerID string, transactionID int) error {
+	_, err := DB.NewDelete().
+		Model((*models.ChargingProfile)(nil)).
+		Where("charger_id = ?", chargerID).
+		Where("purpose = ?", "TxProfile").
+		Where("transaction_id = ?", transactionID).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete transaction profiles: %w", err)
+	}
+	return nil
+}
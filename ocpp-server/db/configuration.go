@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ocpp-server/models"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// ErrConfigTemplateNotFound is returned when no configuration template has the requested ID
+var ErrConfigTemplateNotFound = errors.New("configuration template not found")
+
+// ErrConfigTemplateExists is returned when a vendor and model already have a template
+var ErrConfigTemplateExists = errors.New("a template already exists for this vendor and model")
+
+// SaveChargerConfiguration replaces the stored key set of a charger with the keys
+// of a full GetConfiguration answer. The outcome of earlier ChangeConfiguration
+// calls is kept for the keys still reported, and a key the charger refused is
+// kept even when it is not reported so that it is not pushed again.
+func SaveChargerConfiguration(ctx context.Context, chargerID string, keys []models.ChargerConfigKey) error {
+	return DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		names := make([]string, len(keys))
+		for i := range keys {
+			names[i] = keys[i].Key
+		}
+
+		query := tx.NewDelete().
+			Model((*models.ChargerConfigKey)(nil)).
+			Where("charger_id = ?", chargerID).
+			Where("change_status IS NULL OR change_status NOT IN ('NotSupported', 'Rejected')")
+		if len(names) > 0 {
+			query = query.Where("key NOT IN (?)", bun.In(names))
+		}
+		if _, err := query.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to delete configuration keys: %w", err)
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		_, err := tx.NewInsert().
+			Model(&keys).
+			On("CONFLICT (charger_id, key) DO UPDATE").
+			Set("value = EXCLUDED.value").
+			Set("readonly = EXCLUDED.readonly").
+			Set("reported_at = EXCLUDED.reported_at").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to save configuration keys: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListChargerConfiguration returns the stored configuration keys of a charger
+func ListChargerConfiguration(ctx context.Context, chargerID string) ([]models.ChargerConfigKey, error) {
+	keys := []models.ChargerConfigKey{}
+	err := DB.NewSelect().
+		Model(&keys).
+		Where("charger_id = ?", chargerID).
+		Order("key ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configuration keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RecordConfigurationChange stores the answer to a ChangeConfiguration. An
+// accepted value is also the key's value from now on.
+func RecordConfigurationChange(ctx context.Context, chargerID, key, value, status string, at time.Time) error {
+	row := &models.ChargerConfigKey{
+		ChargerID:    chargerID,
+		Key:          key,
+		Requested:    &value,
+		ChangeStatus: status,
+		ChangedAt:    &at,
+		ReportedAt:   at,
+	}
+	if status == "Accepted" {
+		row.Value = &value
+	}
+
+	query := DB.NewInsert().
+		Model(row).
+		On("CONFLICT (charger_id, key) DO UPDATE").
+		Set("requested = EXCLUDED.requested").
+		Set("change_status = EXCLUDED.change_status").
+		Set("changed_at = EXCLUDED.changed_at")
+	if row.Value != nil {
+		query = query.Set("value = EXCLUDED.value")
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record configuration change: %w", err)
+	}
+	return nil
+}
+
+// ListConfigTemplates returns every configuration template
+func ListConfigTemplates(ctx context.Context) ([]models.ConfigTemplate, error) {
+	templates := []models.ConfigTemplate{}
+	if err := DB.NewSelect().Model(&templates).Order("vendor ASC", "model ASC").Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list configuration templates: %w", err)
+	}
+	return templates, nil
+}
+
+// GetConfigTemplate fetches a configuration template by ID
+func GetConfigTemplate(ctx context.Context, id int64) (*models.ConfigTemplate, error) {
+	template := new(models.ConfigTemplate)
+	err := DB.NewSelect().Model(template).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConfigTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch configuration template: %w", err)
+	}
+	return template, nil
+}
+
+// FindConfigTemplate returns the template applying to a charger model, preferring
+// one for the exact vendor over a vendor-independent one, or nil if there is none
+func FindConfigTemplate(ctx context.Context, vendor, model string) (*models.ConfigTemplate, error) {
+	template := new(models.ConfigTemplate)
+	err := DB.NewSelect().
+		Model(template).
+		Where("model = ?", model).
+		Where("vendor = ? OR vendor = ''", vendor).
+		OrderExpr("vendor DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch configuration template: %w", err)
+	}
+	return template, nil
+}
+
+// CreateConfigTemplate inserts a configuration template
+func CreateConfigTemplate(ctx context.Context, template *models.ConfigTemplate) error {
+	if _, err := DB.NewInsert().Model(template).Returning("*").Exec(ctx); err != nil {
+		if isUniqueViolation(err) {
+			return ErrConfigTemplateExists
+		}
+		return fmt.Errorf("failed to create configuration template: %w", err)
+	}
+	return nil
+}
+
+// UpdateConfigTemplate overwrites a configuration template
+func UpdateConfigTemplate(ctx context.Context, template *models.ConfigTemplate) error {
+	// A Set clause would replace the columns listed instead of adding to them
+	template.UpdatedAt = time.Now()
+	res, err := DB.NewUpdate().
+		Model(template).
+		Column("vendor", "model", "settings", "updated_at").
+		WherePK().
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrConfigTemplateExists
+		}
+		return fmt.Errorf("failed to update configuration template: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConfigTemplateNotFound
+	}
+	return nil
+}
+
+// DeleteConfigTemplate removes a configuration template
+func DeleteConfigTemplate(ctx context.Context, id int64) error {
+	res, err := DB.NewDelete().Model((*models.ConfigTemplate)(nil)).Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete configuration template: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConfigTemplateNotFound
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation
+func isUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ocpp-server/models"
+)
+
+func TestUpdateConfigTemplateWritesSettings(t *testing.T) {
+	queries := recordQueries(t)
+
+	template := &models.ConfigTemplate{
+		ID:       1,
+		Vendor:   "acme",
+		Model:    "ac22",
+		Settings: map[string]string{"HeartbeatInterval": "300"},
+	}
+	UpdateConfigTemplate(context.Background(), template)
+
+	if len(*queries) != 1 {
+		t.Fatalf("got queries %q, want one UPDATE", *queries)
+	}
+	query := (*queries)[0]
+	for _, column := range []string{
+		`"vendor" = 'acme'`,
+		`"model" = 'ac22'`,
+		`"settings" = '{"HeartbeatInterval":"300"}'`,
+		`"updated_at" = `,
+	} {
+		if !strings.Contains(query, column) {
+			t.Errorf("UPDATE does not set %s: %s", column, query)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -54,15 +55,90 @@ func Init() error {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 	log.Println("Connected to database!")
+
+	if err := createSchema(ctx); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
 	return nil
 }
 
+// createSchema creates the tables owned by the OCPP server if they do not exist yet
+func createSchema(ctx context.Context) error {
+	tables := []interface{}{
+		(*models.Transaction)(nil),
+		(*models.MeterValue)(nil),
+		(*models.ChargerInfo)(nil),
+		(*models.Connector)(nil),
+		(*models.ChargerRegistration)(nil),
+		(*models.ChargerSecurity)(nil),
+		(*models.ChargingProfile)(nil),
+		(*models.Site)(nil),
+		(*models.ChargerJob)(nil),
+		(*models.LocalList)(nil),
+		(*models.Reservation)(nil),
+		(*models.ChargerConfigKey)(nil),
+		(*models.ConfigTemplate)(nil),
+		(*models.ProcessedMessage)(nil),
+	}
+
+	for _, model := range tables {
+		_, err := DB.NewCreateTable().
+			Model(model).
+			IfNotExists().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := DB.NewCreateIndex().
+		Model((*models.MeterValue)(nil)).
+		Index("meter_value_transaction_id_idx").
+		Column("transaction_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.NewCreateIndex().
+		Model((*models.MeterValue)(nil)).
+		Index("meter_value_connector_idx").
+		Column("charger_id", "connector_id", "timestamp").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = DB.NewCreateIndex().
+		Model((*models.Transaction)(nil)).
+		Index("transaction_ocpp_transaction_id_idx").
+		Unique().
+		Column("charger_id", "ocpp_transaction_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Database schema created successfully")
+	return nil
+}
+
+// whereIdentity matches the charging point an OCPP identity refers to: the
+// identity in the WebSocket URL is either the charging_point id or its name
+func whereIdentity(identity string) func(q bun.QueryBuilder) bun.QueryBuilder {
+	return func(q bun.QueryBuilder) bun.QueryBuilder {
+		return q.Where("CAST(cp.id AS text) = ? OR cp.name = ?", identity, identity)
+	}
+}
+
 // UpdateChargerStatus updates the status of a charger in the database by charger ID
 func UpdateChargerStatus(ctx context.Context, chargerID string, status string) error {
 	_, err := DB.NewUpdate().
 		Model(&models.CP{}).
 		Set("status = ?", status).
-		Where("id = ?", chargerID).
+		ApplyQueryBuilder(whereIdentity(chargerID)).
 		Exec(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to update charger status: %w", err)
@@ -92,3 +168,23 @@ func GetChargerByID(ctx context.Context, chargerID string) (*models.CP, error) {
 	}
 	return charger, nil
 }
+
+// ErrChargingPointNotFound is returned when no charging_point matches an OCPP identity
+var ErrChargingPointNotFound = errors.New("charging point not found")
+
+// FindChargingPoint fetches the charging point an OCPP identity refers to
+func FindChargingPoint(ctx context.Context, identity string) (*models.CP, error) {
+	charger := new(models.CP)
+	err := DB.NewSelect().
+		Model(charger).
+		ApplyQueryBuilder(whereIdentity(identity)).
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChargingPointNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch charger: %w", err)
+	}
+	return charger, nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// testDatabase connects DB to the Postgres database named by OCPP_TEST_DATABASE_URL,
+// skipping the test when there is none. The schema is created on first use.
+func testDatabase(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("OCPP_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("OCPP_TEST_DATABASE_URL not set")
+	}
+	testDatabaseOnce.Do(func() {
+		os.Setenv("DATABASE_URL", dsn)
+		testDatabaseErr = Init()
+	})
+	if testDatabaseErr != nil {
+		t.Fatalf("test database: %v", testDatabaseErr)
+	}
+}
+
+var (
+	testDatabaseOnce sync.Once
+	testDatabaseErr  error
+)
+
+// recordQueries points DB at a driver that answers every statement with no rows
+// and returns the statements it was sent
+func recordQueries(t *testing.T) *[]string {
+	t.Helper()
+	queries := new([]string)
+	saved := DB
+	DB = bun.NewDB(sql.OpenDB(&recordingConnector{queries: queries}), pgdialect.New())
+	t.Cleanup(func() {
+		DB.Close()
+		DB = saved
+	})
+	return queries
+}
+
+type recordingConnector struct {
+	mu      sync.Mutex
+	queries *[]string
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{connector: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver { return nil }
+
+func (c *recordingConnector) record(query string) {
+	c.mu.Lock()
+	*c.queries = append(*c.queries, query)
+	c.mu.Unlock()
+}
+
+type recordingConn struct {
+	connector *recordingConnector
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *recordingConn) Commit() error { return nil }
+
+func (c *recordingConn) Rollback() error { return nil }
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.connector.record(query)
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"ocpp-server/models"
+)
+
+// ErrIdTagNotFound is returned when an idTag is not registered
+var ErrIdTagNotFound = errors.New("idTag not found")
+
+// GetIdTag fetches an idTag together with the status of the user owning it
+func GetIdTag(ctx context.Context, tag string) (*models.IdTag, error) {
+	idTag := new(models.IdTag)
+	err := DB.NewSelect().
+		Model(idTag).
+		ColumnExpr("id_tag.*").
+		ColumnExpr("u.status AS user_status").
+		Join("LEFT JOIN users AS u ON u.id = id_tag.user_id").
+		Where("id_tag.tag = ?", tag).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdTagNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch idTag: %w", err)
+	}
+	return idTag, nil
+}
+
+// ListIdTags fetches every idTag together with the status of the user owning it
+func ListIdTags(ctx context.Context) ([]models.IdTag, error) {
+	tags := []models.IdTag{}
+	err := DB.NewSelect().
+		Model(&tags).
+		ColumnExpr("id_tag.*").
+		ColumnExpr("u.status AS user_status").
+		Join("LEFT JOIN users AS u ON u.id = id_tag.user_id").
+		Order("id_tag.tag ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list idTags: %w", err)
+	}
+	return tags, nil
+}
+
+// HasActiveTransaction reports whether idTag is already used by a running transaction
+func HasActiveTransaction(ctx context.Context, idTag string) (bool, error) {
+	exists, err := DB.NewSelect().
+		Model((*models.Transaction)(nil)).
+		Where("id_tag = ?", idTag).
+		Where("status = ?", models.TransactionStatusActive).
+		Exists(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check active transactions: %w", err)
+	}
+	return exists, nil
+}
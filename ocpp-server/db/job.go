@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ocpp-server/models"
+)
+
+// ErrJobNotFound is returned when no job has the requested ID
+var ErrJobNotFound = errors.New("job not found")
+
+// JobFilter selects jobs in ListJobs; empty fields match everything
+type JobFilter struct {
+	ChargerID string
+	Type      string
+	RolloutID string
+	Status    string
+	Result    string
+}
+
+// CreateJob inserts a job
+func CreateJob(ctx context.Context, job *models.ChargerJob) error {
+	if _, err := DB.NewInsert().Model(job).Returning("*").Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+// UpdateJob stores the progress of a job
+func UpdateJob(ctx context.Context, job *models.ChargerJob) error {
+	// A Set clause would replace the columns listed instead of adding to them
+	job.UpdatedAt = time.Now()
+	_, err := DB.NewUpdate().
+		Model(job).
+		Column("location", "upload_token", "status", "result", "error", "file_name", "file_size", "completed_at", "updated_at").
+		WherePK().
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	return nil
+}
+
+// GetJob fetches a job by ID
+func GetJob(ctx context.Context, id int64) (*models.ChargerJob, error) {
+	job := new(models.ChargerJob)
+	err := DB.NewSelect().Model(job).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch job: %w", err)
+	}
+	return job, nil
+}
+
+// GetRunningJob returns the latest unfinished job of a type on a charger, or nil if none
+func GetRunningJob(ctx context.Context, chargerID, jobType string) (*models.ChargerJob, error) {
+	job := new(models.ChargerJob)
+	err := DB.NewSelect().
+		Model(job).
+		Where("charger_id = ?", chargerID).
+		Where("type = ?", jobType).
+		Where("result = ''").
+		Order("created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch running job: %w", err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the jobs matching filter, newest first
+func ListJobs(ctx context.Context, filter JobFilter) ([]models.ChargerJob, error) {
+	jobs := []models.ChargerJob{}
+	query := DB.NewSelect().Model(&jobs).Order("created_at DESC")
+	if filter.ChargerID != "" {
+		query = query.Where("charger_id = ?", filter.ChargerID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.RolloutID != "" {
+		query = query.Where("rollout_id = ?", filter.RolloutID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ocpp-server/models"
+)
+
+func TestUpdateJobWritesUploadToken(t *testing.T) {
+	queries := recordQueries(t)
+
+	job := &models.ChargerJob{ID: 1, Type: models.JobTypeDiagnostics, UploadToken: "secret"}
+	UpdateJob(context.Background(), job)
+
+	if len(*queries) != 1 {
+		t.Fatalf("got queries %q, want one UPDATE", *queries)
+	}
+	if query := (*queries)[0]; !strings.Contains(query, `"upload_token" = 'secret'`) {
+		t.Errorf("UPDATE does not store the upload token: %s", query)
+	}
+}
+
+func TestDiagnosticsJobUploadToken(t *testing.T) {
+	testDatabase(t)
+	ctx := context.Background()
+
+	job := &models.ChargerJob{
+		ChargerID: "test-upload-token",
+		Type:      models.JobTypeDiagnostics,
+		Status:    models.JobStatusRequested,
+	}
+	if err := CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DB.NewDelete().Model(job).WherePK().Exec(ctx)
+	})
+
+	job.UploadToken = "0123456789abcdef"
+	job.Location = "http://localhost:9000/files/diagnostics/1/" + job.UploadToken
+	if err := UpdateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.UploadToken != "0123456789abcdef" {
+		t.Errorf("UpdateJob reset the token to %q", job.UploadToken)
+	}
+
+	stored, err := GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UploadToken != job.UploadToken {
+		t.Errorf("stored token %q, want %q", stored.UploadToken, job.UploadToken)
+	}
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"ocpp-server/models"
+)
+
+// GetLocalList fetches the local list state of a charger, or nil if it never received one
+func GetLocalList(ctx context.Context, chargerID string) (*models.LocalList, error) {
+	list := new(models.LocalList)
+	err := DB.NewSelect().Model(list).Where("charger_id = ?", chargerID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch local list: %w", err)
+	}
+	return list, nil
+}
+
+// SaveLocalList stores the local list state of a charger
+func SaveLocalList(ctx context.Context, list *models.LocalList) error {
+	_, err := DB.NewInsert().
+		Model(list).
+		On("CONFLICT (charger_id) DO UPDATE").
+		Set("version = EXCLUDED.version").
+		Set("entries = EXCLUDED.entries").
+		Set("entry_count = EXCLUDED.entry_count").
+		Set("last_status = EXCLUDED.last_status").
+		Set("synced_at = EXCLUDED.synced_at").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save local list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ocpp-server/models"
+)
+
+// ErrRegistrationNotFound is returned when no registration exists for a charger
+var ErrRegistrationNotFound = errors.New("registration not found")
+
+// GetRegistration fetches the registration record of a charger
+func GetRegistration(ctx context.Context, chargerID string) (*models.ChargerRegistration, error) {
+	reg := new(models.ChargerRegistration)
+	err := DB.NewSelect().Model(reg).Where("charger_id = ?", chargerID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRegistrationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registration: %w", err)
+	}
+	return reg, nil
+}
+
+// RecordPendingRegistration creates or refreshes the pending registration of an unknown charger.
+// A decision already taken by an operator is left untouched.
+func RecordPendingRegistration(ctx context.Context, reg *models.ChargerRegistration) error {
+	_, err := DB.NewInsert().
+		Model(reg).
+		On("CONFLICT (charger_id) DO UPDATE").
+		Set("vendor = EXCLUDED.vendor").
+		Set("model = EXCLUDED.model").
+		Set("last_seen_at = EXCLUDED.last_seen_at").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to record registration: %w", err)
+	}
+	return nil
+}
+
+// ListRegistrations returns registrations, optionally filtered by status
+func ListRegistrations(ctx context.Context, status string) ([]models.ChargerRegistration, error) {
+	regs := []models.ChargerRegistration{}
+	query := DB.NewSelect().Model(&regs).Order("last_seen_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list registrations: %w", err)
+	}
+	return regs, nil
+}
+
+// DecideRegistration stores an operator's Accepted/Rejected decision for a charger
+func DecideRegistration(ctx context.Context, chargerID, status string) (*models.ChargerRegistration, error) {
+	now := time.Now()
+	reg := &models.ChargerRegistration{
+		ChargerID:   chargerID,
+		Status:      status,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+		DecidedAt:   &now,
+	}
+	_, err := DB.NewInsert().
+		Model(reg).
+		On("CONFLICT (charger_id) DO UPDATE").
+		Set("status = EXCLUDED.status").
+		Set("decided_at = EXCLUDED.decided_at").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update registration: %w", err)
+	}
+	return reg, nil
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ocpp-server/models"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrReservationNotFound is returned when no reservation has the requested ID
+var ErrReservationNotFound = errors.New("reservation not found")
+
+// ErrReservationConflict is returned when a connector is already reserved during a window
+var ErrReservationConflict = errors.New("connector already reserved during this window")
+
+// openReservationStatuses are the statuses still holding their connector
+var openReservationStatuses = []string{models.ReservationStatusScheduled, models.ReservationStatusActive}
+
+// CreateReservation inserts a reservation unless its window overlaps an open
+// reservation of the same connector. The check and the insert run in one
+// transaction holding a lock on the connector, so concurrent requests for
+// overlapping windows cannot both succeed.
+func CreateReservation(ctx context.Context, res *models.Reservation) error {
+	err := DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Overlapping rows may not exist yet, so SELECT ... FOR UPDATE would lock
+		// nothing; lock the connector itself until the transaction ends
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?), ?)", res.ChargerID, res.ConnectorID)
+		if err != nil {
+			return err
+		}
+
+		exists, err := tx.NewSelect().
+			Model((*models.Reservation)(nil)).
+			Where("charger_id = ?", res.ChargerID).
+			Where("connector_id = ?", res.ConnectorID).
+			Where("status IN (?)", bun.In(openReservationStatuses)).
+			Where("starts_at < ?", res.ExpiresAt).
+			Where("expires_at > ?", res.StartsAt).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrReservationConflict
+		}
+
+		_, err = tx.NewInsert().Model(res).Returning("*").Exec(ctx)
+		return err
+	})
+	if errors.Is(err, ErrReservationConflict) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create reservation: %w", err)
+	}
+	return nil
+}
+
+// GetReservation fetches a reservation by ID
+func GetReservation(ctx context.Context, id int64) (*models.Reservation, error) {
+	res := new(models.Reservation)
+	err := DB.NewSelect().Model(res).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReservationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reservation: %w", err)
+	}
+	return res, nil
+}
+
+// UpdateReservationStatus moves a reservation to status, recording errMsg if any
+func UpdateReservationStatus(ctx context.Context, res *models.Reservation, status, errMsg string) error {
+	res.Status = status
+	res.Error = errMsg
+	// A Set clause would replace the columns listed instead of adding to them
+	res.UpdatedAt = time.Now()
+	_, err := DB.NewUpdate().
+		Model(res).
+		Column("status", "error", "updated_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update reservation: %w", err)
+	}
+	return nil
+}
+
+// UseReservation links an open reservation of a charger to the transaction started on it
+func UseReservation(ctx context.Context, id int64, chargerID string, transactionID int64) error {
+	res, err := DB.NewUpdate().
+		Model((*models.Reservation)(nil)).
+		Set("status = ?", models.ReservationStatusUsed).
+		Set("transaction_id = ?", transactionID).
+		Set("updated_at = current_timestamp").
+		Where("id = ?", id).
+		Where("charger_id = ?", chargerID).
+		Where("status IN (?)", bun.In(openReservationStatuses)).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to use reservation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrReservationNotFound
+	}
+	return nil
+}
+
+// ListReservations returns the reservations of a user (userID != nil) or of a
+// charger (chargerID != ""), newest window first
+func ListReservations(ctx context.Context, userID *int64, chargerID string) ([]models.Reservation, error) {
+	reservations := []models.Reservation{}
+	query := DB.NewSelect().Model(&reservations).Order("starts_at DESC")
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if chargerID != "" {
+		query = query.Where("charger_id = ?", chargerID)
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// DueReservations returns scheduled reservations whose window has opened by now
+func DueReservations(ctx context.Context, now time.Time) ([]models.Reservation, error) {
+	reservations := []models.Reservation{}
+	err := DB.NewSelect().
+		Model(&reservations).
+		Where("status = ?", models.ReservationStatusScheduled).
+		Where("starts_at <= ?", now).
+		Where("expires_at > ?", now).
+		Order("starts_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// ExpireReservations marks open reservations whose window has closed as expired
+// and returns how many were
+func ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	res, err := DB.NewUpdate().
+		Model((*models.Reservation)(nil)).
+		Set("status = ?", models.ReservationStatusExpired).
+		Set("updated_at = current_timestamp").
+		Where("status IN (?)", bun.In(openReservationStatuses)).
+		Where("expires_at <= ?", now).
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire reservations: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ocpp-server/models"
+)
+
+func TestUpdateReservationStatusWritesStatus(t *testing.T) {
+	queries := recordQueries(t)
+
+	res := &models.Reservation{ID: 1, Status: models.ReservationStatusActive}
+	UpdateReservationStatus(context.Background(), res, models.ReservationStatusCancelled, "charger answered Rejected")
+
+	if len(*queries) != 1 {
+		t.Fatalf("got queries %q, want one UPDATE", *queries)
+	}
+	query := (*queries)[0]
+	for _, column := range []string{
+		`"status" = '` + models.ReservationStatusCancelled + `'`,
+		`"error" = 'charger answered Rejected'`,
+		`"updated_at" = `,
+	} {
+		if !strings.Contains(query, column) {
+			t.Errorf("UPDATE does not set %s: %s", column, query)
+		}
+	}
+}
+
+// testReservations removes the reservations of chargerID once the test ends
+func testReservations(t *testing.T, chargerID string) {
+	t.Cleanup(func() {
+		DB.NewDelete().Model((*models.Reservation)(nil)).Where("charger_id = ?", chargerID).Exec(context.Background())
+	})
+}
+
+func TestCreateReservationOverlap(t *testing.T) {
+	testDatabase(t)
+	ctx := context.Background()
+	chargerID := "test-overlap-" + time.Now().Format("150405.000000")
+	testReservations(t, chargerID)
+
+	at := func(hour int) time.Time {
+		return time.Date(2030, 1, 1, hour, 0, 0, 0, time.UTC)
+	}
+	reservation := func(connectorID, from, to int) *models.Reservation {
+		return &models.Reservation{
+			ChargerID:   chargerID,
+			ConnectorID: connectorID,
+			IdTag:       "TAG1",
+			StartsAt:    at(from),
+			ExpiresAt:   at(to),
+			Status:      models.ReservationStatusScheduled,
+		}
+	}
+
+	// Connector 1 is reserved from 10:00 to 12:00; a cancelled reservation from
+	// 14:00 to 16:00 no longer holds it
+	if err := CreateReservation(ctx, reservation(1, 10, 12)); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := reservation(1, 14, 16)
+	if err := CreateReservation(ctx, cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateReservationStatus(ctx, cancelled, models.ReservationStatusCancelled, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		res      *models.Reservation
+		conflict bool
+	}{
+		{name: "same window", res: reservation(1, 10, 12), conflict: true},
+		{name: "starts inside", res: reservation(1, 11, 13), conflict: true},
+		{name: "ends inside", res: reservation(1, 9, 11), conflict: true},
+		{name: "contains it", res: reservation(1, 9, 13), conflict: true},
+		{name: "ends when it starts", res: reservation(1, 8, 10)},
+		{name: "starts when it ends", res: reservation(1, 12, 13)},
+		{name: "other connector", res: reservation(2, 10, 12)},
+		{name: "over a cancelled reservation", res: reservation(1, 14, 16)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CreateReservation(ctx, tt.res)
+			if tt.conflict {
+				if !errors.Is(err, ErrReservationConflict) {
+					t.Errorf("error %v, want %v", err, ErrReservationConflict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Keep the windows accepted so far from overlapping the next cases
+			if err := UpdateReservationStatus(ctx, tt.res, models.ReservationStatusCancelled, ""); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReservationExpiry(t *testing.T) {
+	testDatabase(t)
+	ctx := context.Background()
+	chargerID := "test-expiry-" + time.Now().Format("150405.000000")
+	testReservations(t, chargerID)
+
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	reservations := map[string]*models.Reservation{
+		"lapsed":     {StartsAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Status: models.ReservationStatusScheduled},
+		"lapsed now": {StartsAt: now.Add(-time.Hour), ExpiresAt: now, Status: models.ReservationStatusActive},
+		"due":        {StartsAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour), Status: models.ReservationStatusScheduled},
+		"active":     {StartsAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour), Status: models.ReservationStatusActive},
+		"later":      {StartsAt: now.Add(time.Hour), ExpiresAt: now.Add(2 * time.Hour), Status: models.ReservationStatusScheduled},
+		"used":       {StartsAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Status: models.ReservationStatusUsed},
+	}
+	connectorID := 0
+	for _, res := range reservations {
+		connectorID++
+		res.ChargerID, res.ConnectorID, res.IdTag = chargerID, connectorID, "TAG1"
+		if err := CreateReservation(ctx, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := ExpireReservations(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 2 {
+		t.Errorf("expired %d reservations, want at least 2", n)
+	}
+
+	due, err := DueReservations(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dueIDs := make(map[int64]bool)
+	for _, res := range due {
+		dueIDs[res.ID] = true
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		due    bool
+	}{
+		{name: "lapsed", status: models.ReservationStatusExpired},
+		{name: "lapsed now", status: models.ReservationStatusExpired},
+		{name: "due", status: models.ReservationStatusScheduled, due: true},
+		{name: "active", status: models.ReservationStatusActive},
+		{name: "later", status: models.ReservationStatusScheduled},
+		{name: "used", status: models.ReservationStatusUsed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := GetReservation(ctx, reservations[tt.name].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.status {
+				t.Errorf("status %s, want %s", stored.Status, tt.status)
+			}
+			if dueIDs[stored.ID] != tt.due {
+				t.Errorf("due %v, want %v", dueIDs[stored.ID], tt.due)
+			}
+		})
+	}
+}
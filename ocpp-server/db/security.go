@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"ocpp-server/models"
+)
+
+// GetChargerSecurity fetches the security configuration of a charger, or nil if none is set
+func GetChargerSecurity(ctx context.Context, chargerID string) (*models.ChargerSecurity, error) {
+	sec := new(models.ChargerSecurity)
+	err := DB.NewSelect().Model(sec).Where("charger_id = ?", chargerID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch charger security: %w", err)
+	}
+	return sec, nil
+}
+
+// SaveChargerSecurity creates or replaces the security configuration of a charger
+func SaveChargerSecurity(ctx context.Context, sec *models.ChargerSecurity) error {
+	_, err := DB.NewInsert().
+		Model(sec).
+		On("CONFLICT (charger_id) DO UPDATE").
+		Set("security_profile = EXCLUDED.security_profile").
+		Set("password_hash = EXCLUDED.password_hash").
+		Set("certificate_fingerprint = EXCLUDED.certificate_fingerprint").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save charger security: %w", err)
+	}
+	return nil
+}
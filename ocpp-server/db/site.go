@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ocpp-server/models"
+)
+
+// ErrSiteNotFound is returned when no site has the requested ID
+var ErrSiteNotFound = errors.New("site not found")
+
+// ListSites returns every load-management site
+func ListSites(ctx context.Context) ([]models.Site, error) {
+	sites := []models.Site{}
+	if err := DB.NewSelect().Model(&sites).Order("id ASC").Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list sites: %w", err)
+	}
+	return sites, nil
+}
+
+// GetSite fetches a site by ID
+func GetSite(ctx context.Context, id int64) (*models.Site, error) {
+	site := new(models.Site)
+	err := DB.NewSelect().Model(site).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSiteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch site: %w", err)
+	}
+	return site, nil
+}
+
+// CreateSite inserts a site
+func CreateSite(ctx context.Context, site *models.Site) error {
+	if _, err := DB.NewInsert().Model(site).Returning("*").Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create site: %w", err)
+	}
+	return nil
+}
+
+// UpdateSite overwrites the settings of a site
+func UpdateSite(ctx context.Context, site *models.Site) error {
+	// A Set clause would replace the columns listed instead of adding to them
+	site.UpdatedAt = time.Now()
+	res, err := DB.NewUpdate().
+		Model(site).
+		Column("name", "unit", "max_limit", "min_limit", "max_per_connector", "strategy", "charger_ids", "updated_at").
+		WherePK().
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update site: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSiteNotFound
+	}
+	return nil
+}
+
+// DeleteSite removes a site
+func DeleteSite(ctx context.Context, id int64) error {
+	res, err := DB.NewDelete().Model((*models.Site)(nil)).Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete site: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSiteNotFound
+	}
+	return nil
+}
+
+// GetUserRole returns the role of a user_service user
+func GetUserRole(ctx context.Context, userID int64) (string, error) {
+	var role string
+	err := DB.NewSelect().
+		Table("users").
+		Column("role").
+		Where("id = ?", userID).
+		Scan(ctx, &role)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch user role: %w", err)
+	}
+	return role, nil
+}
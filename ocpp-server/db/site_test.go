@@ -0,0 +1,26 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ocpp-server/models"
+)
+
+func TestUpdateSiteWritesSettings(t *testing.T) {
+	queries := recordQueries(t)
+
+	site := &models.Site{ID: 1, Name: "depot", Unit: "A", MaxLimit: 63, Strategy: "equal-share"}
+	UpdateSite(context.Background(), site)
+
+	if len(*queries) != 1 {
+		t.Fatalf("got queries %q, want one UPDATE", *queries)
+	}
+	query := (*queries)[0]
+	for _, column := range []string{`"name" = 'depot'`, `"max_limit" = 63`, `"charger_ids" = `, `"updated_at" = `} {
+		if !strings.Contains(query, column) {
+			t.Errorf("UPDATE does not set %s: %s", column, query)
+		}
+	}
+}
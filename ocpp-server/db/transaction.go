@@ -0,0 +1,335 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ocpp-server/models"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrTransactionNotFound is returned when no transaction matches the lookup
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// CreateTransaction inserts a new transaction; its ID is assigned by the database sequence
+func CreateTransaction(ctx context.Context, tx *models.Transaction) error {
+	_, err := DB.NewInsert().
+		Model(tx).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+	return nil
+}
+
+// StopTransaction closes an active transaction of a charger with the values reported in StopTransaction
+func StopTransaction(ctx context.Context, chargerID string, id int64, meterStop int, stoppedAt time.Time, idTag, reason string) (*models.Transaction, error) {
+	tx := new(models.Transaction)
+	res, err := DB.NewUpdate().
+		Model(tx).
+		Set("meter_stop = ?", meterStop).
+		Set("stopped_at = ?", stoppedAt).
+		Set("stop_id_tag = ?", idTag).
+		Set("stop_reason = ?", reason).
+		Set("status = ?", models.TransactionStatusCompleted).
+		Set("updated_at = current_timestamp").
+		Where("id = ?", id).
+		Where("charger_id = ?", chargerID).
+		Where("status = ?", models.TransactionStatusActive).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stop transaction: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrTransactionNotFound
+	}
+	return tx, nil
+}
+
+// GetTransaction fetches a transaction of a charger by ID, whatever its status
+func GetTransaction(ctx context.Context, chargerID string, id int64) (*models.Transaction, error) {
+	tx := new(models.Transaction)
+	err := DB.NewSelect().
+		Model(tx).
+		Where("id = ?", id).
+		Where("charger_id = ?", chargerID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// FindStartedTransaction returns the transaction a StartTransaction with these
+// values already created, so that a replayed StartTransaction creates no other
+func FindStartedTransaction(ctx context.Context, chargerID string, connectorID int, idTag string, meterStart int, startedAt time.Time) (*models.Transaction, error) {
+	tx := new(models.Transaction)
+	err := DB.NewSelect().
+		Model(tx).
+		Where("charger_id = ?", chargerID).
+		Where("connector_id = ?", connectorID).
+		Where("id_tag = ?", idTag).
+		Where("meter_start = ?", meterStart).
+		Where("started_at = ?", startedAt).
+		Where("ocpp_transaction_id IS NULL").
+		Order("id ASC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// GetActiveTransaction returns the most recent transaction still running on a charger
+func GetActiveTransaction(ctx context.Context, chargerID string) (*models.Transaction, error) {
+	tx := new(models.Transaction)
+	err := DB.NewSelect().
+		Model(tx).
+		Where("charger_id = ?", chargerID).
+		Where("status = ?", models.TransactionStatusActive).
+		Order("started_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch active transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// ListActiveTransactions returns every transaction still running
+func ListActiveTransactions(ctx context.Context) ([]models.Transaction, error) {
+	txs := []models.Transaction{}
+	err := DB.NewSelect().
+		Model(&txs).
+		Where("status = ?", models.TransactionStatusActive).
+		Order("started_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active transactions: %w", err)
+	}
+	return txs, nil
+}
+
+// ListChargerActiveTransactions returns the transactions still running on a charger
+func ListChargerActiveTransactions(ctx context.Context, chargerID string) ([]models.Transaction, error) {
+	txs := []models.Transaction{}
+	err := DB.NewSelect().
+		Model(&txs).
+		Where("charger_id = ?", chargerID).
+		Where("status = ?", models.TransactionStatusActive).
+		Order("started_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active transactions: %w", err)
+	}
+	return txs, nil
+}
+
+// AddTransactionReconciliation appends a note on how a StopTransaction that did
+// not match the recorded transaction was resolved
+func AddTransactionReconciliation(ctx context.Context, id int64, note string) error {
+	_, err := DB.NewUpdate().
+		Model((*models.Transaction)(nil)).
+		Set("reconciliation = concat_ws('; ', NULLIF(reconciliation, ''), ?)", note).
+		Set("updated_at = current_timestamp").
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+	return nil
+}
+
+// InsertMeterValues stores sampled meter values
+func InsertMeterValues(ctx context.Context, values []models.MeterValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := DB.NewInsert().
+		Model(&values).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert meter values: %w", err)
+	}
+	return nil
+}
+
+// MeterValueFilter selects the meter values of a transaction or of a connector.
+// Empty fields match everything.
+type MeterValueFilter struct {
+	TransactionID *int64
+	ChargerID     string
+	ConnectorID   *int
+	Measurand     string
+	Phase         string
+	From          *time.Time
+	To            *time.Time
+}
+
+func (f MeterValueFilter) apply(q *bun.SelectQuery) *bun.SelectQuery {
+	if f.TransactionID != nil {
+		q = q.Where("transaction_id = ?", *f.TransactionID)
+	}
+	if f.ChargerID != "" {
+		q = q.Where("charger_id = ?", f.ChargerID)
+	}
+	if f.ConnectorID != nil {
+		q = q.Where("connector_id = ?", *f.ConnectorID)
+	}
+	if f.Measurand != "" {
+		q = q.Where("measurand = ?", f.Measurand)
+	}
+	if f.Phase != "" {
+		q = q.Where("phase = ?", f.Phase)
+	}
+	if f.From != nil {
+		q = q.Where("timestamp >= ?", *f.From)
+	}
+	if f.To != nil {
+		q = q.Where("timestamp < ?", *f.To)
+	}
+	return q
+}
+
+// ListMeterValues returns the meter values matching filter, oldest first
+func ListMeterValues(ctx context.Context, filter MeterValueFilter) ([]models.MeterValue, error) {
+	values := []models.MeterValue{}
+	err := filter.apply(DB.NewSelect().Model(&values)).
+		Order("timestamp ASC", "id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list meter values: %w", err)
+	}
+	return values, nil
+}
+
+// LatestMeterValues returns the most recent value of every measurand, phase and
+// location among the meter values matching filter
+func LatestMeterValues(ctx context.Context, filter MeterValueFilter) ([]models.MeterValue, error) {
+	values := []models.MeterValue{}
+	err := filter.apply(DB.NewSelect().Model(&values)).
+		DistinctOn("measurand, phase, location").
+		Order("measurand", "phase", "location", "timestamp DESC", "id DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch latest meter values: %w", err)
+	}
+	return values, nil
+}
+
+// GetTransactionByOCPPID fetches the transaction an OCPP 2.0.1 charger identifies
+// by its own transactionId
+func GetTransactionByOCPPID(ctx context.Context, chargerID, ocppID string) (*models.Transaction, error) {
+	tx := new(models.Transaction)
+	err := DB.NewSelect().
+		Model(tx).
+		Where("charger_id = ?", chargerID).
+		Where("ocpp_transaction_id = ?", ocppID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// SetTransactionIdTag records the idTag of a transaction that started before its
+// user was identified, as OCPP 2.0.1 allows
+func SetTransactionIdTag(ctx context.Context, id int64, idTag string, userID *int64) error {
+	_, err := DB.NewUpdate().
+		Model((*models.Transaction)(nil)).
+		Set("id_tag = ?", idTag).
+		Set("user_id = ?", userID).
+		Set("updated_at = current_timestamp").
+		Where("id = ?", id).
+		Where("id_tag = ''").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+	return nil
+}
+
+// LatestMeterValue returns the most recent value of a measurand recorded for a
+// transaction, or nil if there is none
+func LatestMeterValue(ctx context.Context, transactionID int64, measurand string) (*models.MeterValue, error) {
+	value := new(models.MeterValue)
+	err := DB.NewSelect().
+		Model(value).
+		Where("transaction_id = ?", transactionID).
+		Where("measurand = ?", measurand).
+		Order("timestamp DESC", "id DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch meter value: %w", err)
+	}
+	return value, nil
+}
+
+// ErrMessageNotProcessed is returned when a charger has not sent a message before
+var ErrMessageNotProcessed = errors.New("message not processed")
+
+// GetProcessedMessage fetches the answer given to a message of a charger by digest
+func GetProcessedMessage(ctx context.Context, chargerID, digest string) (*models.ProcessedMessage, error) {
+	msg := new(models.ProcessedMessage)
+	err := DB.NewSelect().
+		Model(msg).
+		Where("charger_id = ?", chargerID).
+		Where("digest = ?", digest).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotProcessed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch processed message: %w", err)
+	}
+	return msg, nil
+}
+
+// SaveProcessedMessage records the answer given to a message; the first answer is kept
+func SaveProcessedMessage(ctx context.Context, msg *models.ProcessedMessage) error {
+	_, err := DB.NewInsert().
+		Model(msg).
+		On("CONFLICT (charger_id, digest) DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save processed message: %w", err)
+	}
+	return nil
+}
+
+// DeleteProcessedMessages forgets the messages processed before a point in time
+// and returns how many were deleted
+func DeleteProcessedMessages(ctx context.Context, before time.Time) (int64, error) {
+	res, err := DB.NewDelete().
+		Model((*models.ProcessedMessage)(nil)).
+		Where("created_at < ?", before).
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the server's event bus
+const (
+	EventChargerOnline      = "charger.online"
+	EventChargerOffline     = "charger.offline"
+	EventConnectorStatus    = "connector.status"
+	EventTransactionStarted = "transaction.started"
+	EventTransactionStopped = "transaction.stopped"
+	EventMeterValues        = "meter.values"
+)
+
+const (
+	// eventStreamBuffer is how many events a dashboard stream may fall behind
+	// before it loses some
+	eventStreamBuffer = 64
+
+	// eventStreamKeepAlive is how often an idle stream sends a comment, so that
+	// proxies do not close it
+	eventStreamKeepAlive = 25 * time.Second
+)
+
+// Event is a notable change in the charger network
+type Event struct {
+	Type      string      `json:"type"`
+	ChargerID string      `json:"charger_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// eventBus fans events out to in-process subscribers. Publishing never blocks:
+// a subscriber that does not keep up loses events.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// publish delivers an event to every subscriber
+func (b *eventBus) publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	log.Printf("Event %s for %s", event.Type, event.ChargerID)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropped event %s for a slow subscriber", event.Type)
+		}
+	}
+}
+
+// subscribe registers a new subscriber; the returned function unsubscribes it
+func (b *eventBus) subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// handleEventStream streams the events of the charger network to the dashboard as
+// server-sent events, optionally only those of the chargers listed in charger_id.
+// EventSource cannot set headers, so the access token may also be passed in the
+// access_token query parameter.
+func (s *OCPPServer) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticatedUser(r)
+	if err != nil {
+		if token := r.URL.Query().Get("access_token"); token != "" {
+			userID, err = parseAccessToken(token)
+		}
+	}
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chargers := make(map[string]bool)
+	for _, value := range r.URL.Query()["charger_id"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				chargers[id] = true
+			}
+		}
+	}
+
+	events, unsubscribe := s.events.subscribe(eventStreamBuffer)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	if err := rc.Flush(); err != nil {
+		log.Printf("Event stream of user %d cannot be flushed: %v", userID, err)
+		return
+	}
+	log.Printf("User %d subscribed to events (%d charger filter(s))", userID, len(chargers))
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("User %d unsubscribed from events", userID)
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if len(chargers) > 0 && !chargers[event.ChargerID] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode event %s: %v", event.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxFirmwareSize    = 1 << 30
+	maxDiagnosticsSize = 256 << 20
+)
+
+// Event types of the Firmware Management profile
+const (
+	EventFirmwareStatus    = "firmware.status"
+	EventDiagnosticsStatus = "diagnostics.status"
+)
+
+// fileStore is the embedded file server: firmware images served to chargers and
+// diagnostics uploaded by them, under Dir/firmware and Dir/diagnostics
+type fileStore struct {
+	Dir     string
+	BaseURL string // URL chargers reach the server at, e.g. http://cs.example.com:9000
+}
+
+// loadFileStore reads OCPP_FILES_DIR (default ./files) and OCPP_FILES_BASE_URL
+// (default http://localhost:9000) and creates the directories
+func loadFileStore() (*fileStore, error) {
+	store := &fileStore{
+		Dir:     os.Getenv("OCPP_FILES_DIR"),
+		BaseURL: strings.TrimRight(os.Getenv("OCPP_FILES_BASE_URL"), "/"),
+	}
+	if store.Dir == "" {
+		store.Dir = "files"
+	}
+	if store.BaseURL == "" {
+		store.BaseURL = "http://localhost:9000"
+	}
+	for _, sub := range []string{"firmware", "diagnostics"} {
+		if err := os.MkdirAll(filepath.Join(store.Dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create %s directory: %w", sub, err)
+		}
+	}
+	return store, nil
+}
+
+// firmwarePath returns the path of a firmware image, rejecting names that would escape the directory
+func (fs *fileStore) firmwarePath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid firmware name %q", name)
+	}
+	return filepath.Join(fs.Dir, "firmware", name), nil
+}
+
+// firmwareURL is the location sent to chargers in UpdateFirmware
+func (fs *fileStore) firmwareURL(name string) string {
+	return fs.BaseURL + "/files/firmware/" + url.PathEscape(name)
+}
+
+// diagnosticsURL is the location sent to chargers in GetDiagnostics
+func (fs *fileStore) diagnosticsURL(jobID int64, token string) string {
+	return fs.BaseURL + "/files/diagnostics/" + strconv.FormatInt(jobID, 10) + "/" + token
+}
+
+// newUploadToken returns a random token authorizing the upload of a single job
+func newUploadToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// diagnosticsPath is where the upload of a diagnostics job is stored
+func (fs *fileStore) diagnosticsPath(jobID int64) string {
+	return filepath.Join(fs.Dir, "diagnostics", strconv.FormatInt(jobID, 10))
+}
+
+// writeFile stores body at path through a temporary file, so that a partial
+// upload never replaces a complete one
+func writeFile(path string, body io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
+
+// handleFirmwareFile serves a firmware image to chargers
+func (s *OCPPServer) handleFirmwareFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path, err := s.files.firmwarePath(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("Serving firmware %s to %s", filepath.Base(path), r.RemoteAddr)
+	http.ServeFile(w, r, path)
+}
+
+// handleDiagnosticsUpload receives the diagnostics file of a job, either as the raw
+// request body or as the first file of a multipart form. Only the location sent in
+// GetDiagnostics is accepted, and only while the job runs.
+func (s *OCPPServer) handleDiagnosticsUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("job"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusNotFound)
+		return
+	}
+	job, err := db.GetJob(r.Context(), id)
+	if err != nil || job.Type != models.JobTypeDiagnostics || job.UploadToken == "" ||
+		subtle.ConstantTimeCompare([]byte(r.PathValue("token")), []byte(job.UploadToken)) != 1 {
+		http.Error(w, "Unknown diagnostics job", http.StatusNotFound)
+		return
+	}
+	if job.Result != "" {
+		http.Error(w, "Diagnostics job is not in progress", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDiagnosticsSize)
+	body := io.Reader(r.Body)
+	fileName := job.FileName
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		part, err := reader.NextPart()
+		if err != nil {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		defer part.Close()
+		body = part
+		if part.FileName() != "" {
+			fileName = filepath.Base(part.FileName())
+		}
+	}
+
+	size, err := writeFile(s.files.diagnosticsPath(job.ID), body)
+	if err != nil {
+		log.Printf("Diagnostics upload of job %d failed: %v", job.ID, err)
+		http.Error(w, "upload failed", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Received %d bytes of diagnostics from %s (job %d)", size, job.ChargerID, job.ID)
+
+	job.FileName = fileName
+	job.FileSize = size
+	if err := db.UpdateJob(r.Context(), job); err != nil {
+		log.Printf("DB update error for job %d: %v", job.ID, err)
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleFirmwareImages lists (GET) the firmware images available to chargers
+func (s *OCPPServer) handleFirmwareImages(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.files.Dir, "firmware"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type image struct {
+		Name       string    `json:"name"`
+		Size       int64     `json:"size"`
+		UploadedAt time.Time `json:"uploaded_at"`
+		Location   string    `json:"location"`
+	}
+	images := []image{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		images = append(images, image{
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			UploadedAt: info.ModTime(),
+			Location:   s.files.firmwareURL(entry.Name()),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"firmware": images,
+	})
+}
+
+// handleFirmwareImage stores (PUT, raw body) or deletes (DELETE) a firmware image
+func (s *OCPPServer) handleFirmwareImage(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	path, err := s.files.firmwarePath(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		r.Body = http.MaxBytesReader(w, r.Body, maxFirmwareSize)
+		size, err := writeFile(path, r.Body)
+		if err != nil {
+			http.Error(w, "upload failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Stored firmware %s (%d bytes)", filepath.Base(path), size)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":     filepath.Base(path),
+			"size":     size,
+			"location": s.files.firmwareURL(filepath.Base(path)),
+		})
+
+	case http.MethodDelete:
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "Unknown firmware", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// firmwareUpdate is the body of the firmware endpoints. Firmware names an image
+// hosted by the server; Location points anywhere else instead.
+type firmwareUpdate struct {
+	Firmware      string           `json:"firmware,omitempty"`
+	Location      string           `json:"location,omitempty"`
+	RetrieveDate  *ocpp16.DateTime `json:"retrieveDate,omitempty"`
+	Retries       *int             `json:"retries,omitempty"`
+	RetryInterval *int             `json:"retryInterval,omitempty"`
+	ChargerIDs    []string         `json:"chargerIds,omitempty"`
+}
+
+// request builds the UpdateFirmware request, retrieving the firmware right away by default
+func (u *firmwareUpdate) request(files *fileStore) (*ocpp16.UpdateFirmwareRequest, error) {
+	req := &ocpp16.UpdateFirmwareRequest{
+		Location:      u.Location,
+		Retries:       u.Retries,
+		RetryInterval: u.RetryInterval,
+		RetrieveDate:  ocpp16.DateTime{Time: time.Now()},
+	}
+	if u.RetrieveDate != nil {
+		req.RetrieveDate = *u.RetrieveDate
+	}
+
+	switch {
+	case u.Firmware != "" && u.Location != "":
+		return nil, errors.New("firmware and location are exclusive")
+	case u.Firmware != "":
+		path, err := files.firmwarePath(u.Firmware)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("unknown firmware %q", u.Firmware)
+		}
+		req.Location = files.firmwareURL(u.Firmware)
+	case u.Location == "":
+		return nil, errors.New("firmware or location is required")
+	}
+	return req, nil
+}
+
+// updateFirmware records a firmware job and sends UpdateFirmware to the charger
+func (s *OCPPServer) updateFirmware(ctx context.Context, chargerID, rolloutID, firmware string, req *ocpp16.UpdateFirmwareRequest) (*models.ChargerJob, error) {
+	job := &models.ChargerJob{
+		ChargerID: chargerID,
+		Type:      models.JobTypeFirmware,
+		RolloutID: rolloutID,
+		Location:  req.Location,
+		Firmware:  firmware,
+		Status:    models.JobStatusRequested,
+	}
+	if err := db.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	_, err := s.SendRemoteCommand(ctx, chargerID, req)
+	s.finishJobRequest(ctx, job, err)
+	return job, err
+}
+
+// finishJobRequest records whether the charger accepted the request of a job
+func (s *OCPPServer) finishJobRequest(ctx context.Context, job *models.ChargerJob, err error) {
+	if err != nil {
+		now := time.Now()
+		job.Status = models.JobStatusRejected
+		job.Result = models.JobResultFailed
+		job.Error = err.Error()
+		job.CompletedAt = &now
+	} else {
+		job.Status = models.JobStatusAccepted
+	}
+	if err := db.UpdateJob(ctx, job); err != nil {
+		log.Printf("DB update error for job %d: %v", job.ID, err)
+	}
+}
+
+// decodeFirmwareUpdate reads and validates the body of a firmware endpoint
+func (s *OCPPServer) decodeFirmwareUpdate(w http.ResponseWriter, r *http.Request) (*firmwareUpdate, *ocpp16.UpdateFirmwareRequest, bool) {
+	update := new(firmwareUpdate)
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(update); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	req, err := update.request(s.files)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return update, req, true
+}
+
+// handleUpdateFirmware sends UpdateFirmware to one charger
+func (s *OCPPServer) handleUpdateFirmware(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	update, req, ok := s.decodeFirmwareUpdate(w, r)
+	if !ok {
+		return
+	}
+	job, err := s.updateFirmware(r.Context(), r.PathValue("id"), "", update.Firmware, req)
+	if job == nil || err != nil {
+		writeCommandResponse(w, req.Action(), nil, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleFirmwareRollout sends UpdateFirmware to a fleet of chargers. Every charger
+// gets its own job under a shared rollout_id; chargers that cannot be reached are
+// recorded as failed rather than failing the rollout. Only operators may start one.
+func (s *OCPPServer) handleFirmwareRollout(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	update, req, ok := s.decodeFirmwareUpdate(w, r)
+	if !ok {
+		return
+	}
+	if len(update.ChargerIDs) == 0 {
+		http.Error(w, "chargerIds is required", http.StatusBadRequest)
+		return
+	}
+
+	rolloutID := uuid.New().String()
+	jobs := make([]*models.ChargerJob, len(update.ChargerIDs))
+	var wg sync.WaitGroup
+	for i, chargerID := range update.ChargerIDs {
+		wg.Add(1)
+		go func(i int, chargerID string) {
+			defer wg.Done()
+			job, err := s.updateFirmware(context.Background(), chargerID, rolloutID, update.Firmware, req)
+			if err != nil {
+				log.Printf("Firmware rollout %s: %s failed: %v", rolloutID, chargerID, err)
+			}
+			jobs[i] = job
+		}(i, chargerID)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rollout_id": rolloutID,
+		"jobs":       jobs,
+	})
+}
+
+// handleGetDiagnostics asks a charger to upload its diagnostics to the embedded file endpoint
+func (s *OCPPServer) handleGetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	req := new(ocpp16.GetDiagnosticsRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chargerID := r.PathValue("id")
+	job := &models.ChargerJob{
+		ChargerID: chargerID,
+		Type:      models.JobTypeDiagnostics,
+		Status:    models.JobStatusRequested,
+	}
+	if err := db.CreateJob(r.Context(), job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The location is only known once the job has its ID
+	if req.Location == "" {
+		token, err := newUploadToken()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		job.UploadToken = token
+		req.Location = s.files.diagnosticsURL(job.ID, token)
+	}
+	job.Location = req.Location
+	if err := db.UpdateJob(r.Context(), job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := s.SendRemoteCommand(r.Context(), chargerID, req)
+	if err == nil {
+		job.FileName = response.(*ocpp16.GetDiagnosticsConfirmation).FileName
+	}
+	s.finishJobRequest(r.Context(), job, err)
+	if err != nil {
+		writeCommandResponse(w, req.Action(), nil, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleJobs lists firmware and diagnostics jobs, filtered by charger_id, type,
+// rollout_id, status and result (success or failed)
+func (s *OCPPServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := db.JobFilter{
+		ChargerID: query.Get("charger_id"),
+		Type:      query.Get("type"),
+		RolloutID: query.Get("rollout_id"),
+		Status:    query.Get("status"),
+		Result:    query.Get("result"),
+	}
+	if id := r.PathValue("id"); id != "" {
+		filter.ChargerID = id
+	}
+	jobs, err := db.ListJobs(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": jobs,
+	})
+}
+
+// handleJobFile downloads the diagnostics uploaded for a job
+func (s *OCPPServer) handleJobFile(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, err := db.GetJob(r.Context(), id)
+	if errors.Is(err, db.ErrJobNotFound) || (err == nil && job.FileSize == 0) {
+		http.Error(w, "No file for this job", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := job.FileName
+	if name == "" {
+		name = fmt.Sprintf("diagnostics-%d", job.ID)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, s.files.diagnosticsPath(job.ID))
+}
+
+// handleFirmwareStatusNotification records the progress of the charger's running firmware job
+func (s *OCPPServer) handleFirmwareStatusNotification(chargerID string, req *ocpp16.FirmwareStatusNotificationRequest) *ocpp16.FirmwareStatusNotificationConfirmation {
+	log.Printf("Firmware status from %s: %s", chargerID, req.Status)
+
+	var result string
+	switch req.Status {
+	case ocpp16.FirmwareStatusInstalled:
+		result = models.JobResultSuccess
+	case ocpp16.FirmwareStatusDownloadFailed, ocpp16.FirmwareStatusInstallationFailed:
+		result = models.JobResultFailed
+	case ocpp16.FirmwareStatusIdle:
+		// Only sent in answer to a TriggerMessage; says nothing about a job
+		return &ocpp16.FirmwareStatusNotificationConfirmation{}
+	}
+	s.updateRunningJob(chargerID, models.JobTypeFirmware, string(req.Status), result)
+	s.events.publish(Event{Type: EventFirmwareStatus, ChargerID: chargerID, Data: map[string]interface{}{"status": req.Status}})
+	return &ocpp16.FirmwareStatusNotificationConfirmation{}
+}
+
+// handleDiagnosticsStatusNotification records the progress of the charger's running diagnostics job
+func (s *OCPPServer) handleDiagnosticsStatusNotification(chargerID string, req *ocpp16.DiagnosticsStatusNotificationRequest) *ocpp16.DiagnosticsStatusNotificationConfirmation {
+	log.Printf("Diagnostics status from %s: %s", chargerID, req.Status)
+
+	var result string
+	switch req.Status {
+	case ocpp16.DiagnosticsStatusUploaded:
+		result = models.JobResultSuccess
+	case ocpp16.DiagnosticsStatusUploadFailed:
+		result = models.JobResultFailed
+	case ocpp16.DiagnosticsStatusIdle:
+		return &ocpp16.DiagnosticsStatusNotificationConfirmation{}
+	}
+	s.updateRunningJob(chargerID, models.JobTypeDiagnostics, string(req.Status), result)
+	s.events.publish(Event{Type: EventDiagnosticsStatus, ChargerID: chargerID, Data: map[string]interface{}{"status": req.Status}})
+	return &ocpp16.DiagnosticsStatusNotificationConfirmation{}
+}
+
+// updateRunningJob applies a status notification to the latest unfinished job of a charger
+func (s *OCPPServer) updateRunningJob(chargerID, jobType, status, result string) {
+	ctx := context.Background()
+	job, err := db.GetRunningJob(ctx, chargerID, jobType)
+	if err != nil {
+		log.Printf("DB error for charger %s: %v", chargerID, err)
+		return
+	}
+	if job == nil {
+		log.Printf("%s status %s from %s without a running job", jobType, status, chargerID)
+		return
+	}
+
+	job.Status = status
+	job.Result = result
+	if result != "" {
+		now := time.Now()
+		job.CompletedAt = &now
+	}
+	if err := db.UpdateJob(ctx, job); err != nil {
+		log.Printf("DB update error for job %d: %v", job.ID, err)
+	}
+}
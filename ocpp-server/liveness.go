@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	defaultPingInterval  = 30 * time.Second
+	defaultSweepInterval = 30 * time.Second
+
+	// missedHeartbeats is how many heartbeat intervals a charger may stay silent
+	missedHeartbeats = 2
+
+	// chargerStatusOffline is the charging_point status of a charger that went silent
+	chargerStatusOffline = "Offline"
+)
+
+// livenessConfig controls how dead connections are detected, read from the environment
+type livenessConfig struct {
+	PingInterval  time.Duration // WebSocket ping period, 0 disables pings
+	SweepInterval time.Duration // how often silent chargers are looked for
+}
+
+// loadLivenessConfig reads OCPP_PING_INTERVAL and OCPP_SWEEP_INTERVAL (Go durations, e.g. 30s)
+func loadLivenessConfig() (livenessConfig, error) {
+	cfg := livenessConfig{
+		PingInterval:  defaultPingInterval,
+		SweepInterval: defaultSweepInterval,
+	}
+	if v := os.Getenv("OCPP_PING_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid OCPP_PING_INTERVAL %q", v)
+		}
+		cfg.PingInterval = d
+	}
+	if v := os.Getenv("OCPP_SWEEP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid OCPP_SWEEP_INTERVAL %q", v)
+		}
+		cfg.SweepInterval = d
+	}
+	return cfg, nil
+}
+
+// silenceTimeout is how long a charger may go without sending an OCPP message
+func (c *Charger) silenceTimeout() time.Duration {
+	return missedHeartbeats * c.HeartbeatInterval()
+}
+
+// extendReadDeadline pushes the read deadline of the socket out by one silence
+// timeout; it runs on every frame and every pong
+func (c *Charger) extendReadDeadline() {
+	c.Connection.SetReadDeadline(time.Now().Add(c.silenceTimeout()))
+}
+
+// sweepSilentChargers periodically disconnects chargers that stopped sending OCPP
+// messages even though their socket may still answer pings
+func (s *OCPPServer) sweepSilentChargers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mutex.RLock()
+			var silent []*Charger
+			for _, charger := range s.chargers {
+				if now.Sub(charger.LastSeen()) > charger.silenceTimeout() {
+					silent = append(silent, charger)
+				}
+			}
+			s.mutex.RUnlock()
+
+			for _, charger := range silent {
+				log.Printf("Charger %s silent since %s, closing connection", charger.ID, charger.LastSeen().Format(time.RFC3339))
+				charger.closeWithReason("heartbeat timeout")
+			}
+			s.sweepSOAPChargers(now)
+		}
+	}
+}
+
+// markOffline records that a charger went away and publishes an EventChargerOffline
+func (s *OCPPServer) markOffline(charger *Charger) {
+	if err := updateChargerStatus(charger.ID, chargerStatusOffline); err != nil {
+		log.Printf("DB update error for charger %s: %v", charger.ID, err)
+	}
+
+	s.events.publish(Event{
+		Type:      EventChargerOffline,
+		ChargerID: charger.ID,
+		Data: map[string]interface{}{
+			"reason":    charger.closeReason(),
+			"last_seen": charger.LastSeen(),
+		},
+	})
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	db "ocpp-server/db"
+	"ocpp-server/loadmgmt"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+)
+
+const (
+	// loadProfileIDBase + connectorId is the chargingProfileId of the TxProfile
+	// carrying the load-management limit of a connector
+	loadProfileIDBase = 1000000
+
+	// loadProfileStackLevel keeps load-management TxProfiles above manually set ones
+	loadProfileStackLevel = 50
+)
+
+// rolePriority maps user_service roles onto load-management priorities
+var rolePriority = map[string]int{
+	"admin":    2,
+	"operator": 1,
+	"user":     0,
+}
+
+// ApplyLimit implements loadmgmt.Limiter with a TxProfile holding a single period.
+// OCPP 2.0.1 charging profiles are not implemented, so sessions on 2.0.1 stations
+// are reported as not controllable and their draw is kept out of the budget.
+func (s *OCPPServer) ApplyLimit(ctx context.Context, session loadmgmt.Session, limit float64, unit string) error {
+	if charger := s.getCharger(session.ChargerID); charger != nil && charger.Protocol == ocpp201.Subprotocol {
+		return fmt.Errorf("%s speaks OCPP 2.0.1: %w", session.ChargerID, loadmgmt.ErrNotControllable)
+	}
+
+	transactionID := session.TransactionID
+	req := &ocpp16.SetChargingProfileRequest{
+		ConnectorId: session.ConnectorID,
+		CsChargingProfiles: ocpp16.ChargingProfile{
+			ChargingProfileId:      loadProfileIDBase + session.ConnectorID,
+			TransactionId:          &transactionID,
+			StackLevel:             loadProfileStackLevel,
+			ChargingProfilePurpose: ocpp16.TxProfile,
+			ChargingProfileKind:    ocpp16.ChargingProfileKindRelative,
+			ChargingSchedule: ocpp16.ChargingSchedule{
+				ChargingRateUnit: ocpp16.ChargingRateUnit(unit),
+				ChargingSchedulePeriod: []ocpp16.ChargingSchedulePeriod{
+					{StartPeriod: 0, Limit: limit},
+				},
+			},
+		},
+	}
+
+	conf, _, err := s.setChargingProfile(ctx, session.ChargerID, req)
+	if err != nil {
+		return err
+	}
+	if conf.Status != ocpp16.ChargingProfileStatusAccepted {
+		return fmt.Errorf("SetChargingProfile %s", conf.Status)
+	}
+	log.Printf("Load management: %s connector %d limited to %.1f %s", session.ChargerID, session.ConnectorID, limit, unit)
+	return nil
+}
+
+// userPriority returns the load-management priority of a transaction's user
+func userPriority(ctx context.Context, userID *int64) int {
+	if userID == nil {
+		return 0
+	}
+	role, err := db.GetUserRole(ctx, *userID)
+	if err != nil {
+		log.Printf("Role lookup failed for user %d: %v", *userID, err)
+		return 0
+	}
+	return rolePriority[role]
+}
+
+// startLoadSession hands an accepted transaction over to load management. Sessions
+// of chargers outside any site are tracked too, in case the charger joins one.
+func (s *OCPPServer) startLoadSession(ctx context.Context, tx *models.Transaction) {
+	s.loadManager.SessionStarted(tx.ChargerID, tx.ConnectorID, int(tx.ID), userPriority(ctx, tx.UserID), tx.StartedAt)
+}
+
+// recordLoadMeterValues feeds the current and power of stored meter value rows to
+// load management: per reading, the highest phase current and the total power.
+// The site is rebalanced when a session draws close to its limit or leaves much
+// of it unused.
+func (s *OCPPServer) recordLoadMeterValues(chargerID string, connectorID int, values []models.MeterValue) {
+	rebalance := false
+	for start := 0; start < len(values); {
+		// The rows of one reading share its timestamp
+		end := start + 1
+		for end < len(values) && values[end].Timestamp.Equal(values[start].Timestamp) {
+			end++
+		}
+		reading := values[start:end]
+		start = end
+
+		var current, power, phasePower float64
+		var hasCurrent, hasPower, hasPhasePower bool
+		for _, row := range reading {
+			if row.SIValue == nil {
+				continue
+			}
+			value := *row.SIValue
+			switch ocpp16.Measurand(row.Measurand) {
+			case ocpp16.MeasurandCurrentImport:
+				if !hasCurrent || value > current {
+					current = value
+				}
+				hasCurrent = true
+			case ocpp16.MeasurandPowerActiveImport:
+				if row.Phase == "" {
+					power, hasPower = value, true
+				} else {
+					phasePower += value
+					hasPhasePower = true
+				}
+			}
+		}
+		if !hasPower && hasPhasePower {
+			power, hasPower = phasePower, true
+		}
+
+		at := reading[0].Timestamp
+		if hasCurrent && s.loadManager.MeterValue(chargerID, connectorID, string(ocpp16.MeasurandCurrentImport), current, "A", at) {
+			rebalance = true
+		}
+		if hasPower && s.loadManager.MeterValue(chargerID, connectorID, string(ocpp16.MeasurandPowerActiveImport), power, "W", at) {
+			rebalance = true
+		}
+	}
+	if rebalance {
+		s.rebalance(chargerID)
+	}
+}
+
+// rebalance recomputes the limits of a charger's site in the background
+func (s *OCPPServer) rebalance(chargerID string) {
+	go s.loadManager.RebalanceCharger(context.Background(), chargerID)
+}
+
+// reloadSites loads the site configuration into load management and rebalances every site
+func (s *OCPPServer) reloadSites(ctx context.Context) error {
+	sites, err := db.ListSites(ctx)
+	if err != nil {
+		return err
+	}
+
+	config := make([]loadmgmt.Site, 0, len(sites))
+	for _, site := range sites {
+		config = append(config, loadmgmt.Site{
+			ID:              site.ID,
+			Name:            site.Name,
+			Unit:            site.Unit,
+			MaxLimit:        site.MaxLimit,
+			MinLimit:        site.MinLimit,
+			MaxPerConnector: site.MaxPerConnector,
+			Strategy:        loadmgmt.Strategy(site.Strategy),
+			ChargerIDs:      site.ChargerIDs,
+		})
+	}
+	s.loadManager.SetSites(config)
+	go s.loadManager.RebalanceAll(context.Background())
+	return nil
+}
+
+// restoreLoadSessions registers the transactions that were running before a restart
+func (s *OCPPServer) restoreLoadSessions(ctx context.Context) error {
+	txs, err := db.ListActiveTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range txs {
+		s.startLoadSession(ctx, &txs[i])
+	}
+	return nil
+}
+
+// validateSite checks a site configuration sent to the API
+func validateSite(site *models.Site) error {
+	if site.Name == "" {
+		return errors.New("name is required")
+	}
+	if site.Unit != loadmgmt.UnitAmperes && site.Unit != loadmgmt.UnitWatts {
+		return errors.New("unit must be A or W")
+	}
+	if site.MaxLimit <= 0 {
+		return errors.New("max_limit must be positive")
+	}
+	if site.MinLimit < 0 || site.MinLimit > site.MaxLimit {
+		return errors.New("min_limit must be between 0 and max_limit")
+	}
+	if site.MaxPerConnector < 0 {
+		return errors.New("max_per_connector must not be negative")
+	}
+	switch loadmgmt.Strategy(site.Strategy) {
+	case "":
+		site.Strategy = string(loadmgmt.StrategyEqualShare)
+	case loadmgmt.StrategyEqualShare, loadmgmt.StrategyFirstCome, loadmgmt.StrategyPriority:
+	default:
+		return errors.New("strategy must be equal-share, first-come or priority")
+	}
+	if site.ChargerIDs == nil {
+		site.ChargerIDs = []string{}
+	}
+	return nil
+}
+
+// checkSiteChargers makes sure no charger of site already belongs to another site
+func checkSiteChargers(ctx context.Context, site *models.Site) error {
+	sites, err := db.ListSites(ctx)
+	if err != nil {
+		return err
+	}
+	for _, other := range sites {
+		if other.ID == site.ID {
+			continue
+		}
+		for _, a := range other.ChargerIDs {
+			for _, b := range site.ChargerIDs {
+				if a == b {
+					return fmt.Errorf("charger %s already belongs to site %d", a, other.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// errSiteConflict is returned when a charger would belong to two sites
+var errSiteConflict = errors.New("site conflict")
+
+// saveSite validates and stores a new (ID 0) or existing site, then reloads load management
+func (s *OCPPServer) saveSite(ctx context.Context, site *models.Site) error {
+	if err := validateSite(site); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidCommand, err)
+	}
+	if err := checkSiteChargers(ctx, site); err != nil {
+		return fmt.Errorf("%w: %v", errSiteConflict, err)
+	}
+
+	var err error
+	if site.ID == 0 {
+		err = db.CreateSite(ctx, site)
+	} else {
+		err = db.UpdateSite(ctx, site)
+	}
+	if err != nil {
+		return err
+	}
+	return s.reloadSites(ctx)
+}
+
+// writeSiteError maps a site error onto an HTTP status
+func writeSiteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidCommand):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errSiteConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, db.ErrSiteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleSites lists (GET) or creates (POST) load-management sites
+func (s *OCPPServer) handleSites(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sites, err := db.ListSites(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sites": sites,
+		})
+
+	case http.MethodPost:
+		site := new(models.Site)
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		if err := json.NewDecoder(r.Body).Decode(site); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		site.ID = 0
+		if err := s.saveSite(r.Context(), site); err != nil {
+			writeSiteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(site)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSite reads (GET), replaces (PUT) or deletes (DELETE) one site
+func (s *OCPPServer) handleSite(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		site, err := db.GetSite(r.Context(), id)
+		if err != nil {
+			writeSiteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(site)
+
+	case http.MethodPut:
+		site := new(models.Site)
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		if err := json.NewDecoder(r.Body).Decode(site); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		site.ID = id
+		if err := s.saveSite(r.Context(), site); err != nil {
+			writeSiteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(site)
+
+	case http.MethodDelete:
+		if err := db.DeleteSite(r.Context(), id); err != nil {
+			writeSiteError(w, err)
+			return
+		}
+		if err := s.reloadSites(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSiteStatus reports the budget, sessions and limits of a site as load management sees them
+func (s *OCPPServer) handleSiteStatus(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return
+	}
+	status, ok := s.loadManager.Status(id)
+	if !ok {
+		http.Error(w, "Unknown site", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,263 @@
+// Package loadmgmt shares the grid connection of a site between the charging
+// sessions running on its chargers.
+//
+// The package knows nothing about OCPP or the database: the server feeds it
+// session and meter events and applies the resulting limits through a Limiter.
+// Time comes from a Clock, so the whole subsystem can be driven by simulated
+// chargers and a fake clock.
+package loadmgmt
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Strategy decides how a site budget is shared between sessions
+type Strategy string
+
+const (
+	// StrategyEqualShare gives every session the same limit
+	StrategyEqualShare Strategy = "equal-share"
+	// StrategyFirstCome serves sessions in the order they started
+	StrategyFirstCome Strategy = "first-come"
+	// StrategyPriority serves sessions by the priority of their user's role,
+	// sharing equally between sessions of the same priority
+	StrategyPriority Strategy = "priority"
+)
+
+// Units of a site budget, matching the OCPP chargingRateUnit
+const (
+	UnitAmperes = "A"
+	UnitWatts   = "W"
+)
+
+const (
+	// MeasurementMaxAge is how long a measurement describes what a session draws
+	MeasurementMaxAge = 5 * time.Minute
+
+	// demandMargin is the room left above a session's measured draw so that it can
+	// ramp up before the next rebalance
+	demandMargin = 1.2
+)
+
+// Clock tells the time; tests substitute a fake one
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// Site is a group of chargers sharing a grid connection
+type Site struct {
+	ID              int64
+	Name            string
+	Unit            string  // UnitAmperes or UnitWatts
+	MaxLimit        float64 // budget of the whole site
+	MinLimit        float64 // smallest limit worth giving a session, e.g. 6 A
+	MaxPerConnector float64 // 0 for no connector cap
+	Strategy        Strategy
+	ChargerIDs      []string
+}
+
+// SessionKey identifies a session by the connector it runs on
+type SessionKey struct {
+	ChargerID   string
+	ConnectorID int
+}
+
+// Session is a running transaction on one of the site's chargers
+type Session struct {
+	ChargerID     string
+	ConnectorID   int
+	TransactionID int
+	Priority      int       // higher is served first by StrategyPriority
+	StartedAt     time.Time // orders StrategyFirstCome and breaks ties
+	Status        string    // latest OCPP connector status
+
+	// Latest measurements from MeterValues, 0 if not reported
+	MeasuredCurrent float64
+	MeasuredPower   float64
+	MeasuredAt      time.Time
+
+	// Limit last applied to the charger, -1 if none yet
+	Limit float64
+
+	// Uncontrolled is set once the charger reported it cannot apply limits; the
+	// session then draws whatever it wants
+	Uncontrolled bool
+}
+
+// Key returns the key of the session
+func (s *Session) Key() SessionKey {
+	return SessionKey{ChargerID: s.ChargerID, ConnectorID: s.ConnectorID}
+}
+
+// Idle reports whether the EV is not drawing power, so the session only needs
+// enough budget to resume
+func (s *Session) Idle() bool {
+	return s.Status == "SuspendedEV" || s.Status == "Finishing"
+}
+
+// Measured returns the latest measured draw of the session in unit, or false if
+// there is none younger than MeasurementMaxAge at now
+func (s *Session) Measured(unit string, now time.Time) (float64, bool) {
+	if s.MeasuredAt.IsZero() || now.Sub(s.MeasuredAt) > MeasurementMaxAge {
+		return 0, false
+	}
+	if unit == UnitWatts {
+		return s.MeasuredPower, true
+	}
+	return s.MeasuredCurrent, true
+}
+
+// demand returns the most a session can use: its measured draw with a margin when
+// that is below cap, never less than min
+func (s *Session) demand(unit string, now time.Time, cap, min float64) float64 {
+	measured, ok := s.Measured(unit, now)
+	if !ok {
+		return cap
+	}
+	return math.Max(math.Min(measured*demandMargin, cap), math.Min(min, cap))
+}
+
+// Allocate shares the site budget between sessions according to the site strategy.
+// Idle sessions are served last and only get the minimum limit. A session measured
+// at now drawing less than its share, e.g. an EV that charges slowly, is limited
+// to its draw plus a margin and the rest goes to the other sessions. Sessions that
+// cannot get at least MinLimit are paused with a limit of 0, latest started first.
+// Uncontrolled sessions are set aside first, with their measured draw or else the
+// connector cap.
+func Allocate(site *Site, sessions []*Session, now time.Time) map[SessionKey]float64 {
+	limits := make(map[SessionKey]float64, len(sessions))
+
+	connectorCap := site.MaxPerConnector
+	if connectorCap <= 0 {
+		connectorCap = site.MaxLimit
+	}
+
+	remaining := site.MaxLimit
+	var charging, idle []*Session
+	for _, session := range sessions {
+		switch {
+		case session.Uncontrolled:
+			draw := session.demand(site.Unit, now, connectorCap, 0)
+			limits[session.Key()] = draw
+			remaining -= draw
+		case session.Idle():
+			idle = append(idle, session)
+		default:
+			charging = append(charging, session)
+		}
+	}
+	remaining = math.Max(remaining, 0)
+	sortByStart(charging)
+	sortByStart(idle)
+
+	chargingCap := func(session *Session) float64 {
+		return session.demand(site.Unit, now, connectorCap, site.MinLimit)
+	}
+	idleCap := func(*Session) float64 {
+		return math.Min(site.MinLimit, connectorCap)
+	}
+
+	for _, group := range groups(site.Strategy, charging) {
+		remaining = waterFill(limits, group, remaining, chargingCap, site.MinLimit)
+	}
+	if len(idle) > 0 {
+		remaining = waterFill(limits, idle, remaining, idleCap, site.MinLimit)
+	}
+
+	for key, limit := range limits {
+		limits[key] = round(limit, site.Unit)
+	}
+	return limits
+}
+
+// groups splits sessions, already sorted by start, into the groups served one after
+// the other; the budget is shared equally within a group
+func groups(strategy Strategy, sessions []*Session) [][]*Session {
+	switch strategy {
+	case StrategyFirstCome:
+		result := make([][]*Session, 0, len(sessions))
+		for _, session := range sessions {
+			result = append(result, []*Session{session})
+		}
+		return result
+	case StrategyPriority:
+		byPriority := append([]*Session(nil), sessions...)
+		sort.SliceStable(byPriority, func(i, j int) bool {
+			return byPriority[i].Priority > byPriority[j].Priority
+		})
+		var result [][]*Session
+		for i, session := range byPriority {
+			if i == 0 || session.Priority != byPriority[i-1].Priority {
+				result = append(result, nil)
+			}
+			result[len(result)-1] = append(result[len(result)-1], session)
+		}
+		return result
+	default:
+		return [][]*Session{sessions}
+	}
+}
+
+// waterFill shares budget equally within a group sorted by start. A session whose
+// cap is below the share gets its cap and leaves the rest to the others; when the
+// share falls below min the latest session is paused. It returns the budget left
+// over for the next group.
+func waterFill(limits map[SessionKey]float64, group []*Session, budget float64, cap func(*Session) float64, min float64) float64 {
+	active := append([]*Session(nil), group...)
+	for len(active) > 0 {
+		share := budget / float64(len(active))
+		if share < min || share <= 0 {
+			last := active[len(active)-1]
+			limits[last.Key()] = 0
+			active = active[:len(active)-1]
+			continue
+		}
+
+		var open []*Session
+		for _, session := range active {
+			if c := cap(session); c < share {
+				limits[session.Key()] = c
+				budget -= c
+			} else {
+				open = append(open, session)
+			}
+		}
+		if len(open) == len(active) {
+			for _, session := range active {
+				limits[session.Key()] = share
+			}
+			return budget - share*float64(len(active))
+		}
+		active = open
+	}
+	return budget
+}
+
+// sortByStart orders sessions by start time, then by connector for stability
+func sortByStart(sessions []*Session) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.Before(b.StartedAt)
+		}
+		if a.ChargerID != b.ChargerID {
+			return a.ChargerID < b.ChargerID
+		}
+		return a.ConnectorID < b.ConnectorID
+	})
+}
+
+// round truncates a limit to what a charger can apply: 0.1 A or 1 W
+func round(limit float64, unit string) float64 {
+	if unit == UnitWatts {
+		return math.Floor(limit)
+	}
+	return math.Floor(limit*10) / 10
+}
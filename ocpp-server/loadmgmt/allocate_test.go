@@ -0,0 +1,265 @@
+package loadmgmt
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// session returns a charging session on connector 1 of chargerID, started
+// minutes after epoch
+func session(chargerID string, minutes int) *Session {
+	return &Session{
+		ChargerID:   chargerID,
+		ConnectorID: 1,
+		StartedAt:   epoch.Add(time.Duration(minutes) * time.Minute),
+		Status:      "Charging",
+		Limit:       -1,
+	}
+}
+
+func withPriority(s *Session, priority int) *Session {
+	s.Priority = priority
+	return s
+}
+
+func withStatus(s *Session, status string) *Session {
+	s.Status = status
+	return s
+}
+
+func uncontrolled(s *Session) *Session {
+	s.Uncontrolled = true
+	return s
+}
+
+func withCurrent(s *Session, current float64, at time.Time) *Session {
+	s.MeasuredCurrent = current
+	s.MeasuredAt = at
+	return s
+}
+
+func TestAllocate(t *testing.T) {
+	site := func(strategy Strategy, max, perConnector float64) *Site {
+		return &Site{
+			ID:              1,
+			Unit:            UnitAmperes,
+			MaxLimit:        max,
+			MinLimit:        6,
+			MaxPerConnector: perConnector,
+			Strategy:        strategy,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		site     *Site
+		sessions []*Session
+		want     map[string]float64
+	}{
+		{
+			name:     "equal share",
+			site:     site(StrategyEqualShare, 32, 0),
+			sessions: []*Session{session("a", 0), session("b", 1)},
+			want:     map[string]float64{"a": 16, "b": 16},
+		},
+		{
+			name:     "equal share rounds down to 0.1 A",
+			site:     site(StrategyEqualShare, 32, 0),
+			sessions: []*Session{session("a", 0), session("b", 1), session("c", 2)},
+			want:     map[string]float64{"a": 10.6, "b": 10.6, "c": 10.6},
+		},
+		{
+			name:     "equal share capped per connector",
+			site:     site(StrategyEqualShare, 64, 16),
+			sessions: []*Session{session("a", 0), session("b", 1)},
+			want:     map[string]float64{"a": 16, "b": 16},
+		},
+		{
+			name:     "first come",
+			site:     site(StrategyFirstCome, 40, 32),
+			sessions: []*Session{session("b", 1), session("a", 0)},
+			want:     map[string]float64{"a": 32, "b": 8},
+		},
+		{
+			name:     "first come pauses sessions left with less than the minimum",
+			site:     site(StrategyFirstCome, 36, 32),
+			sessions: []*Session{session("a", 0), session("b", 1)},
+			want:     map[string]float64{"a": 32, "b": 0},
+		},
+		{
+			name: "priority",
+			site: site(StrategyPriority, 48, 32),
+			sessions: []*Session{
+				withPriority(session("a", 0), 1),
+				withPriority(session("b", 1), 3),
+				withPriority(session("c", 2), 1),
+			},
+			want: map[string]float64{"a": 8, "b": 32, "c": 8},
+		},
+		{
+			name: "priority pauses the latest of the last group",
+			site: site(StrategyPriority, 40, 32),
+			sessions: []*Session{
+				withPriority(session("a", 0), 1),
+				withPriority(session("b", 1), 3),
+				withPriority(session("c", 2), 1),
+			},
+			want: map[string]float64{"a": 8, "b": 32, "c": 0},
+		},
+		{
+			name:     "pause below the minimum, latest first",
+			site:     site(StrategyEqualShare, 16, 0),
+			sessions: []*Session{session("a", 0), session("b", 1), session("c", 2)},
+			want:     map[string]float64{"a": 8, "b": 8, "c": 0},
+		},
+		{
+			name:     "pause every session when the budget is below the minimum",
+			site:     site(StrategyEqualShare, 5, 0),
+			sessions: []*Session{session("a", 0)},
+			want:     map[string]float64{"a": 0},
+		},
+		{
+			name: "idle sessions only get the minimum",
+			site: site(StrategyEqualShare, 32, 24),
+			sessions: []*Session{
+				withStatus(session("a", 0), "SuspendedEV"),
+				session("b", 1),
+			},
+			want: map[string]float64{"a": 6, "b": 24},
+		},
+		{
+			name: "idle sessions are paused before charging ones",
+			site: site(StrategyEqualShare, 10, 0),
+			sessions: []*Session{
+				withStatus(session("a", 0), "SuspendedEV"),
+				session("b", 1),
+			},
+			want: map[string]float64{"a": 0, "b": 10},
+		},
+		{
+			name: "unused headroom goes to the other sessions",
+			site: site(StrategyEqualShare, 32, 0),
+			sessions: []*Session{
+				withCurrent(session("a", 0), 5, epoch),
+				session("b", 1),
+			},
+			want: map[string]float64{"a": 6, "b": 26},
+		},
+		{
+			name: "measured draw keeps a margin",
+			site: site(StrategyEqualShare, 32, 0),
+			sessions: []*Session{
+				withCurrent(session("a", 0), 10, epoch),
+				session("b", 1),
+			},
+			want: map[string]float64{"a": 12, "b": 20},
+		},
+		{
+			name: "uncontrolled sessions keep their draw out of the budget",
+			site: site(StrategyEqualShare, 32, 0),
+			sessions: []*Session{
+				uncontrolled(withCurrent(session("a", 0), 10, epoch)),
+				session("b", 1),
+			},
+			want: map[string]float64{"a": 12, "b": 20},
+		},
+		{
+			name: "unmeasured uncontrolled sessions are assumed to draw the connector cap",
+			site: site(StrategyEqualShare, 40, 16),
+			sessions: []*Session{
+				uncontrolled(session("a", 0)),
+				session("b", 1),
+				session("c", 2),
+			},
+			want: map[string]float64{"a": 16, "b": 12, "c": 12},
+		},
+		{
+			name: "stale measurements are ignored",
+			site: site(StrategyEqualShare, 32, 0),
+			sessions: []*Session{
+				withCurrent(session("a", 0), 5, epoch.Add(-MeasurementMaxAge-time.Second)),
+				session("b", 1),
+			},
+			want: map[string]float64{"a": 16, "b": 16},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := Allocate(tt.site, tt.sessions, epoch)
+			if len(limits) != len(tt.want) {
+				t.Fatalf("got %d limits, want %d: %v", len(limits), len(tt.want), limits)
+			}
+			for chargerID, want := range tt.want {
+				got, ok := limits[SessionKey{ChargerID: chargerID, ConnectorID: 1}]
+				if !ok {
+					t.Errorf("%s: no limit", chargerID)
+				} else if got != want {
+					t.Errorf("%s: limit %v, want %v", chargerID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWaterFill(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   float64
+		caps     map[string]float64
+		want     map[string]float64
+		leftover float64
+	}{
+		{
+			name:     "equal shares",
+			budget:   30,
+			caps:     map[string]float64{"a": 32, "b": 32, "c": 32},
+			want:     map[string]float64{"a": 10, "b": 10, "c": 10},
+			leftover: 0,
+		},
+		{
+			name:     "capped sessions leave the rest to the others",
+			budget:   30,
+			caps:     map[string]float64{"a": 6, "b": 32, "c": 8},
+			want:     map[string]float64{"a": 6, "b": 16, "c": 8},
+			leftover: 0,
+		},
+		{
+			name:     "budget left over when every session is capped",
+			budget:   30,
+			caps:     map[string]float64{"a": 6, "b": 10},
+			want:     map[string]float64{"a": 6, "b": 10},
+			leftover: 14,
+		},
+		{
+			name:     "latest paused below the minimum",
+			budget:   10,
+			caps:     map[string]float64{"a": 32, "b": 32},
+			want:     map[string]float64{"a": 10, "b": 0},
+			leftover: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var group []*Session
+			for _, chargerID := range []string{"a", "b", "c"} {
+				if _, ok := tt.caps[chargerID]; ok {
+					group = append(group, session(chargerID, len(group)))
+				}
+			}
+			limits := make(map[SessionKey]float64)
+			leftover := waterFill(limits, group, tt.budget, func(s *Session) float64 { return tt.caps[s.ChargerID] }, 6)
+			if leftover != tt.leftover {
+				t.Errorf("leftover %v, want %v", leftover, tt.leftover)
+			}
+			for chargerID, want := range tt.want {
+				if got := limits[SessionKey{ChargerID: chargerID, ConnectorID: 1}]; got != want {
+					t.Errorf("%s: limit %v, want %v", chargerID, got, want)
+				}
+			}
+		})
+	}
+}
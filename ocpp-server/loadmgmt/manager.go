@@ -0,0 +1,386 @@
+package loadmgmt
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter applies a limit to a running session, typically with a TxProfile
+type Limiter interface {
+	ApplyLimit(ctx context.Context, session Session, limit float64, unit string) error
+}
+
+// ErrNotControllable is returned by a Limiter for a charger that cannot be limited
+// at all. The session is then left uncontrolled and its draw kept out of the
+// budget of the others.
+var ErrNotControllable = errors.New("charger cannot be limited")
+
+// A session drawing at least rampUpRatio of its limit may want more, one drawing
+// at most slackRatio of it leaves budget unused; either calls for a rebalance
+const (
+	rampUpRatio = 0.95
+	slackRatio  = 0.5
+)
+
+// Manager tracks the sessions of every site and keeps their limits within the
+// site budgets. It is safe for concurrent use.
+type Manager struct {
+	clock   Clock
+	limiter Limiter
+
+	mu          sync.Mutex
+	sites       map[int64]*Site
+	chargerSite map[string]int64
+	sessions    map[SessionKey]*Session
+
+	// rebalancing serializes the rebalances of each site, from the allocation to
+	// the last limit sent
+	rebalancing map[int64]*sync.Mutex
+}
+
+// NewManager creates a manager applying limits through limiter
+func NewManager(clock Clock, limiter Limiter) *Manager {
+	return &Manager{
+		clock:       clock,
+		limiter:     limiter,
+		sites:       make(map[int64]*Site),
+		chargerSite: make(map[string]int64),
+		sessions:    make(map[SessionKey]*Session),
+		rebalancing: make(map[int64]*sync.Mutex),
+	}
+}
+
+// SetSites replaces the site configuration
+func (m *Manager) SetSites(sites []Site) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sites = make(map[int64]*Site, len(sites))
+	m.chargerSite = make(map[string]int64)
+	for i := range sites {
+		site := sites[i]
+		m.sites[site.ID] = &site
+		for _, chargerID := range site.ChargerIDs {
+			m.chargerSite[chargerID] = site.ID
+		}
+	}
+}
+
+// SiteOf returns the ID of the site a charger belongs to
+func (m *Manager) SiteOf(chargerID string) (int64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	siteID, ok := m.chargerSite[chargerID]
+	return siteID, ok
+}
+
+// SessionStarted records a new session. A zero startedAt means now.
+func (m *Manager) SessionStarted(chargerID string, connectorID, transactionID, priority int, startedAt time.Time) {
+	if startedAt.IsZero() {
+		startedAt = m.clock.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session := &Session{
+		ChargerID:     chargerID,
+		ConnectorID:   connectorID,
+		TransactionID: transactionID,
+		Priority:      priority,
+		StartedAt:     startedAt,
+		Status:        "Charging",
+		Limit:         -1,
+	}
+	m.sessions[session.Key()] = session
+}
+
+// SessionStopped forgets the session of a transaction
+func (m *Manager) SessionStopped(chargerID string, transactionID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, session := range m.sessions {
+		if session.ChargerID == chargerID && session.TransactionID == transactionID {
+			delete(m.sessions, key)
+		}
+	}
+}
+
+// StatusChanged records a connector status and reports whether the session switched
+// between charging and idle, which calls for a rebalance
+func (m *Manager) StatusChanged(chargerID string, connectorID int, status string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[SessionKey{ChargerID: chargerID, ConnectorID: connectorID}]
+	if !ok {
+		return false
+	}
+	wasIdle := session.Idle()
+	session.Status = status
+	if status == "Available" {
+		// The connector was freed without a StopTransaction yet; keep the
+		// session but stop reserving budget for it
+		session.Status = "Finishing"
+	}
+	return wasIdle != session.Idle()
+}
+
+// MeterValue records a current or power measurement of a connector. Measurands
+// other than Current.Import and Power.Active.Import are ignored; phases are summed
+// by the caller. A measurement older than the last one, e.g. replayed by a charger
+// that was offline, is ignored too. It reports whether the session now draws
+// close to its limit or far below it, which calls for a rebalance.
+func (m *Manager) MeterValue(chargerID string, connectorID int, measurand string, value float64, unit string, at time.Time) bool {
+	if at.IsZero() {
+		at = m.clock.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[SessionKey{ChargerID: chargerID, ConnectorID: connectorID}]
+	if !ok || at.Before(session.MeasuredAt) {
+		return false
+	}
+	var siteUnit string
+	switch measurand {
+	case "Current.Import":
+		session.MeasuredCurrent = value
+		siteUnit = UnitAmperes
+	case "Power.Active.Import":
+		if strings.EqualFold(unit, "kW") {
+			value *= 1000
+		}
+		session.MeasuredPower = value
+		siteUnit = UnitWatts
+	default:
+		return false
+	}
+	session.MeasuredAt = at
+
+	site, ok := m.sites[m.chargerSite[chargerID]]
+	if !ok || site.Unit != siteUnit || session.Limit <= 0 {
+		return false
+	}
+	return value >= session.Limit*rampUpRatio || value <= session.Limit*slackRatio
+}
+
+// Rebalance recomputes the limits of a site and applies the ones that changed.
+// Rebalances of a site run one at a time, so limits reach the chargers in the
+// order they were computed. Lowered limits are sent first, so that the site stays
+// within its budget while the others are raised; if one fails, raised limits are
+// held back until the next rebalance. Finding an uncontrolled session changes the
+// budget of the others, so the site is then allocated again.
+func (m *Manager) Rebalance(ctx context.Context, siteID int64) {
+	lock := m.siteLock(siteID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	for m.rebalance(ctx, siteID) {
+	}
+}
+
+// rebalance allocates a site once and applies the changed limits; it reports
+// whether a session turned out to be uncontrolled. The site lock must be held.
+func (m *Manager) rebalance(ctx context.Context, siteID int64) bool {
+	m.mu.Lock()
+	site, ok := m.sites[siteID]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+	sessions := m.siteSessions(site)
+	limits := Allocate(site, sessions, m.clock.Now())
+
+	type change struct {
+		session Session
+		limit   float64
+	}
+	var lowered, raised []change
+	for _, session := range sessions {
+		limit := limits[session.Key()]
+		if session.Uncontrolled || limit == session.Limit {
+			continue
+		}
+		// A session without a limit yet may draw anything up to the connector rating
+		c := change{session: *session, limit: limit}
+		if session.Limit < 0 || limit < session.Limit {
+			lowered = append(lowered, c)
+		} else {
+			raised = append(raised, c)
+		}
+		session.Limit = limit
+	}
+	unit := site.Unit
+	m.mu.Unlock()
+
+	failed, uncontrolled := false, false
+	for _, c := range lowered {
+		err := m.limiter.ApplyLimit(ctx, c.session, c.limit, unit)
+		switch {
+		case errors.Is(err, ErrNotControllable):
+			log.Printf("Load management: %s connector %d cannot be limited: %v", c.session.ChargerID, c.session.ConnectorID, err)
+			m.markUncontrolled(c.session.Key())
+			uncontrolled = true
+		case err != nil:
+			log.Printf("Failed to apply limit %.1f %s to %s connector %d: %v", c.limit, unit, c.session.ChargerID, c.session.ConnectorID, err)
+			m.forgetLimit(c.session.Key())
+			failed = true
+		}
+	}
+	for _, c := range raised {
+		if failed || uncontrolled {
+			// Never sent: the charger keeps its previous limit
+			m.restoreLimit(c.session.Key(), c.session.Limit)
+			continue
+		}
+		if err := m.limiter.ApplyLimit(ctx, c.session, c.limit, unit); err != nil {
+			log.Printf("Failed to apply limit %.1f %s to %s connector %d: %v", c.limit, unit, c.session.ChargerID, c.session.ConnectorID, err)
+			m.forgetLimit(c.session.Key())
+		}
+	}
+	return uncontrolled
+}
+
+// siteLock returns the lock serializing the rebalances of a site
+func (m *Manager) siteLock(siteID int64) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.rebalancing[siteID]
+	if !ok {
+		lock = new(sync.Mutex)
+		m.rebalancing[siteID] = lock
+	}
+	return lock
+}
+
+// RebalanceCharger rebalances the site of a charger, if it belongs to one
+func (m *Manager) RebalanceCharger(ctx context.Context, chargerID string) {
+	if siteID, ok := m.SiteOf(chargerID); ok {
+		m.Rebalance(ctx, siteID)
+	}
+}
+
+// RebalanceAll rebalances every site
+func (m *Manager) RebalanceAll(ctx context.Context) {
+	m.mu.Lock()
+	siteIDs := make([]int64, 0, len(m.sites))
+	for id := range m.sites {
+		siteIDs = append(siteIDs, id)
+	}
+	m.mu.Unlock()
+
+	for _, id := range siteIDs {
+		m.Rebalance(ctx, id)
+	}
+}
+
+// forgetLimit marks a session limit as unknown so that the next rebalance sends it again
+func (m *Manager) forgetLimit(key SessionKey) {
+	m.mu.Lock()
+	if session, ok := m.sessions[key]; ok {
+		session.Limit = -1
+	}
+	m.mu.Unlock()
+}
+
+// markUncontrolled stops sending limits to a session and reserves its draw instead
+func (m *Manager) markUncontrolled(key SessionKey) {
+	m.mu.Lock()
+	if session, ok := m.sessions[key]; ok {
+		session.Uncontrolled = true
+		session.Limit = -1
+	}
+	m.mu.Unlock()
+}
+
+// restoreLimit sets a session limit back to the one the charger still applies
+func (m *Manager) restoreLimit(key SessionKey, limit float64) {
+	m.mu.Lock()
+	if session, ok := m.sessions[key]; ok {
+		session.Limit = limit
+	}
+	m.mu.Unlock()
+}
+
+// siteSessions returns the sessions running on a site's chargers; m.mu must be held
+func (m *Manager) siteSessions(site *Site) []*Session {
+	var sessions []*Session
+	for _, session := range m.sessions {
+		if m.chargerSite[session.ChargerID] == site.ID {
+			sessions = append(sessions, session)
+		}
+	}
+	sortByStart(sessions)
+	return sessions
+}
+
+// SiteStatus is a snapshot of a site's budget and sessions
+type SiteStatus struct {
+	SiteID    int64           `json:"site_id"`
+	Unit      string          `json:"unit"`
+	MaxLimit  float64         `json:"max_limit"`
+	Allocated float64         `json:"allocated"`
+	Measured  float64         `json:"measured"`
+	Sessions  []SessionStatus `json:"sessions"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// SessionStatus is one session within a SiteStatus
+type SessionStatus struct {
+	ChargerID     string    `json:"charger_id"`
+	ConnectorID   int       `json:"connector_id"`
+	TransactionID int       `json:"transaction_id"`
+	Priority      int       `json:"priority"`
+	Status        string    `json:"status"`
+	StartedAt     time.Time `json:"started_at"`
+	Limit         *float64  `json:"limit"`
+	Measured      float64   `json:"measured"`
+	Uncontrolled  bool      `json:"uncontrolled,omitempty"`
+}
+
+// Status returns a snapshot of a site, or false if it is unknown
+func (m *Manager) Status(siteID int64) (SiteStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	site, ok := m.sites[siteID]
+	if !ok {
+		return SiteStatus{}, false
+	}
+
+	status := SiteStatus{
+		SiteID:    site.ID,
+		Unit:      site.Unit,
+		MaxLimit:  site.MaxLimit,
+		Sessions:  []SessionStatus{},
+		Timestamp: m.clock.Now(),
+	}
+	for _, session := range m.siteSessions(site) {
+		s := SessionStatus{
+			ChargerID:     session.ChargerID,
+			ConnectorID:   session.ConnectorID,
+			TransactionID: session.TransactionID,
+			Priority:      session.Priority,
+			Status:        session.Status,
+			StartedAt:     session.StartedAt,
+			Measured:      session.MeasuredCurrent,
+			Uncontrolled:  session.Uncontrolled,
+		}
+		if site.Unit == UnitWatts {
+			s.Measured = session.MeasuredPower
+		}
+		if session.Limit >= 0 {
+			limit := session.Limit
+			s.Limit = &limit
+			status.Allocated += limit
+		}
+		status.Measured += s.Measured
+		status.Sessions = append(status.Sessions, s)
+	}
+	return status, true
+}
@@ -0,0 +1,206 @@
+package loadmgmt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+type appliedLimit struct {
+	chargerID string
+	limit     float64
+}
+
+// recordingLimiter records the limits applied, failing for the chargers in fail
+// and reporting the ones in uncontrollable as such
+type recordingLimiter struct {
+	mu             sync.Mutex
+	applied        []appliedLimit
+	fail           map[string]bool
+	uncontrollable map[string]bool
+}
+
+func (l *recordingLimiter) ApplyLimit(ctx context.Context, session Session, limit float64, unit string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.uncontrollable[session.ChargerID] {
+		return ErrNotControllable
+	}
+	if l.fail[session.ChargerID] {
+		return errors.New("rejected")
+	}
+	l.applied = append(l.applied, appliedLimit{chargerID: session.ChargerID, limit: limit})
+	return nil
+}
+
+func (l *recordingLimiter) take() []appliedLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	applied := l.applied
+	l.applied = nil
+	return applied
+}
+
+func newTestManager() (*Manager, *fakeClock, *recordingLimiter) {
+	clock := &fakeClock{now: epoch}
+	limiter := &recordingLimiter{fail: make(map[string]bool), uncontrollable: make(map[string]bool)}
+	m := NewManager(clock, limiter)
+	m.SetSites([]Site{{
+		ID:         1,
+		Unit:       UnitAmperes,
+		MaxLimit:   32,
+		MinLimit:   6,
+		Strategy:   StrategyEqualShare,
+		ChargerIDs: []string{"a", "b"},
+	}})
+	return m, clock, limiter
+}
+
+func expectApplied(t *testing.T, got []appliedLimit, want ...appliedLimit) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("applied %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("applied %v, want %v", got, want)
+		}
+	}
+}
+
+func TestManagerRebalance(t *testing.T) {
+	ctx := context.Background()
+	m, clock, limiter := newTestManager()
+
+	m.SessionStarted("a", 1, 1, 0, time.Time{})
+	m.RebalanceCharger(ctx, "a")
+	expectApplied(t, limiter.take(), appliedLimit{"a", 32})
+
+	// Only changed limits are sent, and the lowered one first
+	clock.now = clock.now.Add(time.Minute)
+	m.SessionStarted("b", 1, 2, 0, time.Time{})
+	m.RebalanceCharger(ctx, "b")
+	expectApplied(t, limiter.take(), appliedLimit{"a", 16}, appliedLimit{"b", 16})
+
+	m.RebalanceCharger(ctx, "a")
+	expectApplied(t, limiter.take())
+
+	// A lowered limit goes out before the raised one, even for a later session
+	if !m.MeterValue("b", 1, "Current.Import", 5, "A", time.Time{}) {
+		t.Fatal("a session drawing far below its limit should call for a rebalance")
+	}
+	m.RebalanceCharger(ctx, "b")
+	expectApplied(t, limiter.take(), appliedLimit{"b", 6}, appliedLimit{"a", 26})
+
+	if m.MeterValue("b", 1, "Current.Import", 5, "A", clock.now.Add(-time.Minute)) {
+		t.Fatal("an older measurement should be ignored")
+	}
+
+	// Once the measurement is stale, the session gets its share back
+	clock.now = clock.now.Add(MeasurementMaxAge + time.Second)
+	m.RebalanceAll(ctx)
+	expectApplied(t, limiter.take(), appliedLimit{"a", 16}, appliedLimit{"b", 16})
+
+	m.SessionStopped("b", 2)
+	m.RebalanceCharger(ctx, "a")
+	expectApplied(t, limiter.take(), appliedLimit{"a", 32})
+
+	status, ok := m.Status(1)
+	if !ok || len(status.Sessions) != 1 || status.Allocated != 32 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestManagerFailedDecreaseHoldsIncreases(t *testing.T) {
+	ctx := context.Background()
+	m, clock, limiter := newTestManager()
+
+	m.SessionStarted("a", 1, 1, 0, time.Time{})
+	clock.now = clock.now.Add(time.Minute)
+	m.SessionStarted("b", 1, 2, 0, time.Time{})
+	m.RebalanceCharger(ctx, "a")
+	limiter.take()
+
+	limiter.fail["b"] = true
+	m.MeterValue("b", 1, "Current.Import", 5, "A", time.Time{})
+	m.RebalanceCharger(ctx, "a")
+	expectApplied(t, limiter.take())
+
+	// Both limits are sent again once the charger accepts them
+	limiter.fail["b"] = false
+	m.RebalanceCharger(ctx, "a")
+	expectApplied(t, limiter.take(), appliedLimit{"b", 6}, appliedLimit{"a", 26})
+}
+
+func TestManagerUncontrolledSession(t *testing.T) {
+	ctx := context.Background()
+	m, clock, limiter := newTestManager()
+	limiter.uncontrollable["a"] = true
+
+	m.SessionStarted("a", 1, 1, 0, time.Time{})
+	m.MeterValue("a", 1, "Current.Import", 10, "A", time.Time{})
+	clock.now = clock.now.Add(time.Minute)
+	m.SessionStarted("b", 1, 2, 0, time.Time{})
+
+	// b is limited to what a leaves, and a is never sent a limit again
+	m.RebalanceCharger(ctx, "b")
+	expectApplied(t, limiter.take(), appliedLimit{"b", 20})
+
+	m.RebalanceCharger(ctx, "b")
+	expectApplied(t, limiter.take())
+
+	status, _ := m.Status(1)
+	for _, s := range status.Sessions {
+		if s.Uncontrolled != (s.ChargerID == "a") {
+			t.Errorf("%s: uncontrolled %v", s.ChargerID, s.Uncontrolled)
+		}
+	}
+}
+
+func TestManagerStatusChanged(t *testing.T) {
+	m, _, _ := newTestManager()
+	m.SessionStarted("a", 1, 1, 0, time.Time{})
+
+	if m.StatusChanged("a", 1, "Charging") {
+		t.Error("a charging session reporting Charging should not call for a rebalance")
+	}
+	if !m.StatusChanged("a", 1, "SuspendedEV") {
+		t.Error("a session becoming idle should call for a rebalance")
+	}
+	if !m.StatusChanged("a", 1, "Charging") {
+		t.Error("a session resuming should call for a rebalance")
+	}
+	if m.StatusChanged("b", 1, "Charging") {
+		t.Error("a connector without session should not call for a rebalance")
+	}
+}
+
+func TestManagerMeterValueNearLimit(t *testing.T) {
+	ctx := context.Background()
+	m, _, _ := newTestManager()
+	m.SessionStarted("a", 1, 1, 0, time.Time{})
+
+	if m.MeterValue("a", 1, "Current.Import", 20, "A", time.Time{}) {
+		t.Error("a session without limit should not call for a rebalance")
+	}
+	m.RebalanceCharger(ctx, "a")
+
+	// Limited to 24 A: 20 A plus the margin
+	if m.MeterValue("a", 1, "Current.Import", 20, "A", time.Time{}) {
+		t.Error("a session drawing within its margin should not call for a rebalance")
+	}
+	if !m.MeterValue("a", 1, "Current.Import", 23.5, "A", time.Time{}) {
+		t.Error("a session drawing close to its limit should call for a rebalance")
+	}
+	if m.MeterValue("a", 1, "Power.Active.Import", 20, "kW", time.Time{}) {
+		t.Error("power should not call for a rebalance of a site limited in amperes")
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// localListResult reports what a local list synchronisation did
+type localListResult struct {
+	UpdateType  ocpp16.UpdateType   `json:"update_type,omitempty"`
+	ListVersion int                 `json:"list_version"`
+	Status      ocpp16.UpdateStatus `json:"status,omitempty"`
+	Entries     int                 `json:"entries"`
+	Chunks      int                 `json:"chunks,omitempty"`
+	UpToDate    bool                `json:"up_to_date"`
+}
+
+// sendLocalListMaxLengthKey is the configuration key holding the most entries a
+// single SendLocalList may carry
+const sendLocalListMaxLengthKey = "SendLocalListMaxLength"
+
+// desiredLocalList builds the local list every charger should hold from the idTag store
+func desiredLocalList(ctx context.Context) (map[string]ocpp16.IdTagInfo, error) {
+	tags, err := db.ListIdTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	list := make(map[string]ocpp16.IdTagInfo, len(tags))
+	for i := range tags {
+		list[tags[i].Tag] = idTagInfoFor(&tags[i], now)
+	}
+	return list, nil
+}
+
+// fullLocalList returns every entry of list, sorted by idTag
+func fullLocalList(list map[string]ocpp16.IdTagInfo) []ocpp16.AuthorizationData {
+	entries := make([]ocpp16.AuthorizationData, 0, len(list))
+	for tag, info := range list {
+		info := info
+		entries = append(entries, ocpp16.AuthorizationData{IdTag: tag, IdTagInfo: &info})
+	}
+	sortAuthorizationData(entries)
+	return entries
+}
+
+// differentialLocalList returns the entries turning sent into desired: added and
+// changed idTags with their idTagInfo, removed ones without
+func differentialLocalList(sent, desired map[string]ocpp16.IdTagInfo) []ocpp16.AuthorizationData {
+	var entries []ocpp16.AuthorizationData
+	for tag, info := range desired {
+		old, ok := sent[tag]
+		if ok && sameIdTagInfo(old, info) {
+			continue
+		}
+		info := info
+		entries = append(entries, ocpp16.AuthorizationData{IdTag: tag, IdTagInfo: &info})
+	}
+	for tag := range sent {
+		if _, ok := desired[tag]; !ok {
+			entries = append(entries, ocpp16.AuthorizationData{IdTag: tag})
+		}
+	}
+	sortAuthorizationData(entries)
+	return entries
+}
+
+func sameIdTagInfo(a, b ocpp16.IdTagInfo) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func sortAuthorizationData(entries []ocpp16.AuthorizationData) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].IdTag < entries[j].IdTag })
+}
+
+// syncLocalList brings the local list of a charger in line with the idTag store.
+// A differential update is sent when the charger still holds the version we last
+// sent; a full one when it holds another version, when full is set, or when the
+// charger refuses the differential update with VersionMismatch. Updates longer
+// than the charger's SendLocalListMaxLength are sent in chunks, each with its
+// own version: a full update as a full first chunk followed by differential ones.
+func (s *OCPPServer) syncLocalList(ctx context.Context, chargerID string, full bool) (*localListResult, error) {
+	response, err := s.SendRemoteCommand(ctx, chargerID, &ocpp16.GetLocalListVersionRequest{})
+	if err != nil {
+		return nil, err
+	}
+	chargerVersion := response.(*ocpp16.GetLocalListVersionConfirmation).ListVersion
+	if chargerVersion < 0 {
+		return nil, fmt.Errorf("%w: local authorization list disabled on %s", errInvalidCommand, chargerID)
+	}
+
+	state, err := db.GetLocalList(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	sent := map[string]ocpp16.IdTagInfo{}
+	version := chargerVersion
+	if state != nil {
+		if err := json.Unmarshal(state.Entries, &sent); err != nil {
+			return nil, fmt.Errorf("corrupt local list of %s: %w", chargerID, err)
+		}
+		if state.Version > version {
+			version = state.Version
+		}
+	}
+	if state == nil || state.Version != chargerVersion {
+		log.Printf("Local list of %s is at version %d, expected %v; sending full list", chargerID, chargerVersion, stateVersion(state))
+		full = true
+	}
+
+	desired, err := desiredLocalList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updateType := ocpp16.UpdateTypeDifferential
+	var entries []ocpp16.AuthorizationData
+	if full {
+		updateType = ocpp16.UpdateTypeFull
+		entries = fullLocalList(desired)
+	} else {
+		entries = differentialLocalList(sent, desired)
+		if len(entries) == 0 {
+			return &localListResult{ListVersion: chargerVersion, Entries: len(desired), UpToDate: true}, nil
+		}
+	}
+
+	maxLength, err := s.sendLocalListMaxLength(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	chunks := chunkAuthorizationData(entries, maxLength)
+
+	// applied is the list the charger holds after the chunks it accepted
+	applied := sent
+	if full {
+		applied = map[string]ocpp16.IdTagInfo{}
+	}
+	result := &localListResult{UpdateType: updateType, Entries: len(desired), Chunks: len(chunks)}
+	accepted := 0
+	for i, chunk := range chunks {
+		req := &ocpp16.SendLocalListRequest{
+			ListVersion:            version + 1 + i,
+			UpdateType:             updateType,
+			LocalAuthorizationList: chunk,
+		}
+		if i > 0 {
+			req.UpdateType = ocpp16.UpdateTypeDifferential
+		}
+
+		response, err := s.SendRemoteCommand(ctx, chargerID, req)
+		if err != nil {
+			if i > 0 {
+				// The chunks accepted so far hold; the next sync continues from them
+				return nil, errors.Join(err, saveLocalListState(ctx, chargerID, state, ocpp16.UpdateStatusFailed, accepted, applied))
+			}
+			return nil, err
+		}
+		status := response.(*ocpp16.SendLocalListConfirmation).Status
+		if status == ocpp16.UpdateStatusVersionMismatch && i == 0 && !full {
+			log.Printf("Differential local list refused by %s, sending full list", chargerID)
+			return s.syncLocalList(ctx, chargerID, true)
+		}
+
+		result.ListVersion, result.Status = req.ListVersion, status
+		if status != ocpp16.UpdateStatusAccepted {
+			break
+		}
+		applyAuthorizationData(applied, req)
+		accepted = req.ListVersion
+	}
+
+	if err := saveLocalListState(ctx, chargerID, state, result.Status, accepted, applied); err != nil {
+		return result, err
+	}
+	log.Printf("%s local list version %d sent to %s in %d chunk(s): %s", updateType, result.ListVersion, chargerID, len(chunks), result.Status)
+	return result, nil
+}
+
+// sendLocalListMaxLength asks a charger how many entries a SendLocalList may hold;
+// 0 when it does not say
+func (s *OCPPServer) sendLocalListMaxLength(ctx context.Context, chargerID string) (int, error) {
+	response, err := s.SendRemoteCommand(ctx, chargerID, &ocpp16.GetConfigurationRequest{Key: []string{sendLocalListMaxLengthKey}})
+	if err != nil {
+		return 0, err
+	}
+	for _, kv := range response.(*ocpp16.GetConfigurationConfirmation).ConfigurationKey {
+		if kv.Key != sendLocalListMaxLengthKey || kv.Value == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(*kv.Value)); err == nil && n > 0 {
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+// chunkAuthorizationData splits entries into chunks of at most maxLength entries;
+// a maxLength of 0 means no limit
+func chunkAuthorizationData(entries []ocpp16.AuthorizationData, maxLength int) [][]ocpp16.AuthorizationData {
+	if maxLength <= 0 || len(entries) <= maxLength {
+		return [][]ocpp16.AuthorizationData{entries}
+	}
+	var chunks [][]ocpp16.AuthorizationData
+	for len(entries) > maxLength {
+		chunks = append(chunks, entries[:maxLength])
+		entries = entries[maxLength:]
+	}
+	return append(chunks, entries)
+}
+
+// applyAuthorizationData updates list the way a charger applies an accepted
+// SendLocalList
+func applyAuthorizationData(list map[string]ocpp16.IdTagInfo, req *ocpp16.SendLocalListRequest) {
+	if req.UpdateType == ocpp16.UpdateTypeFull {
+		for tag := range list {
+			delete(list, tag)
+		}
+	}
+	for _, entry := range req.LocalAuthorizationList {
+		if entry.IdTagInfo == nil {
+			delete(list, entry.IdTag)
+		} else {
+			list[entry.IdTag] = *entry.IdTagInfo
+		}
+	}
+}
+
+func stateVersion(state *models.LocalList) interface{} {
+	if state == nil {
+		return "none"
+	}
+	return state.Version
+}
+
+// saveLocalListState records the outcome of a SendLocalList. version is the last
+// version the charger accepted, holding entries, or 0 if it accepted none, in
+// which case the recorded version and entries stay as they were.
+func saveLocalListState(ctx context.Context, chargerID string, state *models.LocalList, status ocpp16.UpdateStatus, version int, entries map[string]ocpp16.IdTagInfo) error {
+	if state == nil {
+		state = &models.LocalList{ChargerID: chargerID, Entries: json.RawMessage("{}")}
+	}
+	state.LastStatus = string(status)
+	if version > 0 {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		state.Version = version
+		state.Entries = data
+		state.EntryCount = len(entries)
+		state.SyncedAt = &now
+	}
+	return db.SaveLocalList(ctx, state)
+}
+
+// resyncLocalListOnce resynchronises the local list of a 1.6 charger after the
+// first CALL it sends while accepted on its connection: its BootNotification
+// after a reboot, or whatever it sends first after a reconnect, as it may have
+// missed idTag changes while offline
+func (s *OCPPServer) resyncLocalListOnce(chargerID string) {
+	charger := s.getCharger(chargerID)
+	if charger == nil || charger.Protocol != ocpp16.Subprotocol || charger.RegistrationStatus() != ocpp16.RegistrationStatusAccepted {
+		return
+	}
+	charger.localListSync.Do(func() {
+		go s.resyncLocalList(chargerID)
+	})
+}
+
+// resyncLocalList synchronises the local list of a charger that just connected or
+// booted. Chargers without the Local Auth List Management profile are left alone.
+func (s *OCPPServer) resyncLocalList(chargerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*remoteCommandTimeout)
+	defer cancel()
+
+	_, err := s.syncLocalList(ctx, chargerID, false)
+	var callErr *ocpp16.Error
+	switch {
+	case err == nil:
+	case errors.As(err, &callErr) && (callErr.Code == ocpp16.NotImplemented || callErr.Code == ocpp16.NotSupported):
+		log.Printf("%s does not support local authorization lists", chargerID)
+	case errors.Is(err, errInvalidCommand):
+		log.Printf("Local list not synchronised: %v", err)
+	default:
+		log.Printf("Failed to synchronise local list of %s: %v", chargerID, err)
+	}
+}
+
+// handleLocalList reports the local list state of a charger
+func (s *OCPPServer) handleLocalList(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := db.GetLocalList(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if state == nil {
+		http.Error(w, "No local list sent to this charger", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// handleLocalListSync synchronises the local list of a charger now; ?full=true forces a full update
+func (s *OCPPServer) handleLocalListSync(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	full := r.URL.Query().Get("full") == "true"
+	result, err := s.syncLocalList(r.Context(), r.PathValue("id"), full)
+	if err != nil {
+		writeCommandResponse(w, "SendLocalList", nil, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"ocpp-server/ocpp16"
+)
+
+var (
+	acceptedInfo = ocpp16.IdTagInfo{Status: ocpp16.AuthorizationStatusAccepted}
+	blockedInfo  = ocpp16.IdTagInfo{Status: ocpp16.AuthorizationStatusBlocked}
+)
+
+// idTags returns n accepted entries TAG00, TAG01...
+func idTags(n int) []ocpp16.AuthorizationData {
+	entries := make([]ocpp16.AuthorizationData, n)
+	for i := range entries {
+		info := acceptedInfo
+		entries[i] = ocpp16.AuthorizationData{IdTag: fmt.Sprintf("TAG%02d", i), IdTagInfo: &info}
+	}
+	return entries
+}
+
+func TestChunkAuthorizationData(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   int
+		maxLength int
+		want      []int
+	}{
+		{name: "no limit", entries: 25, maxLength: 0, want: []int{25}},
+		{name: "fits in one chunk", entries: 10, maxLength: 10, want: []int{10}},
+		{name: "split evenly", entries: 20, maxLength: 10, want: []int{10, 10}},
+		{name: "last chunk shorter", entries: 25, maxLength: 10, want: []int{10, 10, 5}},
+		{name: "one entry per chunk", entries: 3, maxLength: 1, want: []int{1, 1, 1}},
+		{name: "empty list is still sent", entries: 0, maxLength: 10, want: []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := idTags(tt.entries)
+			chunks := chunkAuthorizationData(entries, tt.maxLength)
+
+			var sizes []int
+			var joined []ocpp16.AuthorizationData
+			for _, chunk := range chunks {
+				sizes = append(sizes, len(chunk))
+				joined = append(joined, chunk...)
+			}
+			if !reflect.DeepEqual(sizes, tt.want) {
+				t.Errorf("chunk sizes %v, want %v", sizes, tt.want)
+			}
+			if len(joined) != len(entries) {
+				t.Fatalf("chunks hold %d entries, want %d", len(joined), len(entries))
+			}
+			for i := range entries {
+				if joined[i].IdTag != entries[i].IdTag {
+					t.Errorf("entry %d is %s, want %s", i, joined[i].IdTag, entries[i].IdTag)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyAuthorizationData(t *testing.T) {
+	tests := []struct {
+		name string
+		list map[string]ocpp16.IdTagInfo
+		req  ocpp16.SendLocalListRequest
+		want map[string]ocpp16.IdTagInfo
+	}{
+		{
+			name: "full update replaces the list",
+			list: map[string]ocpp16.IdTagInfo{"OLD": acceptedInfo, "KEEP": blockedInfo},
+			req: ocpp16.SendLocalListRequest{
+				UpdateType:             ocpp16.UpdateTypeFull,
+				LocalAuthorizationList: []ocpp16.AuthorizationData{{IdTag: "KEEP", IdTagInfo: &acceptedInfo}, {IdTag: "NEW", IdTagInfo: &acceptedInfo}},
+			},
+			want: map[string]ocpp16.IdTagInfo{"KEEP": acceptedInfo, "NEW": acceptedInfo},
+		},
+		{
+			name: "empty full update clears the list",
+			list: map[string]ocpp16.IdTagInfo{"OLD": acceptedInfo},
+			req:  ocpp16.SendLocalListRequest{UpdateType: ocpp16.UpdateTypeFull},
+			want: map[string]ocpp16.IdTagInfo{},
+		},
+		{
+			name: "differential update adds, changes and removes",
+			list: map[string]ocpp16.IdTagInfo{"A": acceptedInfo, "B": acceptedInfo, "C": acceptedInfo},
+			req: ocpp16.SendLocalListRequest{
+				UpdateType: ocpp16.UpdateTypeDifferential,
+				LocalAuthorizationList: []ocpp16.AuthorizationData{
+					{IdTag: "B", IdTagInfo: &blockedInfo},
+					{IdTag: "C"},
+					{IdTag: "D", IdTagInfo: &acceptedInfo},
+				},
+			},
+			want: map[string]ocpp16.IdTagInfo{"A": acceptedInfo, "B": blockedInfo, "D": acceptedInfo},
+		},
+		{
+			name: "removing an unknown idTag is a no-op",
+			list: map[string]ocpp16.IdTagInfo{"A": acceptedInfo},
+			req: ocpp16.SendLocalListRequest{
+				UpdateType:             ocpp16.UpdateTypeDifferential,
+				LocalAuthorizationList: []ocpp16.AuthorizationData{{IdTag: "Z"}},
+			},
+			want: map[string]ocpp16.IdTagInfo{"A": acceptedInfo},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyAuthorizationData(tt.list, &tt.req)
+			if !reflect.DeepEqual(tt.list, tt.want) {
+				t.Errorf("list %v, want %v", tt.list, tt.want)
+			}
+		})
+	}
+}
+
+func TestDifferentialLocalList(t *testing.T) {
+	sent := map[string]ocpp16.IdTagInfo{"A": acceptedInfo, "B": acceptedInfo, "C": acceptedInfo}
+	desired := map[string]ocpp16.IdTagInfo{"A": acceptedInfo, "B": blockedInfo, "D": acceptedInfo}
+
+	entries := differentialLocalList(sent, desired)
+	want := []ocpp16.AuthorizationData{
+		{IdTag: "B", IdTagInfo: &blockedInfo},
+		{IdTag: "C"},
+		{IdTag: "D", IdTagInfo: &acceptedInfo},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries %+v, want %+v", entries, want)
+	}
+	if entries := differentialLocalList(desired, desired); len(entries) != 0 {
+		t.Errorf("entries %+v between identical lists", entries)
+	}
+}
+
+// TestLocalListChunksRebuildList replays the chunks of an update the way
+// syncLocalList sends them: the first with the update type, the others
+// differential. The charger must end up with the desired list.
+func TestLocalListChunksRebuildList(t *testing.T) {
+	desired := map[string]ocpp16.IdTagInfo{}
+	for i, entry := range idTags(23) {
+		desired[entry.IdTag] = acceptedInfo
+		if i%5 == 0 {
+			desired[entry.IdTag] = blockedInfo
+		}
+	}
+	sent := map[string]ocpp16.IdTagInfo{"TAG00": acceptedInfo, "TAG01": acceptedInfo, "GONE": acceptedInfo}
+
+	tests := []struct {
+		name       string
+		updateType ocpp16.UpdateType
+		entries    []ocpp16.AuthorizationData
+	}{
+		{name: "full", updateType: ocpp16.UpdateTypeFull, entries: fullLocalList(desired)},
+		{name: "differential", updateType: ocpp16.UpdateTypeDifferential, entries: differentialLocalList(sent, desired)},
+	}
+
+	for _, tt := range tests {
+		for _, maxLength := range []int{0, 1, 4, 10, 100} {
+			t.Run(fmt.Sprintf("%s by %d", tt.name, maxLength), func(t *testing.T) {
+				list := make(map[string]ocpp16.IdTagInfo)
+				for tag, info := range sent {
+					list[tag] = info
+				}
+				for i, chunk := range chunkAuthorizationData(tt.entries, maxLength) {
+					req := &ocpp16.SendLocalListRequest{UpdateType: tt.updateType, LocalAuthorizationList: chunk}
+					if i > 0 {
+						req.UpdateType = ocpp16.UpdateTypeDifferential
+					}
+					applyAuthorizationData(list, req)
+				}
+				if !reflect.DeepEqual(list, desired) {
+					t.Errorf("charger holds %v, want %v", list, desired)
+				}
+			})
+		}
+	}
+}
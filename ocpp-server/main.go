@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,7 +11,13 @@ import (
 	"sync"
 	"time"
 
+	"ocpp-server/datatransfer"
 	db "ocpp-server/db"
+	"ocpp-server/loadmgmt"
+	"ocpp-server/models"
+	"ocpp-server/ocpp15"
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -32,41 +39,61 @@ func (c *ChargerID) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("chargerId must be string or number")
 }
 
-// OCPP Message Types
-const (
-	CALL       = 2
-	CALLRESULT = 3
-	CALLERROR  = 4
-)
-
-// OCPP Message represents the basic OCPP message structure
-type OCPPMessage []interface{}
-
-// Charger represents a connected charger
-type Charger struct {
-	ID         string
-	Connection *websocket.Conn
-	LastSeen   time.Time
-}
-
 // OCPPServer handles OCPP WebSocket connections
 type OCPPServer struct {
 	chargers map[string]*Charger
 	mutex    sync.RWMutex
-	upgrader websocket.Upgrader
+
+	// number of connections accepted per charger identity since startup
+	generations map[string]uint64
+	upgrader    websocket.Upgrader
+
+	pendingCalls map[string]*pendingCall
+	pendingMu    sync.Mutex
+
+	// TriggerMessage callers waiting for the message they asked for
+	triggerWaiters map[*triggerWaiter]struct{}
+	triggerMu      sync.Mutex
+
+	// OCPP 1.5 chargers, which post SOAP requests instead of keeping a connection
+	soapChargers map[string]*soapCharger
+	soapMu       sync.RWMutex
+	soapClient   *ocpp15.Client
+
+	// security profile applied to chargers without their own configuration
+	defaultSecurityProfile int
+
+	// WebSocket ping period, 0 disables pings
+	pingInterval time.Duration
+
+	events       *eventBus
+	loadManager  *loadmgmt.Manager
+	files        *fileStore
+	dataTransfer *datatransfer.Registry
 }
 
 // NewOCPPServer creates a new OCPP server instance
 func NewOCPPServer() *OCPPServer {
-	return &OCPPServer{
-		chargers: make(map[string]*Charger),
+	s := &OCPPServer{
+		chargers:       make(map[string]*Charger),
+		generations:    make(map[string]uint64),
+		pendingCalls:   make(map[string]*pendingCall),
+		triggerWaiters: make(map[*triggerWaiter]struct{}),
+		soapChargers:   make(map[string]*soapCharger),
+		soapClient:     ocpp15.NewClient(&http.Client{}),
+		pingInterval:   defaultPingInterval,
+		events:         newEventBus(),
+		dataTransfer:   datatransfer.NewRegistry(),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow connections from any origin
 			},
-			Subprotocols: []string{"ocpp1.6"},
+			// Chargers offering both get 2.0.1
+			Subprotocols: []string{ocpp201.Subprotocol, ocpp16.Subprotocol},
 		},
 	}
+	s.loadManager = loadmgmt.NewManager(loadmgmt.SystemClock{}, s)
+	return s
 }
 
 // HandleWebSocket handles incoming WebSocket connections
@@ -74,7 +101,29 @@ func (s *OCPPServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Extract charger ID from URL path
 	chargerID := r.URL.Path[1:] // Remove leading '/'
 	if chargerID == "" {
-		chargerID = fmt.Sprintf("charger_%s", uuid.New().String()[:8])
+		http.Error(w, "charge point identity missing from URL", http.StatusNotFound)
+		return
+	}
+
+	if err := s.authenticateCharger(r, chargerID); err != nil {
+		log.Printf("Refused connection of %s from %s: %v", chargerID, r.RemoteAddr, err)
+		status := http.StatusUnauthorized
+		if authErr, ok := err.(*authError); ok {
+			status = authErr.status
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="OCPP"`)
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// Chargers known from an earlier acceptance do not have to boot again after a
+	// reconnect; unknown ones are held back until their BootNotification is accepted
+	registration, err := registrationStatus(r.Context(), chargerID)
+	if err != nil {
+		log.Printf("Registration lookup failed for %s: %v", chargerID, err)
+		registration = ocpp16.RegistrationStatusPending
 	}
 
 	conn, err := s.upgrader.Upgrade(w, r, nil)
@@ -82,129 +131,225 @@ func (s *OCPPServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
 	}
-	defer conn.Close()
 
-	// Register charger
-	charger := &Charger{
-		ID:         chargerID,
-		Connection: conn,
-		LastSeen:   time.Now(),
-	}
+	// Register charger. The newest connection of an identity always wins: a charger
+	// that reconnects before its old socket timed out replaces it.
+	charger := newCharger(chargerID, conn, registration)
 
 	s.mutex.Lock()
+	stale := s.chargers[chargerID]
+	s.generations[chargerID]++
+	charger.Generation = s.generations[chargerID]
 	s.chargers[chargerID] = charger
 	s.mutex.Unlock()
 
-	log.Printf("Charger %s connected from %s", chargerID, conn.RemoteAddr())
+	if stale != nil {
+		log.Printf("Charger %s reconnected, closing connection %d", chargerID, stale.Generation)
+		stale.closeWithReason("replaced by a new connection")
+	}
+	s.run(charger)
+
+	log.Printf("Charger %s connected from %s (%s, %s, connection %d)", chargerID, conn.RemoteAddr(), charger.Protocol, registration, charger.Generation)
+	s.events.publish(Event{
+		Type:      EventChargerOnline,
+		ChargerID: chargerID,
+		Data: map[string]interface{}{
+			"protocol":   charger.Protocol,
+			"connection": charger.Generation,
+		},
+	})
 
 	// Handle messages
 	for {
-		var msg OCPPMessage
-		err := conn.ReadJSON(&msg)
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Error reading message from %s: %v", chargerID, err)
 			break
 		}
 
-		charger.LastSeen = time.Now()
-		go s.handleOCPPMessage(charger, msg)
+		charger.touch()
+		charger.extendReadDeadline()
+		if err := s.handleOCPPMessage(charger, data); err != nil {
+			break
+		}
 	}
 
-	// Cleanup
+	// Cleanup, unless a newer connection of the same charger took over
+	charger.close()
 	s.mutex.Lock()
-	delete(s.chargers, chargerID)
+	current := s.chargers[chargerID] == charger
+	if current {
+		delete(s.chargers, chargerID)
+	}
 	s.mutex.Unlock()
-	log.Printf("Charger %s disconnected", chargerID)
+	s.failPendingCalls(charger, errChargerDisconnected)
+	if current {
+		s.markOffline(charger)
+	}
+	log.Printf("Charger %s connection %d closed (%s)", chargerID, charger.Generation, charger.closeReason())
 }
 
-// handleOCPPMessage processes OCPP messages
-func (s *OCPPServer) handleOCPPMessage(charger *Charger, msg OCPPMessage) {
-	if len(msg) < 2 {
-		log.Printf("Invalid message format from %s", charger.ID)
-		return
+// handleOCPPMessage routes a frame read from the charger. Answers to our own CALLs
+// are resolved right away; CALLs are queued for processCalls. It only fails once
+// the connection is closing.
+func (s *OCPPServer) handleOCPPMessage(charger *Charger, data []byte) error {
+	frame, err := ocpp16.ParseFrame(data)
+	if err != nil {
+		log.Printf("Invalid message format from %s: %v", charger.ID, err)
+		var ocppErr *ocpp16.Error
+		if frame.Type == ocpp16.CallType && frame.MessageID != "" && errors.As(err, &ocppErr) {
+			s.sendCallError(charger, frame.MessageID, ocppErr)
+		}
+		return nil
 	}
 
-	messageType := int(msg[0].(float64))
-	messageID := msg[1].(string)
+	log.Printf("Received from %s: %s", charger.ID, data)
 
-	log.Printf("Received from %s: %v", charger.ID, msg)
+	switch frame.Type {
+	case ocpp16.CallType:
+		return charger.enqueueCall(frame)
 
-	switch messageType {
-	case CALL:
-		if len(msg) < 3 {
-			log.Printf("Invalid CALL message from %s", charger.ID)
-			return
-		}
-		action := msg[2].(string)
-		/*var payload map[string]interface{}
-		if len(msg) > 3 {
-			payload = msg[3].(map[string]interface{})
-		}*/
-		var payload map[string]interface{}
-		if len(msg) > 3 {
-			if msg[3] != nil {
-				payload, _ = msg[3].(map[string]interface{})
-			} else {
-				// Only log for actions that expect a payload
-				if action != "Heartbeat" {
-					log.Println("⚠️ Received nil payload")
-				}
-				payload = make(map[string]interface{})
-			}
-		} else {
-			if action != "Heartbeat" {
-				log.Println("⚠️ Message does not contain a payload")
-			}
-			payload = make(map[string]interface{})
-		}
+	case ocpp16.CallResultType:
+		log.Printf("Received CALLRESULT from %s", charger.ID)
+		s.resolvePendingCall(charger, frame.MessageID, callResponse{payload: frame.Payload})
 
-		response := s.handleCall(charger.ID, action, payload)
-		s.sendCallResult(charger, messageID, response)
+	case ocpp16.CallErrorType:
+		log.Printf("Received CALLERROR from %s: %v", charger.ID, frame.Error)
+		s.resolvePendingCall(charger, frame.MessageID, callResponse{err: frame.Error})
+	}
+	return nil
+}
 
-	case CALLRESULT:
-		log.Printf("Received CALLRESULT from %s", charger.ID)
+// handleCallFrame answers a CALL from the charger
+func (s *OCPPServer) handleCallFrame(charger *Charger, frame *ocpp16.Frame) {
+	// Until its BootNotification is accepted a charger may not send anything else
+	if frame.Action != "BootNotification" && charger.RegistrationStatus() != ocpp16.RegistrationStatusAccepted {
+		log.Printf("Refused %s from %s: charger not accepted", frame.Action, charger.ID)
+		s.sendCallError(charger, frame.MessageID, ocpp16.NewError(ocpp16.SecurityError, "charge point is not accepted by the central system"))
+		return
+	}
 
-	case CALLERROR:
-		log.Printf("Received CALLERROR from %s: %v", charger.ID, msg)
+	request, err := ocpp16.ParseRequest(frame.Action, frame.Payload)
+	if err != nil {
+		log.Printf("Rejected %s from %s: %v", frame.Action, charger.ID, err)
+		s.sendCallError(charger, frame.MessageID, toOCPPError(err))
+		return
+	}
+
+	response, err := s.handleCall(charger.ID, request)
+	if err != nil {
+		log.Printf("Failed to handle %s from %s: %v", frame.Action, charger.ID, err)
+		s.sendCallError(charger, frame.MessageID, toOCPPError(err))
+		return
+	}
+	s.sendCallResult(charger, frame.MessageID, response)
+	s.deliverTriggered(charger, request)
+	s.afterCall(charger.ID, request)
+}
+
+// afterCall runs the follow-ups of a 1.6 or 2.0.1 CALL that must only reach the
+// charger after our answer, e.g. a TxProfile for the transaction it just started
+func (s *OCPPServer) afterCall(chargerID string, request ocpp16.Request) {
+	s.resyncLocalListOnce(chargerID)
+
+	switch req := request.(type) {
+	case *ocpp16.StartTransactionRequest, *ocpp16.StopTransactionRequest:
+		s.rebalance(chargerID)
+	case *ocpp201.TransactionEventRequest:
+		if req.EventType != ocpp201.TransactionEventUpdated {
+			s.rebalance(chargerID)
+		}
+	case *ocpp16.BootNotificationRequest, *ocpp201.BootNotificationRequest:
+		if charger := s.getCharger(chargerID); charger != nil && charger.RegistrationStatus() == ocpp16.RegistrationStatusAccepted {
+			go s.resyncConfiguration(chargerID)
+		}
 	}
 }
 
-// handleCall processes OCPP call messages
-func (s *OCPPServer) handleCall(chargerID, action string, payload map[string]interface{}) map[string]interface{} {
-	switch action {
-	case "BootNotification":
-		return s.handleBootNotification(chargerID, payload)
-	case "Heartbeat":
-		return s.handleHeartbeat(chargerID, payload)
-	case "StatusNotification":
-		return s.handleStatusNotification(chargerID, payload)
-	case "Authorize":
-		return s.handleAuthorize(chargerID, payload)
-	case "StartTransaction":
-		return s.handleStartTransaction(chargerID, payload)
-	case "StopTransaction":
-		return s.handleStopTransaction(chargerID, payload)
-	case "MeterValues":
-		return s.handleMeterValues(chargerID, payload)
+// handleCall dispatches a validated OCPP request to its handler
+func (s *OCPPServer) handleCall(chargerID string, request ocpp16.Request) (ocpp16.Confirmation, error) {
+	switch req := request.(type) {
+	case *ocpp16.BootNotificationRequest:
+		return s.handleBootNotification(chargerID, req)
+	case *ocpp16.HeartbeatRequest:
+		return s.handleHeartbeat(chargerID, req), nil
+	case *ocpp16.StatusNotificationRequest:
+		return s.handleStatusNotification(chargerID, req), nil
+	case *ocpp16.AuthorizeRequest:
+		return s.handleAuthorize(chargerID, req)
+	case *ocpp16.StartTransactionRequest:
+		return s.handleOnce(chargerID, req, ocpp16.ParseConfirmation, func() (ocpp16.Confirmation, error) { return s.handleStartTransaction(chargerID, req) })
+	case *ocpp16.StopTransactionRequest:
+		return s.handleOnce(chargerID, req, ocpp16.ParseConfirmation, func() (ocpp16.Confirmation, error) { return s.handleStopTransaction(chargerID, req) })
+	case *ocpp16.MeterValuesRequest:
+		return s.handleOnce(chargerID, req, ocpp16.ParseConfirmation, func() (ocpp16.Confirmation, error) { return s.handleMeterValues(chargerID, req) })
+	case *ocpp16.DataTransferRequest:
+		return s.handleDataTransfer(chargerID, req)
+	case *ocpp16.FirmwareStatusNotificationRequest:
+		return s.handleFirmwareStatusNotification(chargerID, req), nil
+	case *ocpp16.DiagnosticsStatusNotificationRequest:
+		return s.handleDiagnosticsStatusNotification(chargerID, req), nil
 	default:
-		log.Printf("Unknown action %s from %s", action, chargerID)
-		return map[string]interface{}{"status": "Rejected"}
+		log.Printf("Unsupported action %s from %s", request.Action(), chargerID)
+		return nil, ocpp16.NewError(ocpp16.NotImplemented, "action %s is not implemented", request.Action())
 	}
 }
 
+// toOCPPError converts a handler error into the error sent back in a CALLERROR
+func toOCPPError(err error) *ocpp16.Error {
+	var ocppErr *ocpp16.Error
+	if errors.As(err, &ocppErr) {
+		return ocppErr
+	}
+	return ocpp16.NewError(ocpp16.InternalError, "%v", err)
+}
+
 // OCPP Message Handlers
-func (s *OCPPServer) handleBootNotification(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	log.Printf("Boot notification from %s: %v", chargerID, payload)
-	return map[string]interface{}{
-		"status":      "Accepted",
-		"currentTime": time.Now().UTC().Format(time.RFC3339),
-		"interval":    300, // Heartbeat interval in seconds
+func (s *OCPPServer) handleBootNotification(chargerID string, req *ocpp16.BootNotificationRequest) (*ocpp16.BootNotificationConfirmation, error) {
+	log.Printf("Boot notification from %s: %+v", chargerID, req)
+
+	ctx := context.Background()
+	status, err := registrationStatus(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	if status == ocpp16.RegistrationStatusPending {
+		recordPendingBoot(ctx, chargerID, req)
+	}
+	interval := bootInterval(status)
+	if charger := s.getCharger(chargerID); charger != nil {
+		charger.setRegistrationStatus(status)
+		charger.setHeartbeatInterval(time.Duration(interval) * time.Second)
 	}
+	log.Printf("Registration of %s: %s", chargerID, status)
+
+	err = db.SaveChargerInfo(ctx, &models.ChargerInfo{
+		ChargerID:               chargerID,
+		Vendor:                  req.ChargePointVendor,
+		Model:                   req.ChargePointModel,
+		ChargePointSerialNumber: req.ChargePointSerialNumber,
+		ChargeBoxSerialNumber:   req.ChargeBoxSerialNumber,
+		FirmwareVersion:         req.FirmwareVersion,
+		Iccid:                   req.Iccid,
+		Imsi:                    req.Imsi,
+		MeterType:               req.MeterType,
+		MeterSerialNumber:       req.MeterSerialNumber,
+		LastBootAt:              time.Now(),
+	})
+	if err != nil {
+		log.Printf("DB update error for charger %s: %v", chargerID, err)
+	}
+
+	return &ocpp16.BootNotificationConfirmation{
+		Status:      status,
+		CurrentTime: ocpp16.DateTime{Time: time.Now()},
+		Interval:    interval,
+	}, nil
 }
 
-func (s *OCPPServer) handleHeartbeat(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	return map[string]interface{}{
-		"currentTime": time.Now().UTC().Format(time.RFC3339),
+func (s *OCPPServer) handleHeartbeat(chargerID string, req *ocpp16.HeartbeatRequest) *ocpp16.HeartbeatConfirmation {
+	return &ocpp16.HeartbeatConfirmation{
+		CurrentTime: ocpp16.DateTime{Time: time.Now()},
 	}
 }
 
@@ -215,168 +360,294 @@ func updateChargerStatus(chargerID string, status string) error {
 	return db.UpdateChargerStatus(ctx, chargerID, status)
 }
 
-func (s *OCPPServer) handleStatusNotification(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	var connectorID int
-	log.Printf("DEBUG: Full payload from %s: %+v", chargerID, payload)
-	if v, ok := payload["connectorId"]; ok && v != nil {
-		switch val := v.(type) {
-		case float64:
-			connectorID = int(val)
-		case int:
-			connectorID = val
-		case string:
-			if parsed, err := strconv.Atoi(val); err == nil {
-				connectorID = parsed
-			} else {
-				log.Printf("StatusNotification: connectorId string cannot be parsed to int: %v", val)
-			}
-		default:
-			log.Printf("StatusNotification: connectorId has unexpected type %T: %v", val, val)
-		}
-	} else {
-		log.Printf("StatusNotification: connectorId missing or nil")
-	}
-
-	var status string
-	if v, ok := payload["status"]; ok && v != nil {
-		if s, ok := v.(string); ok {
-			status = s
-		} else {
-			// Try to convert to string if it's not a string type
-			status = fmt.Sprintf("%v", v)
-			log.Printf("StatusNotification: status was not string type, converted from %T: %v", v, v)
+func (s *OCPPServer) handleStatusNotification(chargerID string, req *ocpp16.StatusNotificationRequest) *ocpp16.StatusNotificationConfirmation {
+	log.Printf("Status from %s connector %d: %s (%s)", chargerID, req.ConnectorId, req.Status, req.ErrorCode)
+
+	timestamp := time.Now()
+	if req.Timestamp != nil {
+		timestamp = req.Timestamp.Time
+	}
+	recorded, err := db.UpdateConnectorStatus(context.Background(), &models.Connector{
+		ChargerID:       chargerID,
+		ConnectorID:     req.ConnectorId,
+		Status:          string(req.Status),
+		ErrorCode:       string(req.ErrorCode),
+		Info:            req.Info,
+		VendorID:        req.VendorId,
+		VendorErrorCode: req.VendorErrorCode,
+		Timestamp:       timestamp,
+	})
+	if err != nil {
+		log.Printf("DB update error for charger %s connector %d: %v", chargerID, req.ConnectorId, err)
+	} else if !recorded {
+		// A notification replayed after a newer one no longer describes the connector
+		log.Printf("Ignoring status of %s connector %d from %s, superseded by a later notification", chargerID, req.ConnectorId, timestamp.Format(time.RFC3339))
+		return &ocpp16.StatusNotificationConfirmation{}
+	}
+
+	s.events.publish(Event{
+		Type:      EventConnectorStatus,
+		ChargerID: chargerID,
+		Timestamp: timestamp,
+		Data: map[string]interface{}{
+			"connector_id": req.ConnectorId,
+			"status":       req.Status,
+			"error_code":   req.ErrorCode,
+			"info":         req.Info,
+		},
+	})
+
+	if s.loadManager.StatusChanged(chargerID, req.ConnectorId, string(req.Status)) {
+		s.rebalance(chargerID)
+	}
+
+	// Connector 0 reports on the charge point as a whole
+	if req.ConnectorId == 0 {
+		err := updateChargerStatus(chargerID, string(req.Status))
+		if err != nil {
+			log.Printf("DB update error for charger %s: %v", chargerID, err)
 		}
-	} else {
-		log.Printf("StatusNotification: status missing or nil")
 	}
 
-	log.Printf("Status from %s connector %d: %s", chargerID, connectorID, status)
+	return &ocpp16.StatusNotificationConfirmation{}
+}
+
+func (s *OCPPServer) handleAuthorize(chargerID string, req *ocpp16.AuthorizeRequest) (*ocpp16.AuthorizeConfirmation, error) {
+	log.Printf("Authorization request from %s for tag: %s", chargerID, req.IdTag)
 
-	// Update status into database
-	err := updateChargerStatus(chargerID, status)
+	ctx := context.Background()
+	info, _, err := authorizeIdTag(ctx, req.IdTag, time.Now())
 	if err != nil {
-		log.Printf("DB update error for charger %s: %v", chargerID, err)
+		return nil, err
+	}
+	if err := checkConcurrentTx(ctx, req.IdTag, &info); err != nil {
+		return nil, err
 	}
 
-	return map[string]interface{}{}
+	return &ocpp16.AuthorizeConfirmation{IdTagInfo: info}, nil
 }
-func (s *OCPPServer) handleAuthorize(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	idTag := payload["idTag"].(string)
-	log.Printf("Authorization request from %s for tag: %s", chargerID, idTag)
 
-	// Simple authorization logic
-	status := "Invalid"
-	if len(idTag) >= 5 && idTag[:5] == "VALID" {
-		status = "Accepted"
+func (s *OCPPServer) handleStartTransaction(chargerID string, req *ocpp16.StartTransactionRequest) (*ocpp16.StartTransactionConfirmation, error) {
+	ctx := context.Background()
+	// A StartTransaction queued while the charger was offline is judged as of when
+	// the session started
+	info, userID, err := authorizeIdTag(ctx, req.IdTag, req.Timestamp.Time)
+	if err != nil {
+		return nil, err
 	}
 
-	return map[string]interface{}{
-		"idTagInfo": map[string]interface{}{
-			"status": status,
-		},
+	// A replay of a StartTransaction that was already recorded gets the same transactionId
+	tx, err := db.FindStartedTransaction(ctx, chargerID, req.ConnectorId, req.IdTag, req.MeterStart, req.Timestamp.Time)
+	switch {
+	case err == nil:
+		log.Printf("StartTransaction from %s repeats transaction %d", chargerID, tx.ID)
+		return &ocpp16.StartTransactionConfirmation{
+			TransactionId: int(tx.ID),
+			IdTagInfo:     info,
+		}, nil
+	case !errors.Is(err, db.ErrTransactionNotFound):
+		return nil, err
+	}
+
+	if err := checkConcurrentTx(ctx, req.IdTag, &info); err != nil {
+		return nil, err
 	}
-}
 
-var lastTransactionIDs = make(map[string]int)
-var lastTransactionMu sync.RWMutex
+	// The transaction is recorded even when the idTag is refused: the charger
+	// needs a transactionId and will stop the session itself.
+	tx = &models.Transaction{
+		ChargerID:     chargerID,
+		ConnectorID:   req.ConnectorId,
+		IdTag:         req.IdTag,
+		UserID:        userID,
+		ReservationID: req.ReservationId,
+		MeterStart:    req.MeterStart,
+		StartedAt:     req.Timestamp.Time,
+		Status:        models.TransactionStatusActive,
+	}
+	if err := db.CreateTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	log.Printf("Starting transaction %d on %s connector %d (idTag: %s, %s)", tx.ID, chargerID, req.ConnectorId, req.IdTag, info.Status)
+	useReservation(ctx, chargerID, req.ReservationId, tx.ID)
+	s.events.publish(Event{Type: EventTransactionStarted, ChargerID: chargerID, Timestamp: tx.StartedAt, Data: tx})
+	if info.Status == ocpp16.AuthorizationStatusAccepted {
+		s.startLoadSession(ctx, tx)
+	}
 
-func getLastTransactionId(chargerID string) int {
-	lastTransactionMu.RLock()
-	defer lastTransactionMu.RUnlock()
-	return lastTransactionIDs[chargerID]
+	return &ocpp16.StartTransactionConfirmation{
+		TransactionId: int(tx.ID),
+		IdTagInfo:     info,
+	}, nil
 }
 
-func (s *OCPPServer) handleStartTransaction(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	connectorID, ok := payload["connectorId"].(float64)
-	if !ok {
-		log.Printf("StartTransaction: missing or invalid connectorId: %v", payload["connectorId"])
-		return map[string]interface{}{
-			"idTagInfo": map[string]interface{}{
-				"status": "Rejected",
-			},
-		}
+func (s *OCPPServer) handleStopTransaction(chargerID string, req *ocpp16.StopTransactionRequest) (*ocpp16.StopTransactionConfirmation, error) {
+	log.Printf("Stopping transaction %d on %s", req.TransactionId, chargerID)
+
+	ctx := context.Background()
+	tx, err := db.StopTransaction(ctx, chargerID, int64(req.TransactionId), req.MeterStop, req.Timestamp.Time, req.IdTag, string(req.Reason))
+	stopped := err == nil
+	if errors.Is(err, db.ErrTransactionNotFound) {
+		tx, stopped, err = reconcileStopTransaction(ctx, chargerID, req)
 	}
-	idTag, ok := payload["idTag"].(string)
-	if !ok {
-		log.Printf("StartTransaction: missing or invalid idTag: %v", payload["idTag"])
-		return map[string]interface{}{
-			"idTagInfo": map[string]interface{}{
-				"status": "Rejected",
-			},
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	transactionID := int(time.Now().Unix())
-	log.Printf("Starting transaction %d on %s connector %d (idTag: %s)", transactionID, chargerID, int(connectorID), idTag)
+	// The transaction data of a transaction stopped before was recorded with its first stop
+	if stopped {
+		s.loadManager.SessionStopped(chargerID, int(tx.ID))
 
-	// Store transaction ID
-	lastTransactionMu.Lock()
-	lastTransactionIDs[chargerID] = transactionID
-	lastTransactionMu.Unlock()
+		// The charger drops the TxProfiles of a transaction once it ends
+		if err := db.DeleteTransactionProfiles(ctx, chargerID, int(tx.ID)); err != nil {
+			log.Printf("DB update error for charger %s: %v", chargerID, err)
+		}
 
-	return map[string]interface{}{
-		"transactionId": transactionID,
-		"idTagInfo": map[string]interface{}{
-			"status": "Accepted",
-		},
+		values := meterValueRows(chargerID, tx.ConnectorID, &tx.ID, req.TransactionData)
+		if err := db.InsertMeterValues(ctx, values); err != nil {
+			return nil, err
+		}
+		s.events.publish(Event{Type: EventTransactionStopped, ChargerID: chargerID, Timestamp: req.Timestamp.Time, Data: tx})
 	}
+
+	// idTagInfo is only returned when the charger reported the idTag that stopped the session
+	conf := &ocpp16.StopTransactionConfirmation{}
+	if req.IdTag != "" {
+		info, _, err := authorizeIdTag(ctx, req.IdTag, req.Timestamp.Time)
+		if err != nil {
+			return nil, err
+		}
+		conf.IdTagInfo = &info
+	}
+	return conf, nil
 }
 
-func (s *OCPPServer) handleStopTransaction(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	transactionID := int(payload["transactionId"].(float64))
-	log.Printf("Stopping transaction %d on %s", transactionID, chargerID)
+func (s *OCPPServer) handleMeterValues(chargerID string, req *ocpp16.MeterValuesRequest) (*ocpp16.MeterValuesConfirmation, error) {
+	log.Printf("Meter values from %s connector %d", chargerID, req.ConnectorId)
 
-	// Remove transaction ID
-	lastTransactionMu.Lock()
-	delete(lastTransactionIDs, chargerID)
-	lastTransactionMu.Unlock()
+	var transactionID *int64
+	if req.TransactionId != nil {
+		id := int64(*req.TransactionId)
+		transactionID = &id
+	}
 
-	return map[string]interface{}{
-		"idTagInfo": map[string]interface{}{
-			"status": "Accepted",
-		},
+	values := meterValueRows(chargerID, req.ConnectorId, transactionID, req.MeterValue)
+	s.recordLoadMeterValues(chargerID, req.ConnectorId, values)
+	if err := db.InsertMeterValues(context.Background(), values); err != nil {
+		return nil, err
 	}
+	s.publishMeterValues(chargerID, req.ConnectorId, transactionID, values)
+	return &ocpp16.MeterValuesConfirmation{}, nil
 }
 
-func (s *OCPPServer) handleMeterValues(chargerID string, payload map[string]interface{}) map[string]interface{} {
-	connectorID := int(payload["connectorId"].(float64))
-	log.Printf("Meter values from %s connector %d", chargerID, connectorID)
-	return map[string]interface{}{}
+func (s *OCPPServer) handleDataTransfer(chargerID string, req *ocpp16.DataTransferRequest) (*ocpp16.DataTransferConfirmation, error) {
+	conf, err := s.dataTransfer.Dispatch(context.Background(), chargerID, req)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("DataTransfer from %s for vendor %s (messageId: %s): %s", chargerID, req.VendorId, req.MessageId, conf.Status)
+	return conf, nil
 }
 
 // sendCallResult sends a CALLRESULT message
-func (s *OCPPServer) sendCallResult(charger *Charger, messageID string, payload map[string]interface{}) {
-	response := OCPPMessage{CALLRESULT, messageID, payload}
+func (s *OCPPServer) sendCallResult(charger *Charger, messageID string, payload ocpp16.Confirmation) {
+	response, err := charger.newCallResult(messageID, payload)
+	if err != nil {
+		log.Printf("Error building response to %s: %v", charger.ID, err)
+		s.sendCallError(charger, messageID, ocpp16.NewError(ocpp16.InternalError, "failed to build %s response", payload.Action()))
+		return
+	}
 
-	err := charger.Connection.WriteJSON(response)
+	err = charger.send(response)
 	if err != nil {
 		log.Printf("Error sending response to %s: %v", charger.ID, err)
 		return
 	}
 
-	log.Printf("Sent to %s: %v", charger.ID, response)
+	log.Printf("Sent to %s: %s", charger.ID, response.Payload)
+}
+
+// sendCallError sends a CALLERROR message
+func (s *OCPPServer) sendCallError(charger *Charger, messageID string, callErr *ocpp16.Error) {
+	if charger.Protocol == ocpp201.Subprotocol {
+		callErr = ocpp201.CallError(callErr)
+	}
+	response := ocpp16.NewCallError(messageID, callErr)
+
+	err := charger.send(response)
+	if err != nil {
+		log.Printf("Error sending error to %s: %v", charger.ID, err)
+		return
+	}
+
+	log.Printf("Sent error to %s: %v", charger.ID, callErr)
 }
 
-// SendRemoteCommand sends a command to a specific charger
-func (s *OCPPServer) SendRemoteCommand(chargerID, action string, payload map[string]interface{}) error {
+// SendRemoteCommand sends a command to a specific charger and waits for its answer.
+// The request must belong to the protocol the charger speaks, an ocpp16 or an
+// ocpp201 request; anything else is refused as an invalid command. OCPP 1.5
+// chargers are sent the 1.5 equivalent of an ocpp16 request over SOAP. It returns
+// the decoded confirmation, an *ocpp16.Error if the charger answered with a
+// CALLERROR or an invalid payload, or a context error if no answer arrived within
+// remoteCommandTimeout.
+func (s *OCPPServer) SendRemoteCommand(ctx context.Context, chargerID string, request ocpp16.Request) (ocpp16.Confirmation, error) {
 	s.mutex.RLock()
 	charger, exists := s.chargers[chargerID]
 	s.mutex.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("charger %s not connected", chargerID)
+		if soap := s.getSOAPCharger(chargerID); soap != nil {
+			return s.sendSOAPCommand(ctx, soap, request)
+		}
+		return nil, fmt.Errorf("charger %s: %w", chargerID, errChargerNotConnected)
 	}
 
 	messageID := uuid.New().String()
-	command := OCPPMessage{CALL, messageID, action, payload}
+	command, err := charger.newCall(messageID, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidCommand, err)
+	}
 
-	err := charger.Connection.WriteJSON(command)
+	ctx, cancel := context.WithTimeout(ctx, remoteCommandTimeout)
+	defer cancel()
+
+	// Only one CALL may be outstanding per charger; later ones wait their turn
+	select {
+	case charger.callSlot <- struct{}{}:
+		defer func() { <-charger.callSlot }()
+	case <-charger.closed():
+		return nil, fmt.Errorf("charger %s: %w", chargerID, errChargerNotConnected)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s to %s still queued: %w", request.Action(), chargerID, ctx.Err())
+	}
+
+	call := s.registerPendingCall(charger, messageID, request.Action())
+
+	err = charger.send(command)
 	if err != nil {
-		return fmt.Errorf("failed to send command to %s: %v", chargerID, err)
+		s.removePendingCall(messageID)
+		return nil, fmt.Errorf("failed to send command to %s: %v", chargerID, err)
 	}
 
-	log.Printf("Sent command to %s: %v", chargerID, command)
-	return nil
+	log.Printf("Sent command %s to %s: %s", request.Action(), chargerID, command.Payload)
+
+	select {
+	case resp := <-call.response:
+		if resp.err != nil {
+			return nil, resp.err
+		}
+		return charger.parseResult(call.action, resp.payload)
+	case <-ctx.Done():
+		s.removePendingCall(messageID)
+		return nil, fmt.Errorf("no answer from %s to %s: %w", chargerID, request.Action(), ctx.Err())
+	}
+}
+
+// getCharger returns the connected charger with the given ID, or nil
+func (s *OCPPServer) getCharger(chargerID string) *Charger {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.chargers[chargerID]
 }
 
 // GetConnectedChargers returns list of connected chargers
@@ -388,9 +659,46 @@ func (s *OCPPServer) GetConnectedChargers() []string {
 	for id := range s.chargers {
 		chargers = append(chargers, id)
 	}
+
+	s.soapMu.RLock()
+	defer s.soapMu.RUnlock()
+	for id := range s.soapChargers {
+		if _, ok := s.chargers[id]; !ok {
+			chargers = append(chargers, id)
+		}
+	}
 	return chargers
 }
 
+// writeCommandResponse reports the charger's answer to a remote command to the API client
+func writeCommandResponse(w http.ResponseWriter, action string, response ocpp16.Confirmation, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var callErr *ocpp16.Error
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action":   action,
+			"response": response,
+		})
+	case errors.As(err, &callErr):
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action": action,
+			"error":  callErr,
+		})
+	case errors.Is(err, errInvalidCommand):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errChargerNotConnected):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // CORS middleware
 func enableCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -417,6 +725,11 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the Flusher of streaming handlers
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 // Main function
 func main() {
 	// Initialize DB connection
@@ -424,13 +737,48 @@ func main() {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 
+	secCfg, err := loadSecurityConfig()
+	if err != nil {
+		log.Fatalf("Invalid security configuration: %v", err)
+	}
+
+	liveCfg, err := loadLivenessConfig()
+	if err != nil {
+		log.Fatalf("Invalid liveness configuration: %v", err)
+	}
+
+	files, err := loadFileStore()
+	if err != nil {
+		log.Fatalf("Invalid file store configuration: %v", err)
+	}
+
 	// Create OCPP server
 	server := NewOCPPServer()
+	server.files = files
+	server.defaultSecurityProfile = secCfg.DefaultProfile
+	server.pingInterval = liveCfg.PingInterval
+	registerVendorExtensions(server.dataTransfer)
+	go server.sweepSilentChargers(context.Background(), liveCfg.SweepInterval)
+	go server.sweepReservations(context.Background(), reservationSweepInterval)
+	go pruneProcessedMessages(context.Background(), processedMessagePruneInterval)
+
+	// Load management starts from the stored sites and the sessions still running
+	if err := server.restoreLoadSessions(context.Background()); err != nil {
+		log.Printf("Failed to restore load-management sessions: %v", err)
+	}
+	if err := server.reloadSites(context.Background()); err != nil {
+		log.Printf("Failed to load sites: %v", err)
+	}
 
 	// Setup HTTP handlers
 	mux := http.NewServeMux()
 	// Register WebSocket handler directly (do NOT wrap with logging middleware)
 	mux.HandleFunc("/", server.HandleWebSocket)
+	// OCPP 1.5 charge points speak SOAP over plain HTTP requests
+	mux.HandleFunc(soapPath, server.HandleSOAP)
+	// Files exchanged with chargers by the Firmware Management profile
+	mux.HandleFunc("/files/firmware/{name}", server.handleFirmwareFile)
+	mux.HandleFunc("/files/diagnostics/{job}/{token}", server.handleDiagnosticsUpload)
 
 	// API endpoints
 	apiMux := http.NewServeMux()
@@ -460,11 +808,16 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		if !requireOperator(w, r) {
+			return
+		}
 
 		// Define request struct and limit body size
 		type chargerCommandRequest struct {
-			ChargerID ChargerID `json:"chargerId"`
-			Command   string    `json:"command"`
+			ChargerID   ChargerID `json:"chargerId"`
+			Command     string    `json:"command"`
+			ConnectorID *int      `json:"connectorId,omitempty"`
+			IdTag       string    `json:"idTag,omitempty"`
 		}
 		var req chargerCommandRequest
 		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
@@ -475,46 +828,95 @@ func main() {
 		}
 		log.Printf("Received charger command: %+v", req)
 
-		var action string
-		var payload map[string]interface{}
+		var command ocpp16.Request
 		switch req.Command {
 		case "start":
-			action = "RemoteStartTransaction"
-			payload = map[string]interface{}{
-				"connectorId": 1,
-				"idTag":       "123456", // You may want to customize this
+			// Defaults kept for the dashboard; /api/chargers/{id}/remote-start takes the full request
+			connectorID := 1
+			if req.ConnectorID != nil {
+				connectorID = *req.ConnectorID
+			}
+			idTag := "123456"
+			if req.IdTag != "" {
+				idTag = req.IdTag
+			}
+			command = &ocpp16.RemoteStartTransactionRequest{
+				ConnectorId: &connectorID,
+				IdTag:       idTag,
 			}
 		case "stop":
-			action = "RemoteStopTransaction"
-			// Look up last transactionId for this charger
-			lastTransactionMu.RLock()
-			transactionId := lastTransactionIDs[string(req.ChargerID)]
-			lastTransactionMu.RUnlock()
-			if transactionId == 0 {
+			// Look up the running transaction for this charger
+			tx, err := db.GetActiveTransaction(r.Context(), string(req.ChargerID))
+			if errors.Is(err, db.ErrTransactionNotFound) {
 				http.Error(w, "No active transaction for this charger", http.StatusBadRequest)
 				return
 			}
-			payload = map[string]interface{}{
-				"transactionId": transactionId,
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			command = &ocpp16.RemoteStopTransactionRequest{
+				TransactionId: int(tx.ID),
 			}
 		default:
 			http.Error(w, "Unknown command", http.StatusBadRequest)
 			return
 		}
 
-		err := server.SendRemoteCommand(string(req.ChargerID), action, payload)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"sent"}`))
+		response, err := server.SendRemoteCommand(r.Context(), string(req.ChargerID), command)
+		writeCommandResponse(w, command.Action(), response, err)
 	})
 
+	apiMux.HandleFunc("/api/chargers/{id}", server.handleChargerDetail)
+	apiMux.HandleFunc("/api/chargers/{id}/security", server.handleChargerSecurity)
+	apiMux.HandleFunc("/api/chargers/{id}/charging-profiles", server.handleChargingProfiles)
+	apiMux.HandleFunc("/api/chargers/{id}/update-firmware", server.handleUpdateFirmware)
+	apiMux.HandleFunc("/api/chargers/{id}/get-diagnostics", server.handleGetDiagnostics)
+	apiMux.HandleFunc("/api/chargers/{id}/jobs", server.handleJobs)
+	apiMux.HandleFunc("/api/chargers/{id}/local-list", server.handleLocalList)
+	apiMux.HandleFunc("/api/chargers/{id}/local-list/sync", server.handleLocalListSync)
+	apiMux.HandleFunc("/api/chargers/{id}/reservations", server.handleChargerReservations)
+	apiMux.HandleFunc("/api/chargers/{id}/trigger-message", server.handleTriggerMessage)
+	apiMux.HandleFunc("/api/chargers/{id}/configuration", server.handleChargerConfiguration)
+	apiMux.HandleFunc("/api/chargers/{id}/configuration/sync", server.handleChargerConfigurationSync)
+	apiMux.HandleFunc("/api/chargers/{id}/data-transfer/{vendor}/{message}", server.handleVendorDataTransfer)
+	apiMux.HandleFunc("/api/chargers/{id}/connectors/{connector}/meter-values", server.handleConnectorMeterValues)
+	apiMux.HandleFunc("/api/transactions/{id}/meter-values", server.handleTransactionMeterValues)
+	apiMux.HandleFunc("/api/events", server.handleEventStream)
+	apiMux.HandleFunc("/api/reservations", server.handleReservations)
+	apiMux.HandleFunc("/api/reservations/{id}", server.handleReservation)
+	apiMux.HandleFunc("/api/configuration-templates", server.handleConfigTemplates)
+	apiMux.HandleFunc("/api/configuration-templates/{id}", server.handleConfigTemplate)
+	apiMux.HandleFunc("/api/data-transfer", server.handleDataTransferMessages)
+	apiMux.HandleFunc("/api/firmware", server.handleFirmwareImages)
+	apiMux.HandleFunc("/api/firmware/{name}", server.handleFirmwareImage)
+	apiMux.HandleFunc("/api/firmware-rollouts", server.handleFirmwareRollout)
+	apiMux.HandleFunc("/api/jobs", server.handleJobs)
+	apiMux.HandleFunc("/api/jobs/{id}/file", server.handleJobFile)
+	apiMux.HandleFunc("/api/sites", server.handleSites)
+	apiMux.HandleFunc("/api/sites/{id}", server.handleSite)
+	apiMux.HandleFunc("/api/sites/{id}/status", server.handleSiteStatus)
+	apiMux.HandleFunc("/api/registrations", server.handleRegistrations)
+	apiMux.HandleFunc("/api/registrations/{id}/accept", server.registrationDecisionHandler(ocpp16.RegistrationStatusAccepted))
+	apiMux.HandleFunc("/api/registrations/{id}/reject", server.registrationDecisionHandler(ocpp16.RegistrationStatusRejected))
+	server.registerCommandRoutes(apiMux)
+
 	// Mount API mux with logging middleware
 	mux.Handle("/api/", loggingMiddleware(apiMux))
 
+	// Security profiles 2 and 3 connect to the TLS endpoint
+	if secCfg.TLSEnabled() {
+		tlsConfig, err := secCfg.TLSConfig()
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		tlsServer := &http.Server{Addr: secCfg.TLSAddr, Handler: mux, TLSConfig: tlsConfig}
+		go func() {
+			log.Printf("OCPP TLS Server starting on %s", secCfg.TLSAddr)
+			log.Fatal(tlsServer.ListenAndServeTLS(secCfg.CertFile, secCfg.KeyFile))
+		}()
+	}
+
 	log.Println("OCPP Server starting on :9000")
 	log.Fatal(http.ListenAndServe(":9000", mux))
 }
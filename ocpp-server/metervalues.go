@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// OCPP 1.6 defaults of the optional sampledValue fields
+const (
+	defaultReadingContext = "Sample.Periodic"
+	defaultValueFormat    = "Raw"
+	defaultLocation       = "Outlet"
+	signedDataFormat      = "SignedData"
+)
+
+// measurandUnits is the unit of each measurand when the charger leaves it out
+var measurandUnits = map[ocpp16.Measurand]string{
+	ocpp16.MeasurandEnergyActiveExportRegister:   "Wh",
+	ocpp16.MeasurandEnergyActiveImportRegister:   "Wh",
+	ocpp16.MeasurandEnergyReactiveExportRegister: "varh",
+	ocpp16.MeasurandEnergyReactiveImportRegister: "varh",
+	ocpp16.MeasurandEnergyActiveExportInterval:   "Wh",
+	ocpp16.MeasurandEnergyActiveImportInterval:   "Wh",
+	ocpp16.MeasurandEnergyReactiveExportInterval: "varh",
+	ocpp16.MeasurandEnergyReactiveImportInterval: "varh",
+	ocpp16.MeasurandPowerActiveExport:            "W",
+	ocpp16.MeasurandPowerActiveImport:            "W",
+	ocpp16.MeasurandPowerOffered:                 "W",
+	ocpp16.MeasurandPowerReactiveExport:          "var",
+	ocpp16.MeasurandPowerReactiveImport:          "var",
+	ocpp16.MeasurandCurrentImport:                "A",
+	ocpp16.MeasurandCurrentExport:                "A",
+	ocpp16.MeasurandCurrentOffered:               "A",
+	ocpp16.MeasurandVoltage:                      "V",
+	ocpp16.MeasurandFrequency:                    "Hz",
+	ocpp16.MeasurandTemperature:                  "Celsius",
+	ocpp16.MeasurandSoC:                          "Percent",
+}
+
+// normalizeValue converts a value in an OCPP unit to its SI counterpart: kilo
+// units to their base unit, Percent to % and temperatures to Celsius. Other
+// units are kept.
+func normalizeValue(value float64, unit string) (float64, string) {
+	switch unit {
+	case "kWh", "kW", "kvarh", "kvar", "kVA":
+		return value * 1000, unit[1:]
+	case "Percent":
+		return value, "%"
+	case "Fahrenheit":
+		return (value - 32) * 5 / 9, "Celsius"
+	case "K":
+		return value - 273.15, "Celsius"
+	default:
+		return value, unit
+	}
+}
+
+// sampledValueSI returns a 1.6 sampled value in its SI unit. Signed data and
+// values that are not numbers have none.
+func sampledValueSI(sv ocpp16.SampledValue) (float64, string, bool) {
+	if sv.Format == signedDataFormat {
+		return 0, "", false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(sv.Value), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	unit := sv.Unit
+	if unit == "" {
+		unit = measurandUnits[measurandOf(sv)]
+	}
+	value, unit = normalizeValue(value, unit)
+	return value, unit, true
+}
+
+// measurandOf returns the measurand of a sampled value, which defaults to the
+// active energy register
+func measurandOf(sv ocpp16.SampledValue) ocpp16.Measurand {
+	if sv.Measurand == "" {
+		return ocpp16.MeasurandEnergyActiveImportRegister
+	}
+	return sv.Measurand
+}
+
+// meterValueRows flattens OCPP meter values into one row per sampled value,
+// spelling out the defaults 1.6 leaves implicit
+func meterValueRows(chargerID string, connectorID int, transactionID *int64, meterValues []ocpp16.MeterValue) []models.MeterValue {
+	var rows []models.MeterValue
+	for _, mv := range meterValues {
+		for _, sv := range mv.SampledValue {
+			row := models.MeterValue{
+				TransactionID: transactionID,
+				ChargerID:     chargerID,
+				ConnectorID:   connectorID,
+				Timestamp:     mv.Timestamp.Time,
+				Value:         sv.Value,
+				Context:       valueOr(sv.Context, defaultReadingContext),
+				Format:        valueOr(sv.Format, defaultValueFormat),
+				Measurand:     string(measurandOf(sv)),
+				Phase:         sv.Phase,
+				Location:      valueOr(sv.Location, defaultLocation),
+				Unit:          valueOr(sv.Unit, measurandUnits[measurandOf(sv)]),
+			}
+			if value, unit, ok := sampledValueSI(sv); ok {
+				row.SIValue, row.SIUnit = &value, unit
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// publishMeterValues publishes the live readings of a connector, in SI units
+func (s *OCPPServer) publishMeterValues(chargerID string, connectorID int, transactionID *int64, values []models.MeterValue) {
+	if len(values) == 0 {
+		return
+	}
+	s.events.publish(Event{
+		Type:      EventMeterValues,
+		ChargerID: chargerID,
+		Data: map[string]interface{}{
+			"connector_id":   connectorID,
+			"transaction_id": transactionID,
+			"meter_values":   values,
+		},
+	})
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// meterValueFilter reads the measurand, phase, from and to query parameters
+// shared by the meter value endpoints
+func meterValueFilter(r *http.Request) (db.MeterValueFilter, error) {
+	query := r.URL.Query()
+	filter := db.MeterValueFilter{
+		Measurand: query.Get("measurand"),
+		Phase:     query.Get("phase"),
+	}
+	for name, field := range map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s", name)
+		}
+		*field = &t
+	}
+	return filter, nil
+}
+
+// handleTransactionMeterValues serves the meter values of a transaction with the
+// latest value of each measurand and phase, e.g. SoC, power, current per phase
+// and the energy register
+func (s *OCPPServer) handleTransactionMeterValues(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid transaction id", http.StatusBadRequest)
+		return
+	}
+	filter, err := meterValueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.TransactionID = &id
+	writeMeterValues(w, r, filter)
+}
+
+// handleConnectorMeterValues serves the meter values of a connector, like
+// handleTransactionMeterValues
+func (s *OCPPServer) handleConnectorMeterValues(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	connectorID, err := strconv.Atoi(r.PathValue("connector"))
+	if err != nil {
+		http.Error(w, "invalid connector id", http.StatusBadRequest)
+		return
+	}
+	filter, err := meterValueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.ChargerID = r.PathValue("id")
+	filter.ConnectorID = &connectorID
+	writeMeterValues(w, r, filter)
+}
+
+func writeMeterValues(w http.ResponseWriter, r *http.Request, filter db.MeterValueFilter) {
+	values, err := db.ListMeterValues(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	latest, err := db.LatestMeterValues(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"meter_values": values,
+		"latest":       latest,
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		value    float64
+		unit     string
+		want     float64
+		wantUnit string
+	}{
+		{value: 12.5, unit: "kWh", want: 12500, wantUnit: "Wh"},
+		{value: 7.4, unit: "kW", want: 7400, wantUnit: "W"},
+		{value: 1.5, unit: "kvarh", want: 1500, wantUnit: "varh"},
+		{value: 2, unit: "kvar", want: 2000, wantUnit: "var"},
+		{value: 11, unit: "kVA", want: 11000, wantUnit: "VA"},
+		{value: 1234, unit: "Wh", want: 1234, wantUnit: "Wh"},
+		{value: 16, unit: "A", want: 16, wantUnit: "A"},
+		{value: 80, unit: "Percent", want: 80, wantUnit: "%"},
+		{value: 212, unit: "Fahrenheit", want: 100, wantUnit: "Celsius"},
+		{value: 300, unit: "K", want: 26.85, wantUnit: "Celsius"},
+		{value: 21, unit: "Celsius", want: 21, wantUnit: "Celsius"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			got, unit := normalizeValue(tt.value, tt.unit)
+			if math.Abs(got-tt.want) > 1e-9 || unit != tt.wantUnit {
+				t.Errorf("normalizeValue(%v, %s) = %v %s, want %v %s", tt.value, tt.unit, got, unit, tt.want, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestMeterValueRows(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	transactionID := int64(7)
+
+	tests := []struct {
+		name   string
+		sample ocpp16.SampledValue
+		want   models.MeterValue
+	}{
+		{
+			name:   "defaults spelled out",
+			sample: ocpp16.SampledValue{Value: "1234"},
+			want: models.MeterValue{
+				Value:     "1234",
+				Context:   "Sample.Periodic",
+				Format:    "Raw",
+				Measurand: "Energy.Active.Import.Register",
+				Location:  "Outlet",
+				Unit:      "Wh",
+				SIValue:   float64Ptr(1234),
+				SIUnit:    "Wh",
+			},
+		},
+		{
+			name: "kilo unit kept as sent, SI value in Wh",
+			sample: ocpp16.SampledValue{
+				Value:     "12.5",
+				Context:   "Transaction.End",
+				Measurand: ocpp16.MeasurandEnergyActiveImportRegister,
+				Unit:      "kWh",
+			},
+			want: models.MeterValue{
+				Value:     "12.5",
+				Context:   "Transaction.End",
+				Format:    "Raw",
+				Measurand: "Energy.Active.Import.Register",
+				Location:  "Outlet",
+				Unit:      "kWh",
+				SIValue:   float64Ptr(12500),
+				SIUnit:    "Wh",
+			},
+		},
+		{
+			name: "phase current with the default unit of its measurand",
+			sample: ocpp16.SampledValue{
+				Value:     " 15.8 ",
+				Measurand: ocpp16.MeasurandCurrentImport,
+				Phase:     "L2",
+			},
+			want: models.MeterValue{
+				Value:     " 15.8 ",
+				Context:   "Sample.Periodic",
+				Format:    "Raw",
+				Measurand: "Current.Import",
+				Phase:     "L2",
+				Location:  "Outlet",
+				Unit:      "A",
+				SIValue:   float64Ptr(15.8),
+				SIUnit:    "A",
+			},
+		},
+		{
+			name: "signed data has no SI value",
+			sample: ocpp16.SampledValue{
+				Value:  "MEUCIQDx",
+				Format: "SignedData",
+			},
+			want: models.MeterValue{
+				Value:     "MEUCIQDx",
+				Context:   "Sample.Periodic",
+				Format:    "SignedData",
+				Measurand: "Energy.Active.Import.Register",
+				Location:  "Outlet",
+				Unit:      "Wh",
+			},
+		},
+		{
+			name:   "value that is not a number has no SI value",
+			sample: ocpp16.SampledValue{Value: "n/a", Measurand: ocpp16.MeasurandSoC},
+			want: models.MeterValue{
+				Value:     "n/a",
+				Context:   "Sample.Periodic",
+				Format:    "Raw",
+				Measurand: "SoC",
+				Location:  "Outlet",
+				Unit:      "Percent",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := meterValueRows("cp1", 2, &transactionID, []ocpp16.MeterValue{{
+				Timestamp:    ocpp16.DateTime{Time: at},
+				SampledValue: []ocpp16.SampledValue{tt.sample},
+			}})
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			want := tt.want
+			want.ChargerID, want.ConnectorID, want.TransactionID, want.Timestamp = "cp1", 2, &transactionID, at
+			expectMeterValue(t, rows[0], want)
+		})
+	}
+}
+
+func TestMeterValueRows201(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		sample ocpp201.SampledValue
+		want   models.MeterValue
+	}{
+		{
+			name:   "defaults spelled out",
+			sample: ocpp201.SampledValue{Value: 1234},
+			want: models.MeterValue{
+				Value:     "1234",
+				Context:   "Sample.Periodic",
+				Format:    "Raw",
+				Measurand: "Energy.Active.Import.Register",
+				Location:  "Outlet",
+				Unit:      "Wh",
+				SIValue:   float64Ptr(1234),
+				SIUnit:    "Wh",
+			},
+		},
+		{
+			name: "value and unit as sent, multiplier applied to the SI value",
+			sample: ocpp201.SampledValue{
+				Value:         12.5,
+				Measurand:     "Energy.Active.Import.Register",
+				UnitOfMeasure: &ocpp201.UnitOfMeasure{Unit: "kWh", Multiplier: 1},
+			},
+			want: models.MeterValue{
+				Value:     "12.5",
+				Context:   "Sample.Periodic",
+				Format:    "Raw",
+				Measurand: "Energy.Active.Import.Register",
+				Location:  "Outlet",
+				Unit:      "kWh",
+				SIValue:   float64Ptr(125000),
+				SIUnit:    "Wh",
+			},
+		},
+		{
+			name: "multiplier without unit",
+			sample: ocpp201.SampledValue{
+				Value:         7,
+				Context:       ocpp201.ReadingContextSamplePeriodic,
+				Measurand:     "Power.Active.Import",
+				Phase:         "L1",
+				UnitOfMeasure: &ocpp201.UnitOfMeasure{Multiplier: 3},
+			},
+			want: models.MeterValue{
+				Value:     "7",
+				Context:   "Sample.Periodic",
+				Format:    "Raw",
+				Measurand: "Power.Active.Import",
+				Phase:     "L1",
+				Location:  "Outlet",
+				Unit:      "W",
+				SIValue:   float64Ptr(7000),
+				SIUnit:    "W",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := meterValueRows201("cs1", 1, nil, []ocpp201.MeterValue{{
+				Timestamp:    ocpp201.DateTime{Time: at},
+				SampledValue: []ocpp201.SampledValue{tt.sample},
+			}})
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			want := tt.want
+			want.ChargerID, want.ConnectorID, want.Timestamp = "cs1", 1, at
+			expectMeterValue(t, rows[0], want)
+		})
+	}
+}
+
+// expectMeterValue compares two rows, SIValue included
+func expectMeterValue(t *testing.T, got, want models.MeterValue) {
+	t.Helper()
+	gotSI, wantSI := got.SIValue, want.SIValue
+	got.SIValue, want.SIValue = nil, nil
+	gotTx, wantTx := got.TransactionID, want.TransactionID
+	got.TransactionID, want.TransactionID = nil, nil
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if gotTx != wantTx {
+		t.Errorf("transaction %v, want %v", gotTx, wantTx)
+	}
+	switch {
+	case (gotSI == nil) != (wantSI == nil):
+		t.Errorf("SI value %v, want %v", gotSI, wantSI)
+	case gotSI != nil && math.Abs(*gotSI-*wantSI) > 1e-9:
+		t.Errorf("SI value %v, want %v", *gotSI, *wantSI)
+	}
+}
+
+func float64Ptr(v float64) *float64 { return &v }
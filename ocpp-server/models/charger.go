@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ChargerInfo holds the identification a charger reported in its last BootNotification
+type ChargerInfo struct {
+	bun.BaseModel           `bun:"table:charger_info" json:"-"`
+	ChargerID               string    `bun:",pk" json:"charger_id"`
+	Vendor                  string    `json:"vendor"`
+	Model                   string    `json:"model"`
+	ChargePointSerialNumber string    `json:"charge_point_serial_number,omitempty"`
+	ChargeBoxSerialNumber   string    `json:"charge_box_serial_number,omitempty"`
+	FirmwareVersion         string    `json:"firmware_version,omitempty"`
+	Iccid                   string    `json:"iccid,omitempty"`
+	Imsi                    string    `json:"imsi,omitempty"`
+	MeterType               string    `json:"meter_type,omitempty"`
+	MeterSerialNumber       string    `json:"meter_serial_number,omitempty"`
+	LastBootAt              time.Time `bun:",notnull" json:"last_boot_at"`
+	UpdatedAt               time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// Connector holds the latest StatusNotification of one connector; connector 0 is the charger itself
+type Connector struct {
+	bun.BaseModel   `bun:"table:connector" json:"-"`
+	ChargerID       string    `bun:",pk" json:"charger_id"`
+	ConnectorID     int       `bun:",pk" json:"connector_id"`
+	Status          string    `bun:",notnull" json:"status"`
+	ErrorCode       string    `bun:",notnull" json:"error_code"`
+	Info            string    `json:"info,omitempty"`
+	VendorID        string    `json:"vendor_id,omitempty"`
+	VendorErrorCode string    `json:"vendor_error_code,omitempty"`
+	Timestamp       time.Time `bun:",notnull" json:"timestamp"`
+	UpdatedAt       time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ChargingProfile is a smart charging profile accepted by a charger. Rows mirror
+// what is installed on the charger: they are written after a SetChargingProfile
+// was accepted and removed once the profile was cleared.
+type ChargingProfile struct {
+	bun.BaseModel     `bun:"table:charging_profile" json:"-"`
+	ID                int64           `bun:",pk,autoincrement" json:"id"`
+	ChargerID         string          `bun:",notnull,unique:charging_profile_charger_profile" json:"charger_id"`
+	ChargingProfileID int             `bun:",notnull,unique:charging_profile_charger_profile" json:"charging_profile_id"`
+	ConnectorID       int             `bun:",notnull" json:"connector_id"`
+	StackLevel        int             `bun:",notnull" json:"stack_level"`
+	Purpose           string          `bun:",notnull" json:"purpose"`
+	Kind              string          `bun:",notnull" json:"kind"`
+	RecurrencyKind    string          `json:"recurrency_kind,omitempty"`
+	TransactionID     *int            `json:"transaction_id,omitempty"`
+	ValidFrom         *time.Time      `json:"valid_from,omitempty"`
+	ValidTo           *time.Time      `json:"valid_to,omitempty"`
+	Schedule          json.RawMessage `bun:"type:jsonb,notnull" json:"schedule"`
+	CreatedAt         time.Time       `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
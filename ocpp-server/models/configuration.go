@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ChargerConfigKey is one configuration key as a charger last reported it in
+// GetConfiguration, with the outcome of the last ChangeConfiguration we sent for it
+type ChargerConfigKey struct {
+	bun.BaseModel `bun:"table:charger_configuration" json:"-"`
+	ChargerID     string     `bun:",pk" json:"charger_id"`
+	Key           string     `bun:",pk" json:"key"`
+	Value         *string    `json:"value"`
+	Readonly      bool       `bun:",notnull" json:"readonly"`
+	Requested     *string    `json:"requested,omitempty"`     // value of the last ChangeConfiguration
+	ChangeStatus  string     `json:"change_status,omitempty"` // Accepted, Rejected, RebootRequired or NotSupported
+	ChangedAt     *time.Time `json:"changed_at,omitempty"`
+	ReportedAt    time.Time  `bun:",notnull" json:"reported_at"`
+}
+
+// ConfigTemplate is the configuration operators want on every charger of a model.
+// An empty Vendor matches the model of any vendor.
+type ConfigTemplate struct {
+	bun.BaseModel `bun:"table:configuration_template" json:"-"`
+	ID            int64             `bun:",pk,autoincrement" json:"id"`
+	Vendor        string            `bun:",notnull,unique:configuration_template_model" json:"vendor"`
+	Model         string            `bun:",notnull,unique:configuration_template_model" json:"model"`
+	Settings      map[string]string `bun:"type:jsonb,notnull" json:"settings"`
+	CreatedAt     time.Time         `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time         `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
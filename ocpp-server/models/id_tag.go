@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// IdTag links an RFID card or token to a user; the table is owned by user_service
+type IdTag struct {
+	bun.BaseModel `bun:"table:id_tag" json:"-"`
+	ID            int64      `bun:",pk,autoincrement" json:"id"`
+	Tag           string     `json:"id_tag"`
+	UserID        int64      `json:"user_id"`
+	Status        string     `json:"status"`
+	ExpiryDate    *time.Time `json:"expiry_date"`
+	ParentIdTag   string     `json:"parent_id_tag,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Status of the owning user, filled by GetIdTag
+	UserStatus string `bun:"user_status,scanonly" json:"-"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Job types
+const (
+	JobTypeFirmware    = "firmware"
+	JobTypeDiagnostics = "diagnostics"
+)
+
+// Job results; an empty result means the job is still running
+const (
+	JobResultSuccess = "success"
+	JobResultFailed  = "failed"
+)
+
+// Job statuses set by the server; the others are the FirmwareStatus and
+// DiagnosticsStatus values reported by the charger
+const (
+	JobStatusRequested = "Requested"
+	JobStatusAccepted  = "Accepted"
+	JobStatusRejected  = "Rejected"
+)
+
+// ChargerJob is one firmware update or diagnostics upload requested from a charger
+type ChargerJob struct {
+	bun.BaseModel `bun:"table:charger_job" json:"-"`
+	ID            int64      `bun:",pk,autoincrement" json:"id"`
+	ChargerID     string     `bun:",notnull" json:"charger_id"`
+	Type          string     `bun:",notnull" json:"type"`
+	RolloutID     string     `json:"rollout_id,omitempty"`
+	Location      string     `bun:",notnull" json:"location"`
+	Firmware      string     `json:"firmware,omitempty"`
+	FileName      string     `json:"file_name,omitempty"`
+	FileSize      int64      `json:"file_size,omitempty"`
+	UploadToken   string     `json:"-"` // secret part of the diagnostics upload location
+	Status        string     `bun:",notnull" json:"status"`
+	Result        string     `json:"result,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// LocalList is the local authorization list last accepted by a charger. Entries
+// keeps the idTagInfo sent per idTag so that later updates can be differential.
+type LocalList struct {
+	bun.BaseModel `bun:"table:local_list" json:"-"`
+	ChargerID     string          `bun:",pk" json:"charger_id"`
+	Version       int             `bun:",notnull" json:"version"`
+	Entries       json.RawMessage `bun:"type:jsonb,notnull" json:"-"`
+	EntryCount    int             `bun:",notnull" json:"entry_count"`
+	LastStatus    string          `json:"last_status,omitempty"`
+	SyncedAt      *time.Time      `json:"synced_at,omitempty"`
+	UpdatedAt     time.Time       `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
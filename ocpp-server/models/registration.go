@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ChargerRegistration records an operator decision on a charge point identity,
+// or a BootNotification from an unknown identity awaiting one
+type ChargerRegistration struct {
+	bun.BaseModel `bun:"table:charger_registration" json:"-"`
+	ChargerID     string     `bun:",pk" json:"charger_id"`
+	Status        string     `bun:",notnull" json:"status"` // Pending, Accepted or Rejected
+	Vendor        string     `json:"vendor,omitempty"`
+	Model         string     `json:"model,omitempty"`
+	FirstSeenAt   time.Time  `bun:",notnull" json:"first_seen_at"`
+	LastSeenAt    time.Time  `bun:",notnull" json:"last_seen_at"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+}
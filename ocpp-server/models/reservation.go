@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Reservation statuses
+const (
+	ReservationStatusScheduled = "Scheduled" // waiting for its window to open
+	ReservationStatusActive    = "Active"    // accepted by the charger
+	ReservationStatusUsed      = "Used"      // a transaction started on it
+	ReservationStatusCancelled = "Cancelled"
+	ReservationStatusExpired   = "Expired"
+	ReservationStatusFailed    = "Failed" // refused by or not sent to the charger
+)
+
+// Reservation holds a connector for an idTag during a time window. Its ID is the
+// reservationId sent in ReserveNow.
+type Reservation struct {
+	bun.BaseModel `bun:"table:reservation" json:"-"`
+	ID            int64     `bun:",pk,autoincrement" json:"id"`
+	ChargerID     string    `bun:",notnull" json:"charger_id"`
+	ConnectorID   int       `bun:",notnull" json:"connector_id"`
+	UserID        *int64    `json:"user_id,omitempty"`
+	IdTag         string    `bun:",notnull" json:"id_tag"`
+	ParentIdTag   string    `json:"parent_id_tag,omitempty"`
+	StartsAt      time.Time `bun:",notnull" json:"starts_at"`
+	ExpiresAt     time.Time `bun:",notnull" json:"expires_at"`
+	Status        string    `bun:",notnull" json:"status"`
+	Error         string    `json:"error,omitempty"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ChargerSecurity is the OCPP 1.6 security profile configured for a charger
+type ChargerSecurity struct {
+	bun.BaseModel `bun:"table:charger_security" json:"-"`
+	ChargerID     string `bun:",pk" json:"charger_id"`
+	// 0: none, 1: HTTP Basic auth, 2: TLS + Basic auth, 3: TLS with client certificate
+	SecurityProfile int `bun:",notnull" json:"security_profile"`
+	// bcrypt hash of the charger's AuthorizationKey, used by profiles 1 and 2
+	PasswordHash string `json:"-"`
+	// Optional hex SHA-256 fingerprint pinning the client certificate of profile 3
+	CertificateFingerprint string    `json:"certificate_fingerprint,omitempty"`
+	UpdatedAt              time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
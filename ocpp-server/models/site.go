@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Site groups chargers sharing a grid connection with a current or power budget
+type Site struct {
+	bun.BaseModel   `bun:"table:site" json:"-"`
+	ID              int64     `bun:",pk,autoincrement" json:"id"`
+	Name            string    `bun:",notnull" json:"name"`
+	Unit            string    `bun:",notnull" json:"unit"` // A or W
+	MaxLimit        float64   `bun:",notnull" json:"max_limit"`
+	MinLimit        float64   `bun:",notnull" json:"min_limit"`
+	MaxPerConnector float64   `bun:",notnull" json:"max_per_connector"`
+	Strategy        string    `bun:",notnull" json:"strategy"` // equal-share, first-come or priority
+	ChargerIDs      []string  `bun:"charger_ids,array" json:"charger_ids"`
+	CreatedAt       time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt       time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
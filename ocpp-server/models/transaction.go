@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Transaction statuses
+const (
+	TransactionStatusActive    = "Active"
+	TransactionStatusCompleted = "Completed"
+)
+
+// Transaction is a charging session reported through StartTransaction/StopTransaction.
+// Its ID is the OCPP transactionId handed back to the charger. OCPP 2.0.1 chargers
+// choose their own transactionId, kept in OCPPTransactionID, as is the unknown
+// transactionId of a session only reported by its StopTransaction.
+// Reconciliation notes how the server resolved StopTransactions that did not
+// match the transaction as recorded.
+type Transaction struct {
+	bun.BaseModel     `bun:"table:transaction" json:"-"`
+	ID                int64      `bun:",pk,autoincrement" json:"id"`
+	OCPPTransactionID *string    `bun:"ocpp_transaction_id" json:"ocpp_transaction_id,omitempty"`
+	ChargerID         string     `bun:",notnull" json:"charger_id"`
+	ConnectorID       int        `bun:",notnull" json:"connector_id"`
+	IdTag             string     `bun:",notnull" json:"id_tag"`
+	UserID            *int64     `json:"user_id,omitempty"` // owner of IdTag, when known
+	ReservationID     *int       `json:"reservation_id,omitempty"`
+	MeterStart        int        `bun:",notnull" json:"meter_start"`
+	MeterStop         *int       `json:"meter_stop"`
+	StartedAt         time.Time  `bun:",notnull" json:"started_at"`
+	StoppedAt         *time.Time `json:"stopped_at"`
+	StopIdTag         string     `json:"stop_id_tag,omitempty"`
+	StopReason        string     `json:"stop_reason,omitempty"`
+	Status            string     `bun:",notnull" json:"status"`
+	Reconciliation    string     `json:"reconciliation,omitempty"`
+	CreatedAt         time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt         time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// MeterValue is one sampled value reported in MeterValues or in StopTransaction's transactionData.
+// Value and Unit are as reported, with the OCPP defaults spelled out; a numeric
+// value is also kept in SIValue, converted to SIUnit (Wh, varh, W, var, VA, A, V,
+// Hz, %, Celsius). Signed data has no SIValue.
+type MeterValue struct {
+	bun.BaseModel `bun:"table:meter_value" json:"-"`
+	ID            int64     `bun:",pk,autoincrement" json:"id"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	ChargerID     string    `bun:",notnull" json:"charger_id"`
+	ConnectorID   int       `bun:",notnull" json:"connector_id"`
+	Timestamp     time.Time `bun:",notnull" json:"timestamp"`
+	Value         string    `bun:",notnull" json:"value"`
+	Context       string    `json:"context,omitempty"`
+	Format        string    `json:"format,omitempty"`
+	Measurand     string    `json:"measurand,omitempty"`
+	Phase         string    `json:"phase,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	Unit          string    `json:"unit,omitempty"`
+	SIValue       *float64  `bun:"si_value" json:"si_value,omitempty"`
+	SIUnit        string    `bun:"si_unit" json:"si_unit,omitempty"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// ProcessedMessage remembers the answer to a transaction message, so that a
+// charger replaying it after a reconnect gets the same answer instead of having it
+// processed twice. Digest is the SHA-256 of the action and payload.
+type ProcessedMessage struct {
+	bun.BaseModel `bun:"table:processed_message" json:"-"`
+	ChargerID     string          `bun:",pk" json:"charger_id"`
+	Digest        string          `bun:",pk" json:"digest"`
+	Action        string          `bun:",notnull" json:"action"`
+	Response      json.RawMessage `bun:"type:jsonb,notnull" json:"response"`
+	CreatedAt     time.Time       `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
@@ -0,0 +1,328 @@
+package ocpp15
+
+import (
+	"encoding/xml"
+	"time"
+
+	"ocpp-server/ocpp16"
+)
+
+// CentralSystemService messages. Requests are only decoded, by local element
+// names; responses are only encoded, in the CentralSystemService namespace.
+
+// centralSystemRequests maps the body element of every CentralSystemService
+// request onto its type
+var centralSystemRequests = map[string]func() request16{
+	"authorizeRequest":                     func() request16 { return new(authorizeRequest) },
+	"bootNotificationRequest":              func() request16 { return new(bootNotificationRequest) },
+	"dataTransferRequest":                  func() request16 { return new(dataTransferRequestCS) },
+	"diagnosticsStatusNotificationRequest": func() request16 { return new(diagnosticsStatusNotificationRequest) },
+	"firmwareStatusNotificationRequest":    func() request16 { return new(firmwareStatusNotificationRequest) },
+	"heartbeatRequest":                     func() request16 { return new(heartbeatRequest) },
+	"meterValuesRequest":                   func() request16 { return new(meterValuesRequest) },
+	"startTransactionRequest":              func() request16 { return new(startTransactionRequest) },
+	"statusNotificationRequest":            func() request16 { return new(statusNotificationRequest) },
+	"stopTransactionRequest":               func() request16 { return new(stopTransactionRequest) },
+}
+
+// idTagInfo is shared by both services
+type idTagInfo struct {
+	Status      string     `xml:"status"`
+	ExpiryDate  *time.Time `xml:"expiryDate,omitempty"`
+	ParentIdTag string     `xml:"parentIdTag,omitempty"`
+}
+
+func newIdTagInfo(info ocpp16.IdTagInfo) idTagInfo {
+	converted := idTagInfo{Status: string(info.Status), ParentIdTag: info.ParentIdTag}
+	if info.ExpiryDate != nil {
+		expiry := info.ExpiryDate.UTC()
+		converted.ExpiryDate = &expiry
+	}
+	return converted
+}
+
+func (i idTagInfo) toOCPP16() ocpp16.IdTagInfo {
+	converted := ocpp16.IdTagInfo{Status: ocpp16.AuthorizationStatus(i.Status), ParentIdTag: i.ParentIdTag}
+	if i.ExpiryDate != nil {
+		converted.ExpiryDate = ocpp16.NewDateTime(*i.ExpiryDate)
+	}
+	return converted
+}
+
+// sampledValue is a 1.5 meter value: the reading is the element text, its
+// properties are attributes
+type sampledValue struct {
+	Value     string `xml:",chardata"`
+	Context   string `xml:"context,attr"`
+	Format    string `xml:"format,attr"`
+	Measurand string `xml:"measurand,attr"`
+	Location  string `xml:"location,attr"`
+	Unit      string `xml:"unit,attr"`
+}
+
+type meterValue struct {
+	Timestamp time.Time      `xml:"timestamp"`
+	Values    []sampledValue `xml:"value"`
+}
+
+// units16 maps the 1.5 units that were renamed in 1.6
+var units16 = map[string]string{
+	"Amp":  "A",
+	"Volt": "V",
+}
+
+func meterValues16(values []meterValue) []ocpp16.MeterValue {
+	converted := make([]ocpp16.MeterValue, 0, len(values))
+	for _, mv := range values {
+		sampled := make([]ocpp16.SampledValue, 0, len(mv.Values))
+		for _, sv := range mv.Values {
+			unit := sv.Unit
+			if renamed, ok := units16[unit]; ok {
+				unit = renamed
+			}
+			sampled = append(sampled, ocpp16.SampledValue{
+				Value:     sv.Value,
+				Context:   sv.Context,
+				Format:    sv.Format,
+				Measurand: ocpp16.Measurand(sv.Measurand),
+				Location:  sv.Location,
+				Unit:      unit,
+			})
+		}
+		converted = append(converted, ocpp16.MeterValue{Timestamp: ocpp16.DateTime{Time: mv.Timestamp}, SampledValue: sampled})
+	}
+	return converted
+}
+
+type authorizeRequest struct {
+	IdTag string `xml:"idTag"`
+}
+
+func (r *authorizeRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.AuthorizeRequest{IdTag: r.IdTag}
+}
+
+type authorizeResponse struct {
+	XMLName   xml.Name  `xml:"urn://Ocpp/Cs/2012/06/ authorizeResponse"`
+	IdTagInfo idTagInfo `xml:"idTagInfo"`
+}
+
+type bootNotificationRequest struct {
+	ChargePointVendor       string `xml:"chargePointVendor"`
+	ChargePointModel        string `xml:"chargePointModel"`
+	ChargePointSerialNumber string `xml:"chargePointSerialNumber"`
+	ChargeBoxSerialNumber   string `xml:"chargeBoxSerialNumber"`
+	FirmwareVersion         string `xml:"firmwareVersion"`
+	Iccid                   string `xml:"iccid"`
+	Imsi                    string `xml:"imsi"`
+	MeterType               string `xml:"meterType"`
+	MeterSerialNumber       string `xml:"meterSerialNumber"`
+}
+
+func (r *bootNotificationRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.BootNotificationRequest{
+		ChargePointVendor:       r.ChargePointVendor,
+		ChargePointModel:        r.ChargePointModel,
+		ChargePointSerialNumber: r.ChargePointSerialNumber,
+		ChargeBoxSerialNumber:   r.ChargeBoxSerialNumber,
+		FirmwareVersion:         r.FirmwareVersion,
+		Iccid:                   r.Iccid,
+		Imsi:                    r.Imsi,
+		MeterType:               r.MeterType,
+		MeterSerialNumber:       r.MeterSerialNumber,
+	}
+}
+
+type bootNotificationResponse struct {
+	XMLName           xml.Name  `xml:"urn://Ocpp/Cs/2012/06/ bootNotificationResponse"`
+	Status            string    `xml:"status"`
+	CurrentTime       time.Time `xml:"currentTime"`
+	HeartbeatInterval int       `xml:"heartbeatInterval"`
+}
+
+// newBootNotificationResponse answers a boot. 1.5 has no Pending registration: a
+// pending charge point is rejected and boots again after the interval.
+func newBootNotificationResponse(conf *ocpp16.BootNotificationConfirmation) *bootNotificationResponse {
+	status := conf.Status
+	if status == ocpp16.RegistrationStatusPending {
+		status = ocpp16.RegistrationStatusRejected
+	}
+	return &bootNotificationResponse{
+		Status:            string(status),
+		CurrentTime:       conf.CurrentTime.UTC(),
+		HeartbeatInterval: conf.Interval,
+	}
+}
+
+type dataTransferRequestCS struct {
+	VendorId  string `xml:"vendorId"`
+	MessageId string `xml:"messageId"`
+	Data      string `xml:"data"`
+}
+
+func (r *dataTransferRequestCS) toOCPP16() ocpp16.Request {
+	return &ocpp16.DataTransferRequest{VendorId: r.VendorId, MessageId: r.MessageId, Data: r.Data}
+}
+
+type dataTransferResponseCS struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cs/2012/06/ dataTransferResponse"`
+	Status  string   `xml:"status"`
+	Data    string   `xml:"data,omitempty"`
+}
+
+type diagnosticsStatusNotificationRequest struct {
+	Status string `xml:"status"`
+}
+
+func (r *diagnosticsStatusNotificationRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.DiagnosticsStatusNotificationRequest{Status: ocpp16.DiagnosticsStatus(r.Status)}
+}
+
+type diagnosticsStatusNotificationResponse struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cs/2012/06/ diagnosticsStatusNotificationResponse"`
+}
+
+type firmwareStatusNotificationRequest struct {
+	Status string `xml:"status"`
+}
+
+func (r *firmwareStatusNotificationRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.FirmwareStatusNotificationRequest{Status: ocpp16.FirmwareStatus(r.Status)}
+}
+
+type firmwareStatusNotificationResponse struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cs/2012/06/ firmwareStatusNotificationResponse"`
+}
+
+type heartbeatRequest struct{}
+
+func (r *heartbeatRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.HeartbeatRequest{}
+}
+
+type heartbeatResponse struct {
+	XMLName     xml.Name  `xml:"urn://Ocpp/Cs/2012/06/ heartbeatResponse"`
+	CurrentTime time.Time `xml:"currentTime"`
+}
+
+type meterValuesRequest struct {
+	ConnectorId   int          `xml:"connectorId"`
+	TransactionId *int         `xml:"transactionId"`
+	Values        []meterValue `xml:"values"`
+}
+
+func (r *meterValuesRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.MeterValuesRequest{
+		ConnectorId:   r.ConnectorId,
+		TransactionId: r.TransactionId,
+		MeterValue:    meterValues16(r.Values),
+	}
+}
+
+type meterValuesResponse struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cs/2012/06/ meterValuesResponse"`
+}
+
+type startTransactionRequest struct {
+	ConnectorId   int       `xml:"connectorId"`
+	IdTag         string    `xml:"idTag"`
+	Timestamp     time.Time `xml:"timestamp"`
+	MeterStart    int       `xml:"meterStart"`
+	ReservationId *int      `xml:"reservationId"`
+}
+
+func (r *startTransactionRequest) toOCPP16() ocpp16.Request {
+	return &ocpp16.StartTransactionRequest{
+		ConnectorId:   r.ConnectorId,
+		IdTag:         r.IdTag,
+		MeterStart:    r.MeterStart,
+		ReservationId: r.ReservationId,
+		Timestamp:     ocpp16.DateTime{Time: r.Timestamp},
+	}
+}
+
+type startTransactionResponse struct {
+	XMLName       xml.Name  `xml:"urn://Ocpp/Cs/2012/06/ startTransactionResponse"`
+	TransactionId int       `xml:"transactionId"`
+	IdTagInfo     idTagInfo `xml:"idTagInfo"`
+}
+
+// statuses16 maps the 1.5 connector statuses without a 1.6 counterpart. 1.5
+// reports a connector in use as Occupied, whether it is charging or not.
+var statuses16 = map[string]ocpp16.ChargePointStatus{
+	"Occupied": ocpp16.ChargePointStatusCharging,
+}
+
+// errorCodes16 maps the 1.5 error codes that were renamed in 1.6
+var errorCodes16 = map[string]ocpp16.ChargePointErrorCode{
+	"Mode3Error": ocpp16.EVCommunicationError,
+}
+
+type statusNotificationRequest struct {
+	ConnectorId     int        `xml:"connectorId"`
+	Status          string     `xml:"status"`
+	ErrorCode       string     `xml:"errorCode"`
+	Info            string     `xml:"info"`
+	Timestamp       *time.Time `xml:"timestamp"`
+	VendorId        string     `xml:"vendorId"`
+	VendorErrorCode string     `xml:"vendorErrorCode"`
+}
+
+func (r *statusNotificationRequest) toOCPP16() ocpp16.Request {
+	req := &ocpp16.StatusNotificationRequest{
+		ConnectorId:     r.ConnectorId,
+		ErrorCode:       ocpp16.ChargePointErrorCode(r.ErrorCode),
+		Info:            r.Info,
+		Status:          ocpp16.ChargePointStatus(r.Status),
+		VendorId:        r.VendorId,
+		VendorErrorCode: r.VendorErrorCode,
+	}
+	if status, ok := statuses16[r.Status]; ok {
+		req.Status = status
+	}
+	if code, ok := errorCodes16[r.ErrorCode]; ok {
+		req.ErrorCode = code
+	}
+	if r.Timestamp != nil {
+		req.Timestamp = ocpp16.NewDateTime(*r.Timestamp)
+	}
+	return req
+}
+
+type statusNotificationResponse struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cs/2012/06/ statusNotificationResponse"`
+}
+
+type transactionData struct {
+	Values []meterValue `xml:"values"`
+}
+
+type stopTransactionRequest struct {
+	TransactionId   int               `xml:"transactionId"`
+	IdTag           string            `xml:"idTag"`
+	Timestamp       time.Time         `xml:"timestamp"`
+	MeterStop       int               `xml:"meterStop"`
+	TransactionData []transactionData `xml:"transactionData"`
+}
+
+func (r *stopTransactionRequest) toOCPP16() ocpp16.Request {
+	var values []meterValue
+	for _, data := range r.TransactionData {
+		values = append(values, data.Values...)
+	}
+	req := &ocpp16.StopTransactionRequest{
+		IdTag:         r.IdTag,
+		MeterStop:     r.MeterStop,
+		Timestamp:     ocpp16.DateTime{Time: r.Timestamp},
+		TransactionId: r.TransactionId,
+	}
+	if len(values) > 0 {
+		req.TransactionData = meterValues16(values)
+	}
+	return req
+}
+
+type stopTransactionResponse struct {
+	XMLName   xml.Name   `xml:"urn://Ocpp/Cs/2012/06/ stopTransactionResponse"`
+	IdTagInfo *idTagInfo `xml:"idTagInfo,omitempty"`
+}
@@ -0,0 +1,249 @@
+package ocpp15
+
+import (
+	"encoding/xml"
+	"time"
+
+	"ocpp-server/ocpp16"
+)
+
+// ChargePointService messages. Requests are only encoded, in the
+// ChargePointService namespace; responses are only decoded, by local element names.
+
+// chargePointResponses maps every ChargePointService action onto the type of its response
+var chargePointResponses = map[string]func() confirmation16{
+	"CancelReservation": statusOnly(func(s string) ocpp16.Confirmation {
+		return &ocpp16.CancelReservationConfirmation{Status: ocpp16.CancelReservationStatus(s)}
+	}),
+	"ChangeAvailability":     statusOnly(func(s string) ocpp16.Confirmation { return &ocpp16.ChangeAvailabilityConfirmation{Status: s} }),
+	"ChangeConfiguration":    func() confirmation16 { return new(changeConfigurationResponse) },
+	"ClearCache":             statusOnly(func(s string) ocpp16.Confirmation { return &ocpp16.ClearCacheConfirmation{Status: s} }),
+	"DataTransfer":           func() confirmation16 { return new(dataTransferResponseCP) },
+	"GetConfiguration":       func() confirmation16 { return new(getConfigurationResponse) },
+	"GetDiagnostics":         func() confirmation16 { return new(getDiagnosticsResponse) },
+	"GetLocalListVersion":    func() confirmation16 { return new(getLocalListVersionResponse) },
+	"RemoteStartTransaction": statusOnly(func(s string) ocpp16.Confirmation { return &ocpp16.RemoteStartTransactionConfirmation{Status: s} }),
+	"RemoteStopTransaction":  statusOnly(func(s string) ocpp16.Confirmation { return &ocpp16.RemoteStopTransactionConfirmation{Status: s} }),
+	"ReserveNow":             func() confirmation16 { return new(reserveNowResponse) },
+	"Reset":                  statusOnly(func(s string) ocpp16.Confirmation { return &ocpp16.ResetConfirmation{Status: s} }),
+	"SendLocalList":          func() confirmation16 { return new(sendLocalListResponse) },
+	"UnlockConnector":        statusOnly(func(s string) ocpp16.Confirmation { return &ocpp16.UnlockConnectorConfirmation{Status: s} }),
+	"UpdateFirmware":         func() confirmation16 { return new(updateFirmwareResponse) },
+}
+
+// statusResponse is a response that only carries a status
+type statusResponse struct {
+	Status  string `xml:"status"`
+	confirm func(status string) ocpp16.Confirmation
+}
+
+func (r *statusResponse) toOCPP16() ocpp16.Confirmation {
+	return r.confirm(r.Status)
+}
+
+// statusOnly returns the constructor of a statusResponse converted by confirm
+func statusOnly(confirm func(status string) ocpp16.Confirmation) func() confirmation16 {
+	return func() confirmation16 { return &statusResponse{confirm: confirm} }
+}
+
+type cancelReservationRequest struct {
+	XMLName       xml.Name `xml:"urn://Ocpp/Cp/2012/06/ cancelReservationRequest"`
+	ReservationId int      `xml:"reservationId"`
+}
+
+type changeAvailabilityRequest struct {
+	XMLName     xml.Name `xml:"urn://Ocpp/Cp/2012/06/ changeAvailabilityRequest"`
+	ConnectorId int      `xml:"connectorId"`
+	Type        string   `xml:"type"`
+}
+
+type changeConfigurationRequest struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cp/2012/06/ changeConfigurationRequest"`
+	Key     string   `xml:"key"`
+	Value   string   `xml:"value"`
+}
+
+type changeConfigurationResponse struct {
+	Status string `xml:"status"`
+}
+
+func (r *changeConfigurationResponse) toOCPP16() ocpp16.Confirmation {
+	return &ocpp16.ChangeConfigurationConfirmation{Status: ocpp16.ConfigurationStatus(r.Status)}
+}
+
+type clearCacheRequest struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cp/2012/06/ clearCacheRequest"`
+}
+
+type dataTransferRequestCP struct {
+	XMLName   xml.Name `xml:"urn://Ocpp/Cp/2012/06/ dataTransferRequest"`
+	VendorId  string   `xml:"vendorId"`
+	MessageId string   `xml:"messageId,omitempty"`
+	Data      string   `xml:"data,omitempty"`
+}
+
+type dataTransferResponseCP struct {
+	Status string `xml:"status"`
+	Data   string `xml:"data"`
+}
+
+func (r *dataTransferResponseCP) toOCPP16() ocpp16.Confirmation {
+	return &ocpp16.DataTransferConfirmation{Status: ocpp16.DataTransferStatus(r.Status), Data: r.Data}
+}
+
+type getConfigurationRequest struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cp/2012/06/ getConfigurationRequest"`
+	Key     []string `xml:"key"`
+}
+
+type keyValue struct {
+	Key      string  `xml:"key"`
+	Readonly bool    `xml:"readonly"`
+	Value    *string `xml:"value"`
+}
+
+type getConfigurationResponse struct {
+	ConfigurationKey []keyValue `xml:"configurationKey"`
+	UnknownKey       []string   `xml:"unknownKey"`
+}
+
+func (r *getConfigurationResponse) toOCPP16() ocpp16.Confirmation {
+	conf := &ocpp16.GetConfigurationConfirmation{UnknownKey: r.UnknownKey}
+	for _, kv := range r.ConfigurationKey {
+		conf.ConfigurationKey = append(conf.ConfigurationKey, ocpp16.KeyValue{Key: kv.Key, Readonly: kv.Readonly, Value: kv.Value})
+	}
+	return conf
+}
+
+type getDiagnosticsRequest struct {
+	XMLName       xml.Name   `xml:"urn://Ocpp/Cp/2012/06/ getDiagnosticsRequest"`
+	Location      string     `xml:"location"`
+	StartTime     *time.Time `xml:"startTime,omitempty"`
+	StopTime      *time.Time `xml:"stopTime,omitempty"`
+	Retries       *int       `xml:"retries,omitempty"`
+	RetryInterval *int       `xml:"retryInterval,omitempty"`
+}
+
+func newGetDiagnosticsRequest(r *ocpp16.GetDiagnosticsRequest) *getDiagnosticsRequest {
+	req := &getDiagnosticsRequest{Location: r.Location, Retries: r.Retries, RetryInterval: r.RetryInterval}
+	if r.StartTime != nil {
+		start := r.StartTime.UTC()
+		req.StartTime = &start
+	}
+	if r.StopTime != nil {
+		stop := r.StopTime.UTC()
+		req.StopTime = &stop
+	}
+	return req
+}
+
+type getDiagnosticsResponse struct {
+	FileName string `xml:"fileName"`
+}
+
+func (r *getDiagnosticsResponse) toOCPP16() ocpp16.Confirmation {
+	return &ocpp16.GetDiagnosticsConfirmation{FileName: r.FileName}
+}
+
+type getLocalListVersionRequest struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cp/2012/06/ getLocalListVersionRequest"`
+}
+
+type getLocalListVersionResponse struct {
+	ListVersion int `xml:"listVersion"`
+}
+
+func (r *getLocalListVersionResponse) toOCPP16() ocpp16.Confirmation {
+	return &ocpp16.GetLocalListVersionConfirmation{ListVersion: r.ListVersion}
+}
+
+type remoteStartTransactionRequest struct {
+	XMLName     xml.Name `xml:"urn://Ocpp/Cp/2012/06/ remoteStartTransactionRequest"`
+	IdTag       string   `xml:"idTag"`
+	ConnectorId *int     `xml:"connectorId,omitempty"`
+}
+
+type remoteStopTransactionRequest struct {
+	XMLName       xml.Name `xml:"urn://Ocpp/Cp/2012/06/ remoteStopTransactionRequest"`
+	TransactionId int      `xml:"transactionId"`
+}
+
+type reserveNowRequest struct {
+	XMLName       xml.Name  `xml:"urn://Ocpp/Cp/2012/06/ reserveNowRequest"`
+	ConnectorId   int       `xml:"connectorId"`
+	ExpiryDate    time.Time `xml:"expiryDate"`
+	IdTag         string    `xml:"idTag"`
+	ParentIdTag   string    `xml:"parentIdTag,omitempty"`
+	ReservationId int       `xml:"reservationId"`
+}
+
+type reserveNowResponse struct {
+	Status string `xml:"status"`
+}
+
+func (r *reserveNowResponse) toOCPP16() ocpp16.Confirmation {
+	return &ocpp16.ReserveNowConfirmation{Status: ocpp16.ReservationStatus(r.Status)}
+}
+
+type resetRequest struct {
+	XMLName xml.Name `xml:"urn://Ocpp/Cp/2012/06/ resetRequest"`
+	Type    string   `xml:"type"`
+}
+
+type authorisationData struct {
+	IdTag     string     `xml:"idTag"`
+	IdTagInfo *idTagInfo `xml:"idTagInfo,omitempty"`
+}
+
+// sendLocalListRequest leaves out the optional hash, which 1.6 dropped
+type sendLocalListRequest struct {
+	XMLName                xml.Name            `xml:"urn://Ocpp/Cp/2012/06/ sendLocalListRequest"`
+	UpdateType             string              `xml:"updateType"`
+	ListVersion            int                 `xml:"listVersion"`
+	LocalAuthorisationList []authorisationData `xml:"localAuthorisationList"`
+}
+
+func newSendLocalListRequest(r *ocpp16.SendLocalListRequest) *sendLocalListRequest {
+	req := &sendLocalListRequest{UpdateType: string(r.UpdateType), ListVersion: r.ListVersion}
+	for _, entry := range r.LocalAuthorizationList {
+		data := authorisationData{IdTag: entry.IdTag}
+		if entry.IdTagInfo != nil {
+			info := newIdTagInfo(*entry.IdTagInfo)
+			data.IdTagInfo = &info
+		}
+		req.LocalAuthorisationList = append(req.LocalAuthorisationList, data)
+	}
+	return req
+}
+
+type sendLocalListResponse struct {
+	Status string `xml:"status"`
+}
+
+func (r *sendLocalListResponse) toOCPP16() ocpp16.Confirmation {
+	status := ocpp16.UpdateStatus(r.Status)
+	// 1.6 has no HashError, the list was not applied either way
+	if r.Status == "HashError" {
+		status = ocpp16.UpdateStatusFailed
+	}
+	return &ocpp16.SendLocalListConfirmation{Status: status}
+}
+
+type unlockConnectorRequest struct {
+	XMLName     xml.Name `xml:"urn://Ocpp/Cp/2012/06/ unlockConnectorRequest"`
+	ConnectorId int      `xml:"connectorId"`
+}
+
+type updateFirmwareRequest struct {
+	XMLName       xml.Name  `xml:"urn://Ocpp/Cp/2012/06/ updateFirmwareRequest"`
+	RetrieveDate  time.Time `xml:"retrieveDate"`
+	Location      string    `xml:"location"`
+	Retries       *int      `xml:"retries,omitempty"`
+	RetryInterval *int      `xml:"retryInterval,omitempty"`
+}
+
+type updateFirmwareResponse struct{}
+
+func (r *updateFirmwareResponse) toOCPP16() ocpp16.Confirmation {
+	return &ocpp16.UpdateFirmwareConfirmation{}
+}
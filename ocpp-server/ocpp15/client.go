@@ -0,0 +1,76 @@
+package ocpp15
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"ocpp-server/ocpp16"
+
+	"github.com/google/uuid"
+)
+
+// maxResponseSize bounds the SOAP responses read from charge points
+const maxResponseSize = 1 << 20
+
+// Client calls the ChargePointService of OCPP 1.5 charge points
+type Client struct {
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client sending its requests with httpClient
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{HTTPClient: httpClient}
+}
+
+// Call sends request to the charge point chargeBoxIdentity whose ChargePointService
+// listens at endpoint, and returns its answer as the equivalent 1.6 confirmation.
+// A SOAP fault is returned as an *ocpp16.Error; a request without a 1.5
+// equivalent fails with ErrNotSupported before anything is sent.
+func (c *Client) Call(ctx context.Context, endpoint, chargeBoxIdentity string, request ocpp16.Request) (ocpp16.Confirmation, error) {
+	message, err := NewRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	action := request.Action()
+	body, err := Marshal(Header{
+		ChargeBoxIdentity: chargeBoxIdentity,
+		MessageID:         "urn:uuid:" + uuid.New().String(),
+		Action:            Action(action),
+		ReplyTo:           AnonymousAddress,
+		To:                endpoint,
+	}, message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", action, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", fmt.Sprintf("%s; action=%q", ContentType, Action(action)))
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", action, err)
+	}
+
+	// Faults come with an error status, so the envelope is read first
+	env, err := ParseEnvelope(data)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s answered with HTTP %d", endpoint, resp.StatusCode)
+		}
+		return nil, err
+	}
+	return ParseConfirmation(action, env)
+}
@@ -0,0 +1,193 @@
+// Package ocpp15 implements OCPP 1.5 over SOAP 1.2: the CentralSystemService
+// messages charge points send, the ChargePointService messages sent to them and
+// the WS-Addressing envelope around both. Messages are converted to and from
+// their ocpp16 equivalents, so that the server handles a 1.5 charge point with
+// its 1.6 handlers. The ocpp16 values are validated against the 1.6 schemas,
+// which accept every valid 1.5 message once converted.
+package ocpp15
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ocpp-server/ocpp16"
+)
+
+// Protocol is the name the server reports for charge points speaking OCPP 1.5 SOAP
+const Protocol = "ocpp1.5"
+
+// XML namespaces of the two OCPP 1.5 services
+const (
+	CentralSystemNamespace = "urn://Ocpp/Cs/2012/06/"
+	ChargePointNamespace   = "urn://Ocpp/Cp/2012/06/"
+)
+
+// ErrNotSupported is returned for a 1.6 message that has no OCPP 1.5 equivalent
+var ErrNotSupported = errors.New("not supported by OCPP 1.5")
+
+// Action returns the SOAP action of an OCPP action, e.g. /Authorize
+func Action(action string) string {
+	return "/" + action
+}
+
+// ResponseAction returns the SOAP action of the answer to an OCPP action, e.g. /AuthorizeResponse
+func ResponseAction(action string) string {
+	return "/" + action + "Response"
+}
+
+// request16 is a 1.5 message that converts into a 1.6 request
+type request16 interface {
+	toOCPP16() ocpp16.Request
+}
+
+// confirmation16 is a 1.5 message that converts into a 1.6 confirmation
+type confirmation16 interface {
+	toOCPP16() ocpp16.Confirmation
+}
+
+// ParseRequest decodes the CentralSystemService request in env into the
+// equivalent OCPP 1.6 request. Errors are *ocpp16.Error values carrying the
+// fault code to answer with.
+func ParseRequest(env *Envelope) (ocpp16.Request, error) {
+	newRequest, ok := centralSystemRequests[env.Name]
+	if !ok {
+		return nil, ocpp16.NewError(ocpp16.NotImplemented, "unknown message %s", env.Name)
+	}
+	req := newRequest()
+	if err := decodeBody(env, req); err != nil {
+		return nil, err
+	}
+
+	converted := req.toOCPP16()
+	payload, err := json.Marshal(converted)
+	if err != nil {
+		return nil, ocpp16.NewError(ocpp16.InternalError, "%v", err)
+	}
+	return ocpp16.ParseRequest(converted.Action(), payload)
+}
+
+// NewResponse converts the 1.6 confirmation of a CentralSystemService request
+// into its 1.5 response
+func NewResponse(conf ocpp16.Confirmation) (interface{}, error) {
+	switch c := conf.(type) {
+	case *ocpp16.AuthorizeConfirmation:
+		return &authorizeResponse{IdTagInfo: newIdTagInfo(c.IdTagInfo)}, nil
+	case *ocpp16.BootNotificationConfirmation:
+		return newBootNotificationResponse(c), nil
+	case *ocpp16.DataTransferConfirmation:
+		return &dataTransferResponseCS{Status: string(c.Status), Data: c.Data}, nil
+	case *ocpp16.DiagnosticsStatusNotificationConfirmation:
+		return &diagnosticsStatusNotificationResponse{}, nil
+	case *ocpp16.FirmwareStatusNotificationConfirmation:
+		return &firmwareStatusNotificationResponse{}, nil
+	case *ocpp16.HeartbeatConfirmation:
+		return &heartbeatResponse{CurrentTime: c.CurrentTime.UTC()}, nil
+	case *ocpp16.MeterValuesConfirmation:
+		return &meterValuesResponse{}, nil
+	case *ocpp16.StartTransactionConfirmation:
+		return &startTransactionResponse{TransactionId: c.TransactionId, IdTagInfo: newIdTagInfo(c.IdTagInfo)}, nil
+	case *ocpp16.StatusNotificationConfirmation:
+		return &statusNotificationResponse{}, nil
+	case *ocpp16.StopTransactionConfirmation:
+		resp := &stopTransactionResponse{}
+		if c.IdTagInfo != nil {
+			info := newIdTagInfo(*c.IdTagInfo)
+			resp.IdTagInfo = &info
+		}
+		return resp, nil
+	default:
+		return nil, fmt.Errorf("%s response: %w", conf.Action(), ErrNotSupported)
+	}
+}
+
+// NewRequest converts a 1.6 request for a charge point into its 1.5
+// ChargePointService request. Requests without a 1.5 equivalent, e.g.
+// TriggerMessage or a RemoteStartTransaction with a charging profile, fail with
+// ErrNotSupported.
+func NewRequest(req ocpp16.Request) (interface{}, error) {
+	switch r := req.(type) {
+	case *ocpp16.CancelReservationRequest:
+		return &cancelReservationRequest{ReservationId: r.ReservationId}, nil
+	case *ocpp16.ChangeAvailabilityRequest:
+		return &changeAvailabilityRequest{ConnectorId: r.ConnectorId, Type: string(r.Type)}, nil
+	case *ocpp16.ChangeConfigurationRequest:
+		return &changeConfigurationRequest{Key: r.Key, Value: r.Value}, nil
+	case *ocpp16.ClearCacheRequest:
+		return &clearCacheRequest{}, nil
+	case *ocpp16.DataTransferRequest:
+		return &dataTransferRequestCP{VendorId: r.VendorId, MessageId: r.MessageId, Data: r.Data}, nil
+	case *ocpp16.GetConfigurationRequest:
+		return &getConfigurationRequest{Key: r.Key}, nil
+	case *ocpp16.GetDiagnosticsRequest:
+		return newGetDiagnosticsRequest(r), nil
+	case *ocpp16.GetLocalListVersionRequest:
+		return &getLocalListVersionRequest{}, nil
+	case *ocpp16.RemoteStartTransactionRequest:
+		if r.ChargingProfile != nil {
+			return nil, fmt.Errorf("RemoteStartTransaction with a charging profile: %w", ErrNotSupported)
+		}
+		return &remoteStartTransactionRequest{IdTag: r.IdTag, ConnectorId: r.ConnectorId}, nil
+	case *ocpp16.RemoteStopTransactionRequest:
+		return &remoteStopTransactionRequest{TransactionId: r.TransactionId}, nil
+	case *ocpp16.ReserveNowRequest:
+		return &reserveNowRequest{
+			ConnectorId:   r.ConnectorId,
+			ExpiryDate:    r.ExpiryDate.UTC(),
+			IdTag:         r.IdTag,
+			ParentIdTag:   r.ParentIdTag,
+			ReservationId: r.ReservationId,
+		}, nil
+	case *ocpp16.ResetRequest:
+		return &resetRequest{Type: string(r.Type)}, nil
+	case *ocpp16.SendLocalListRequest:
+		return newSendLocalListRequest(r), nil
+	case *ocpp16.UnlockConnectorRequest:
+		return &unlockConnectorRequest{ConnectorId: r.ConnectorId}, nil
+	case *ocpp16.UpdateFirmwareRequest:
+		return &updateFirmwareRequest{
+			RetrieveDate:  r.RetrieveDate.UTC(),
+			Location:      r.Location,
+			Retries:       r.Retries,
+			RetryInterval: r.RetryInterval,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%s: %w", req.Action(), ErrNotSupported)
+	}
+}
+
+// ParseConfirmation decodes the ChargePointService response to action in env
+// into the equivalent OCPP 1.6 confirmation. A SOAP fault is returned as an
+// *ocpp16.Error.
+func ParseConfirmation(action string, env *Envelope) (ocpp16.Confirmation, error) {
+	if env.Name == "Fault" {
+		return nil, parseFault(env)
+	}
+	newResponse, ok := chargePointResponses[action]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", action, ErrNotSupported)
+	}
+	resp := newResponse()
+	if want := elementName(action) + "Response"; env.Name != want {
+		return nil, ocpp16.NewError(ocpp16.FormationViolation, "expected %s, got %s", want, env.Name)
+	}
+	if err := decodeBody(env, resp); err != nil {
+		return nil, err
+	}
+
+	converted := resp.toOCPP16()
+	payload, err := json.Marshal(converted)
+	if err != nil {
+		return nil, ocpp16.NewError(ocpp16.InternalError, "%v", err)
+	}
+	return ocpp16.ParseConfirmation(action, payload)
+}
+
+// elementName returns the body element name prefix of an action, e.g. authorize
+func elementName(action string) string {
+	if action == "" {
+		return ""
+	}
+	return strings.ToLower(action[:1]) + action[1:]
+}
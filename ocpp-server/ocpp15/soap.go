@@ -0,0 +1,223 @@
+package ocpp15
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+
+	"ocpp-server/ocpp16"
+)
+
+// SOAP 1.2 and WS-Addressing namespaces
+const (
+	soapNamespace       = "http://www.w3.org/2003/05/soap-envelope"
+	addressingNamespace = "http://www.w3.org/2005/08/addressing"
+
+	// AnonymousAddress is the WS-Addressing address of a sender that can only be
+	// answered on the HTTP exchange it opened
+	AnonymousAddress = "http://www.w3.org/2005/08/addressing/anonymous"
+
+	// ContentType is the media type of a SOAP 1.2 message
+	ContentType = "application/soap+xml; charset=utf-8"
+)
+
+// Header is the chargeBoxIdentity and WS-Addressing header of an OCPP 1.5 message
+type Header struct {
+	ChargeBoxIdentity string
+	MessageID         string
+	RelatesTo         string
+	Action            string
+	From              string // address of the sender's own service, if it has one
+	ReplyTo           string
+	To                string
+}
+
+// Envelope is a received SOAP message
+type Envelope struct {
+	Header Header
+	Name   string // local name of the element inside soap:Body, e.g. authorizeRequest
+	Body   []byte // the element inside soap:Body
+}
+
+// envelopeXML decodes an envelope by local names only: the body is decoded on
+// its own later, so the namespaces declared on the envelope cannot be relied on
+type envelopeXML struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Header  struct {
+		ChargeBoxIdentity string `xml:"chargeBoxIdentity"`
+		MessageID         string `xml:"MessageID"`
+		RelatesTo         string `xml:"RelatesTo"`
+		Action            string `xml:"Action"`
+		From              string `xml:"From>Address"`
+		ReplyTo           string `xml:"ReplyTo>Address"`
+		To                string `xml:"To"`
+	} `xml:"Header"`
+	Body struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// ParseEnvelope decodes a SOAP envelope. Errors are *ocpp16.Error values carrying
+// the fault code to answer with.
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	var raw envelopeXML
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return nil, ocpp16.NewError(ocpp16.FormationViolation, "invalid SOAP envelope: %v", err)
+	}
+
+	env := &Envelope{
+		Header: Header{
+			ChargeBoxIdentity: strings.TrimSpace(raw.Header.ChargeBoxIdentity),
+			MessageID:         strings.TrimSpace(raw.Header.MessageID),
+			RelatesTo:         strings.TrimSpace(raw.Header.RelatesTo),
+			Action:            strings.TrimSpace(raw.Header.Action),
+			From:              strings.TrimSpace(raw.Header.From),
+			ReplyTo:           strings.TrimSpace(raw.Header.ReplyTo),
+			To:                strings.TrimSpace(raw.Header.To),
+		},
+		Body: bytes.TrimSpace(raw.Body.Inner),
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(env.Body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, ocpp16.NewError(ocpp16.FormationViolation, "empty SOAP body")
+		}
+		if err != nil {
+			return nil, ocpp16.NewError(ocpp16.FormationViolation, "invalid SOAP body: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			env.Name = start.Name.Local
+			return env, nil
+		}
+	}
+}
+
+// decodeBody decodes the message inside a SOAP body into v
+func decodeBody(env *Envelope, v interface{}) error {
+	if err := xml.Unmarshal(env.Body, v); err != nil {
+		return ocpp16.NewError(ocpp16.FormationViolation, "invalid %s: %v", env.Name, err)
+	}
+	return nil
+}
+
+type addressXML struct {
+	Address string `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+
+type actionXML struct {
+	MustUnderstand string `xml:"http://www.w3.org/2003/05/soap-envelope mustUnderstand,attr"`
+	Value          string `xml:",chardata"`
+}
+
+type headerXML struct {
+	// Only sent to charge points, in the ChargePointService namespace
+	ChargeBoxIdentity string      `xml:"urn://Ocpp/Cp/2012/06/ chargeBoxIdentity,omitempty"`
+	MessageID         string      `xml:"http://www.w3.org/2005/08/addressing MessageID,omitempty"`
+	RelatesTo         string      `xml:"http://www.w3.org/2005/08/addressing RelatesTo,omitempty"`
+	From              *addressXML `xml:"http://www.w3.org/2005/08/addressing From,omitempty"`
+	ReplyTo           *addressXML `xml:"http://www.w3.org/2005/08/addressing ReplyTo,omitempty"`
+	To                string      `xml:"http://www.w3.org/2005/08/addressing To,omitempty"`
+	Action            actionXML   `xml:"http://www.w3.org/2005/08/addressing Action"`
+}
+
+type outEnvelopeXML struct {
+	XMLName xml.Name  `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	Header  headerXML `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+	Body    struct {
+		Message interface{}
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+}
+
+// Marshal builds a SOAP envelope around message, which must be one of the
+// message types of this package or a fault
+func Marshal(header Header, message interface{}) ([]byte, error) {
+	env := outEnvelopeXML{
+		Header: headerXML{
+			ChargeBoxIdentity: header.ChargeBoxIdentity,
+			MessageID:         header.MessageID,
+			RelatesTo:         header.RelatesTo,
+			To:                header.To,
+			Action:            actionXML{MustUnderstand: "true", Value: header.Action},
+		},
+	}
+	if header.From != "" {
+		env.Header.From = &addressXML{Address: header.From}
+	}
+	if header.ReplyTo != "" {
+		env.Header.ReplyTo = &addressXML{Address: header.ReplyTo}
+	}
+	env.Body.Message = message
+
+	data, err := xml.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// faultXML is a SOAP 1.2 fault. OCPP 1.5 reports its errors in the subcode, using
+// the same codes as OCPP-J CALLERRORs.
+type faultXML struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Fault"`
+	Code    struct {
+		Value   string `xml:"http://www.w3.org/2003/05/soap-envelope Value"`
+		Subcode struct {
+			Value string `xml:"http://www.w3.org/2003/05/soap-envelope Value"`
+		} `xml:"http://www.w3.org/2003/05/soap-envelope Subcode"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Code"`
+	Reason struct {
+		Text struct {
+			Lang  string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"http://www.w3.org/2003/05/soap-envelope Text"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Reason"`
+}
+
+// Fault converts an OCPP error into a SOAP fault and the HTTP status it is sent
+// with: errors of the receiving side are Receiver faults, all others Sender faults
+func Fault(callErr *ocpp16.Error) (interface{}, int) {
+	fault := &faultXML{}
+	fault.Code.Value = "Sender"
+	status := http.StatusBadRequest
+	if callErr.Code == ocpp16.InternalError {
+		fault.Code.Value = "Receiver"
+		status = http.StatusInternalServerError
+	}
+	fault.Code.Subcode.Value = string(callErr.Code)
+	fault.Reason.Text.Lang = "en"
+	fault.Reason.Text.Value = callErr.Description
+	return fault, status
+}
+
+// parseFault decodes a received fault into an OCPP error
+func parseFault(env *Envelope) *ocpp16.Error {
+	var fault struct {
+		Code struct {
+			Value   string `xml:"Value"`
+			Subcode string `xml:"Subcode>Value"`
+		} `xml:"Code"`
+		Reason string `xml:"Reason>Text"`
+	}
+	if err := xml.Unmarshal(env.Body, &fault); err != nil {
+		return ocpp16.NewError(ocpp16.GenericError, "invalid SOAP fault: %v", err)
+	}
+
+	code := ocpp16.GenericError
+	if subcode := localName(fault.Code.Subcode); subcode != "" {
+		code = ocpp16.ErrorCode(subcode)
+	}
+	return ocpp16.NewError(code, "%s", strings.TrimSpace(fault.Reason))
+}
+
+// localName strips the namespace prefix from a QName
+func localName(qname string) string {
+	qname = strings.TrimSpace(qname)
+	if i := strings.LastIndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
@@ -0,0 +1,272 @@
+package ocpp16
+
+// Core profile messages
+
+// AuthorizeRequest is sent by a charge point to check an idTag
+type AuthorizeRequest struct {
+	IdTag string `json:"idTag"`
+}
+
+type AuthorizeConfirmation struct {
+	IdTagInfo IdTagInfo `json:"idTagInfo"`
+}
+
+// RegistrationStatus is the answer to a BootNotification
+type RegistrationStatus string
+
+const (
+	RegistrationStatusAccepted RegistrationStatus = "Accepted"
+	RegistrationStatusPending  RegistrationStatus = "Pending"
+	RegistrationStatusRejected RegistrationStatus = "Rejected"
+)
+
+// BootNotificationRequest is sent by a charge point after (re)booting
+type BootNotificationRequest struct {
+	ChargePointVendor       string `json:"chargePointVendor"`
+	ChargePointModel        string `json:"chargePointModel"`
+	ChargePointSerialNumber string `json:"chargePointSerialNumber,omitempty"`
+	ChargeBoxSerialNumber   string `json:"chargeBoxSerialNumber,omitempty"`
+	FirmwareVersion         string `json:"firmwareVersion,omitempty"`
+	Iccid                   string `json:"iccid,omitempty"`
+	Imsi                    string `json:"imsi,omitempty"`
+	MeterType               string `json:"meterType,omitempty"`
+	MeterSerialNumber       string `json:"meterSerialNumber,omitempty"`
+}
+
+type BootNotificationConfirmation struct {
+	Status      RegistrationStatus `json:"status"`
+	CurrentTime DateTime           `json:"currentTime"`
+	Interval    int                `json:"interval"`
+}
+
+// AvailabilityType is the availability requested by ChangeAvailability
+type AvailabilityType string
+
+const (
+	AvailabilityTypeInoperative AvailabilityType = "Inoperative"
+	AvailabilityTypeOperative   AvailabilityType = "Operative"
+)
+
+// ChangeAvailabilityRequest asks a charge point to change the availability of a connector
+type ChangeAvailabilityRequest struct {
+	ConnectorId int              `json:"connectorId"`
+	Type        AvailabilityType `json:"type"`
+}
+
+type ChangeAvailabilityConfirmation struct {
+	Status string `json:"status"`
+}
+
+// ConfigurationStatus is the answer to ChangeConfiguration
+type ConfigurationStatus string
+
+const (
+	ConfigurationStatusAccepted       ConfigurationStatus = "Accepted"
+	ConfigurationStatusRejected       ConfigurationStatus = "Rejected"
+	ConfigurationStatusRebootRequired ConfigurationStatus = "RebootRequired"
+	ConfigurationStatusNotSupported   ConfigurationStatus = "NotSupported"
+)
+
+// ChangeConfigurationRequest asks a charge point to change a configuration key
+type ChangeConfigurationRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type ChangeConfigurationConfirmation struct {
+	Status ConfigurationStatus `json:"status"`
+}
+
+// ClearCacheRequest asks a charge point to clear its authorization cache
+type ClearCacheRequest struct{}
+
+type ClearCacheConfirmation struct {
+	Status string `json:"status"`
+}
+
+// DataTransferStatus is the answer to a DataTransfer
+type DataTransferStatus string
+
+const (
+	DataTransferStatusAccepted         DataTransferStatus = "Accepted"
+	DataTransferStatusRejected         DataTransferStatus = "Rejected"
+	DataTransferStatusUnknownMessageId DataTransferStatus = "UnknownMessageId"
+	DataTransferStatusUnknownVendorId  DataTransferStatus = "UnknownVendorId"
+)
+
+// DataTransferRequest carries vendor-specific data in either direction
+type DataTransferRequest struct {
+	VendorId  string `json:"vendorId"`
+	MessageId string `json:"messageId,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+type DataTransferConfirmation struct {
+	Status DataTransferStatus `json:"status"`
+	Data   string             `json:"data,omitempty"`
+}
+
+// GetConfigurationRequest asks a charge point for configuration keys, all of them if Key is empty
+type GetConfigurationRequest struct {
+	Key []string `json:"key,omitempty"`
+}
+
+type GetConfigurationConfirmation struct {
+	ConfigurationKey []KeyValue `json:"configurationKey,omitempty"`
+	UnknownKey       []string   `json:"unknownKey,omitempty"`
+}
+
+// HeartbeatRequest is sent periodically by a charge point
+type HeartbeatRequest struct{}
+
+type HeartbeatConfirmation struct {
+	CurrentTime DateTime `json:"currentTime"`
+}
+
+// MeterValuesRequest reports sampled meter values for a connector
+type MeterValuesRequest struct {
+	ConnectorId   int          `json:"connectorId"`
+	TransactionId *int         `json:"transactionId,omitempty"`
+	MeterValue    []MeterValue `json:"meterValue"`
+}
+
+type MeterValuesConfirmation struct{}
+
+// RemoteStartTransactionRequest asks a charge point to start a transaction
+type RemoteStartTransactionRequest struct {
+	ConnectorId     *int             `json:"connectorId,omitempty"`
+	IdTag           string           `json:"idTag"`
+	ChargingProfile *ChargingProfile `json:"chargingProfile,omitempty"`
+}
+
+type RemoteStartTransactionConfirmation struct {
+	Status string `json:"status"`
+}
+
+// RemoteStopTransactionRequest asks a charge point to stop a transaction
+type RemoteStopTransactionRequest struct {
+	TransactionId int `json:"transactionId"`
+}
+
+type RemoteStopTransactionConfirmation struct {
+	Status string `json:"status"`
+}
+
+// ResetType is the kind of reset requested by Reset
+type ResetType string
+
+const (
+	ResetTypeHard ResetType = "Hard"
+	ResetTypeSoft ResetType = "Soft"
+)
+
+// ResetRequest asks a charge point to reboot
+type ResetRequest struct {
+	Type ResetType `json:"type"`
+}
+
+type ResetConfirmation struct {
+	Status string `json:"status"`
+}
+
+// StartTransactionRequest is sent by a charge point when a transaction starts
+type StartTransactionRequest struct {
+	ConnectorId   int      `json:"connectorId"`
+	IdTag         string   `json:"idTag"`
+	MeterStart    int      `json:"meterStart"`
+	ReservationId *int     `json:"reservationId,omitempty"`
+	Timestamp     DateTime `json:"timestamp"`
+}
+
+type StartTransactionConfirmation struct {
+	IdTagInfo     IdTagInfo `json:"idTagInfo"`
+	TransactionId int       `json:"transactionId"`
+}
+
+// StatusNotificationRequest reports the status of a charge point (connector 0) or one of its connectors
+type StatusNotificationRequest struct {
+	ConnectorId     int                  `json:"connectorId"`
+	ErrorCode       ChargePointErrorCode `json:"errorCode"`
+	Info            string               `json:"info,omitempty"`
+	Status          ChargePointStatus    `json:"status"`
+	Timestamp       *DateTime            `json:"timestamp,omitempty"`
+	VendorId        string               `json:"vendorId,omitempty"`
+	VendorErrorCode string               `json:"vendorErrorCode,omitempty"`
+}
+
+type StatusNotificationConfirmation struct{}
+
+// StopTransactionRequest is sent by a charge point when a transaction stops
+type StopTransactionRequest struct {
+	IdTag           string       `json:"idTag,omitempty"`
+	MeterStop       int          `json:"meterStop"`
+	Timestamp       DateTime     `json:"timestamp"`
+	TransactionId   int          `json:"transactionId"`
+	Reason          Reason       `json:"reason,omitempty"`
+	TransactionData []MeterValue `json:"transactionData,omitempty"`
+}
+
+type StopTransactionConfirmation struct {
+	IdTagInfo *IdTagInfo `json:"idTagInfo,omitempty"`
+}
+
+// UnlockConnectorRequest asks a charge point to unlock a connector
+type UnlockConnectorRequest struct {
+	ConnectorId int `json:"connectorId"`
+}
+
+type UnlockConnectorConfirmation struct {
+	Status string `json:"status"`
+}
+
+func (*AuthorizeRequest) Action() string                   { return "Authorize" }
+func (*AuthorizeConfirmation) Action() string              { return "Authorize" }
+func (*BootNotificationRequest) Action() string            { return "BootNotification" }
+func (*BootNotificationConfirmation) Action() string       { return "BootNotification" }
+func (*ChangeAvailabilityRequest) Action() string          { return "ChangeAvailability" }
+func (*ChangeAvailabilityConfirmation) Action() string     { return "ChangeAvailability" }
+func (*ChangeConfigurationRequest) Action() string         { return "ChangeConfiguration" }
+func (*ChangeConfigurationConfirmation) Action() string    { return "ChangeConfiguration" }
+func (*ClearCacheRequest) Action() string                  { return "ClearCache" }
+func (*ClearCacheConfirmation) Action() string             { return "ClearCache" }
+func (*DataTransferRequest) Action() string                { return "DataTransfer" }
+func (*DataTransferConfirmation) Action() string           { return "DataTransfer" }
+func (*GetConfigurationRequest) Action() string            { return "GetConfiguration" }
+func (*GetConfigurationConfirmation) Action() string       { return "GetConfiguration" }
+func (*HeartbeatRequest) Action() string                   { return "Heartbeat" }
+func (*HeartbeatConfirmation) Action() string              { return "Heartbeat" }
+func (*MeterValuesRequest) Action() string                 { return "MeterValues" }
+func (*MeterValuesConfirmation) Action() string            { return "MeterValues" }
+func (*RemoteStartTransactionRequest) Action() string      { return "RemoteStartTransaction" }
+func (*RemoteStartTransactionConfirmation) Action() string { return "RemoteStartTransaction" }
+func (*RemoteStopTransactionRequest) Action() string       { return "RemoteStopTransaction" }
+func (*RemoteStopTransactionConfirmation) Action() string  { return "RemoteStopTransaction" }
+func (*ResetRequest) Action() string                       { return "Reset" }
+func (*ResetConfirmation) Action() string                  { return "Reset" }
+func (*StartTransactionRequest) Action() string            { return "StartTransaction" }
+func (*StartTransactionConfirmation) Action() string       { return "StartTransaction" }
+func (*StatusNotificationRequest) Action() string          { return "StatusNotification" }
+func (*StatusNotificationConfirmation) Action() string     { return "StatusNotification" }
+func (*StopTransactionRequest) Action() string             { return "StopTransaction" }
+func (*StopTransactionConfirmation) Action() string        { return "StopTransaction" }
+func (*UnlockConnectorRequest) Action() string             { return "UnlockConnector" }
+func (*UnlockConnectorConfirmation) Action() string        { return "UnlockConnector" }
+
+func init() {
+	register(&AuthorizeRequest{}, &AuthorizeConfirmation{})
+	register(&BootNotificationRequest{}, &BootNotificationConfirmation{})
+	register(&ChangeAvailabilityRequest{}, &ChangeAvailabilityConfirmation{})
+	register(&ChangeConfigurationRequest{}, &ChangeConfigurationConfirmation{})
+	register(&ClearCacheRequest{}, &ClearCacheConfirmation{})
+	register(&DataTransferRequest{}, &DataTransferConfirmation{})
+	register(&GetConfigurationRequest{}, &GetConfigurationConfirmation{})
+	register(&HeartbeatRequest{}, &HeartbeatConfirmation{})
+	register(&MeterValuesRequest{}, &MeterValuesConfirmation{})
+	register(&RemoteStartTransactionRequest{}, &RemoteStartTransactionConfirmation{})
+	register(&RemoteStopTransactionRequest{}, &RemoteStopTransactionConfirmation{})
+	register(&ResetRequest{}, &ResetConfirmation{})
+	register(&StartTransactionRequest{}, &StartTransactionConfirmation{})
+	register(&StatusNotificationRequest{}, &StatusNotificationConfirmation{})
+	register(&StopTransactionRequest{}, &StopTransactionConfirmation{})
+	register(&UnlockConnectorRequest{}, &UnlockConnectorConfirmation{})
+}
@@ -0,0 +1,39 @@
+package ocpp16
+
+import "fmt"
+
+// ErrorCode is the errorCode field of a CALLERROR frame
+type ErrorCode string
+
+// CALLERROR codes defined by OCPP-J 1.6 section 4.2.3
+const (
+	NotImplemented               ErrorCode = "NotImplemented"
+	NotSupported                 ErrorCode = "NotSupported"
+	InternalError                ErrorCode = "InternalError"
+	ProtocolError                ErrorCode = "ProtocolError"
+	SecurityError                ErrorCode = "SecurityError"
+	FormationViolation           ErrorCode = "FormationViolation"
+	PropertyConstraintViolation  ErrorCode = "PropertyConstraintViolation"
+	OccurenceConstraintViolation ErrorCode = "OccurenceConstraintViolation"
+	TypeConstraintViolation      ErrorCode = "TypeConstraintViolation"
+	GenericError                 ErrorCode = "GenericError"
+)
+
+// Error is an OCPP error, either received in or destined for a CALLERROR frame
+type Error struct {
+	Code        ErrorCode              `json:"errorCode"`
+	Description string                 `json:"errorDescription"`
+	Details     map[string]interface{} `json:"errorDetails,omitempty"`
+}
+
+// NewError creates an Error with a formatted description
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("OCPP %s", e.Code)
+	}
+	return fmt.Sprintf("OCPP %s: %s", e.Code, e.Description)
+}
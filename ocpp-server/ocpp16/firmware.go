@@ -0,0 +1,81 @@
+package ocpp16
+
+// Firmware Management profile messages
+
+// DiagnosticsStatus is the progress of a diagnostics upload
+type DiagnosticsStatus string
+
+const (
+	DiagnosticsStatusIdle         DiagnosticsStatus = "Idle"
+	DiagnosticsStatusUploaded     DiagnosticsStatus = "Uploaded"
+	DiagnosticsStatusUploadFailed DiagnosticsStatus = "UploadFailed"
+	DiagnosticsStatusUploading    DiagnosticsStatus = "Uploading"
+)
+
+// FirmwareStatus is the progress of a firmware update
+type FirmwareStatus string
+
+const (
+	FirmwareStatusDownloaded         FirmwareStatus = "Downloaded"
+	FirmwareStatusDownloadFailed     FirmwareStatus = "DownloadFailed"
+	FirmwareStatusDownloading        FirmwareStatus = "Downloading"
+	FirmwareStatusIdle               FirmwareStatus = "Idle"
+	FirmwareStatusInstallationFailed FirmwareStatus = "InstallationFailed"
+	FirmwareStatusInstalling         FirmwareStatus = "Installing"
+	FirmwareStatusInstalled          FirmwareStatus = "Installed"
+)
+
+// DiagnosticsStatusNotificationRequest reports the progress of a diagnostics upload
+type DiagnosticsStatusNotificationRequest struct {
+	Status DiagnosticsStatus `json:"status"`
+}
+
+type DiagnosticsStatusNotificationConfirmation struct{}
+
+// FirmwareStatusNotificationRequest reports the progress of a firmware update
+type FirmwareStatusNotificationRequest struct {
+	Status FirmwareStatus `json:"status"`
+}
+
+type FirmwareStatusNotificationConfirmation struct{}
+
+// GetDiagnosticsRequest asks a charge point to upload its diagnostics to Location
+type GetDiagnosticsRequest struct {
+	Location      string    `json:"location"`
+	Retries       *int      `json:"retries,omitempty"`
+	RetryInterval *int      `json:"retryInterval,omitempty"`
+	StartTime     *DateTime `json:"startTime,omitempty"`
+	StopTime      *DateTime `json:"stopTime,omitempty"`
+}
+
+type GetDiagnosticsConfirmation struct {
+	FileName string `json:"fileName,omitempty"`
+}
+
+// UpdateFirmwareRequest asks a charge point to download and install firmware from Location
+type UpdateFirmwareRequest struct {
+	Location      string   `json:"location"`
+	Retries       *int     `json:"retries,omitempty"`
+	RetrieveDate  DateTime `json:"retrieveDate"`
+	RetryInterval *int     `json:"retryInterval,omitempty"`
+}
+
+type UpdateFirmwareConfirmation struct{}
+
+func (*DiagnosticsStatusNotificationRequest) Action() string { return "DiagnosticsStatusNotification" }
+func (*DiagnosticsStatusNotificationConfirmation) Action() string {
+	return "DiagnosticsStatusNotification"
+}
+func (*FirmwareStatusNotificationRequest) Action() string      { return "FirmwareStatusNotification" }
+func (*FirmwareStatusNotificationConfirmation) Action() string { return "FirmwareStatusNotification" }
+func (*GetDiagnosticsRequest) Action() string                  { return "GetDiagnostics" }
+func (*GetDiagnosticsConfirmation) Action() string             { return "GetDiagnostics" }
+func (*UpdateFirmwareRequest) Action() string                  { return "UpdateFirmware" }
+func (*UpdateFirmwareConfirmation) Action() string             { return "UpdateFirmware" }
+
+func init() {
+	register(&DiagnosticsStatusNotificationRequest{}, &DiagnosticsStatusNotificationConfirmation{})
+	register(&FirmwareStatusNotificationRequest{}, &FirmwareStatusNotificationConfirmation{})
+	register(&GetDiagnosticsRequest{}, &GetDiagnosticsConfirmation{})
+	register(&UpdateFirmwareRequest{}, &UpdateFirmwareConfirmation{})
+}
@@ -0,0 +1,49 @@
+package ocpp16
+
+// Local Auth List Management profile messages
+
+// UpdateType selects whether SendLocalList replaces or patches the local list
+type UpdateType string
+
+const (
+	UpdateTypeDifferential UpdateType = "Differential"
+	UpdateTypeFull         UpdateType = "Full"
+)
+
+// UpdateStatus is the answer to SendLocalList
+type UpdateStatus string
+
+const (
+	UpdateStatusAccepted        UpdateStatus = "Accepted"
+	UpdateStatusFailed          UpdateStatus = "Failed"
+	UpdateStatusNotSupported    UpdateStatus = "NotSupported"
+	UpdateStatusVersionMismatch UpdateStatus = "VersionMismatch"
+)
+
+// GetLocalListVersionRequest asks a charge point for the version of its local list
+type GetLocalListVersionRequest struct{}
+
+type GetLocalListVersionConfirmation struct {
+	ListVersion int `json:"listVersion"`
+}
+
+// SendLocalListRequest sends a full or differential local authorization list
+type SendLocalListRequest struct {
+	ListVersion            int                 `json:"listVersion"`
+	LocalAuthorizationList []AuthorizationData `json:"localAuthorizationList,omitempty"`
+	UpdateType             UpdateType          `json:"updateType"`
+}
+
+type SendLocalListConfirmation struct {
+	Status UpdateStatus `json:"status"`
+}
+
+func (*GetLocalListVersionRequest) Action() string      { return "GetLocalListVersion" }
+func (*GetLocalListVersionConfirmation) Action() string { return "GetLocalListVersion" }
+func (*SendLocalListRequest) Action() string            { return "SendLocalList" }
+func (*SendLocalListConfirmation) Action() string       { return "SendLocalList" }
+
+func init() {
+	register(&GetLocalListVersionRequest{}, &GetLocalListVersionConfirmation{})
+	register(&SendLocalListRequest{}, &SendLocalListConfirmation{})
+}
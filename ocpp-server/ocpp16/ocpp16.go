@@ -0,0 +1,216 @@
+// Package ocpp16 implements the OCPP 1.6 JSON (OCPP-J) message model: typed
+// requests and confirmations for every 1.6 action, RPC frame encoding and
+// validation against the official OCPP 1.6 JSON schemas.
+package ocpp16
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Subprotocol is the WebSocket subprotocol of OCPP 1.6 JSON
+const Subprotocol = "ocpp1.6"
+
+// OCPP-J message type numbers
+const (
+	CallType       = 2
+	CallResultType = 3
+	CallErrorType  = 4
+)
+
+// Request is the payload of a CALL
+type Request interface {
+	Action() string
+}
+
+// Confirmation is the payload of the CALLRESULT answering a Request
+type Confirmation interface {
+	Action() string
+}
+
+type actionTypes struct {
+	request      reflect.Type
+	confirmation reflect.Type
+}
+
+// actions maps every OCPP 1.6 action name onto its request and confirmation types
+var actions = make(map[string]actionTypes)
+
+func register(req Request, conf Confirmation) {
+	actions[req.Action()] = actionTypes{
+		request:      reflect.TypeOf(req).Elem(),
+		confirmation: reflect.TypeOf(conf).Elem(),
+	}
+}
+
+// IsKnownAction reports whether action is defined by OCPP 1.6
+func IsKnownAction(action string) bool {
+	_, ok := actions[action]
+	return ok
+}
+
+// ParseRequest validates a CALL payload and decodes it into the request type of action.
+// Errors are *Error values carrying the CALLERROR code to answer with.
+func ParseRequest(action string, payload json.RawMessage) (Request, error) {
+	types, ok := actions[action]
+	if !ok {
+		return nil, NewError(NotImplemented, "unknown action %s", action)
+	}
+	if err := validate(requestSchema(action), payload); err != nil {
+		return nil, err
+	}
+	req := reflect.New(types.request).Interface().(Request)
+	if err := decode(payload, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ParseConfirmation validates a CALLRESULT payload and decodes it into the confirmation type of action
+func ParseConfirmation(action string, payload json.RawMessage) (Confirmation, error) {
+	types, ok := actions[action]
+	if !ok {
+		return nil, NewError(NotImplemented, "unknown action %s", action)
+	}
+	if err := validate(confirmationSchema(action), payload); err != nil {
+		return nil, err
+	}
+	conf := reflect.New(types.confirmation).Interface().(Confirmation)
+	if err := decode(payload, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func decode(payload json.RawMessage, v interface{}) error {
+	err := json.Unmarshal(payload, v)
+	if err == nil {
+		return nil
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return NewError(TypeConstraintViolation, "%s: %v", typeErr.Field, err)
+	}
+	return NewError(PropertyConstraintViolation, "%v", err)
+}
+
+// Frame is a single OCPP-J RPC message: a CALL, CALLRESULT or CALLERROR
+type Frame struct {
+	Type      int
+	MessageID string
+	Action    string          // CALL only
+	Payload   json.RawMessage // CALL and CALLRESULT only
+	Error     *Error          // CALLERROR only
+}
+
+// NewCall builds a CALL frame, validating req against its schema
+func NewCall(messageID string, req Request) (*Frame, error) {
+	types, ok := actions[req.Action()]
+	if !ok || reflect.TypeOf(req) != reflect.PointerTo(types.request) {
+		return nil, fmt.Errorf("%s is not an OCPP 1.6 request", req.Action())
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(requestSchema(req.Action()), payload); err != nil {
+		return nil, fmt.Errorf("invalid %s request: %w", req.Action(), err)
+	}
+	return &Frame{Type: CallType, MessageID: messageID, Action: req.Action(), Payload: payload}, nil
+}
+
+// NewCallResult builds a CALLRESULT frame, validating conf against its schema
+func NewCallResult(messageID string, conf Confirmation) (*Frame, error) {
+	types, ok := actions[conf.Action()]
+	if !ok || reflect.TypeOf(conf) != reflect.PointerTo(types.confirmation) {
+		return nil, fmt.Errorf("%s is not an OCPP 1.6 confirmation", conf.Action())
+	}
+	payload, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(confirmationSchema(conf.Action()), payload); err != nil {
+		return nil, fmt.Errorf("invalid %s confirmation: %w", conf.Action(), err)
+	}
+	return &Frame{Type: CallResultType, MessageID: messageID, Payload: payload}, nil
+}
+
+// NewCallError builds a CALLERROR frame
+func NewCallError(messageID string, callErr *Error) *Frame {
+	return &Frame{Type: CallErrorType, MessageID: messageID, Error: callErr}
+}
+
+// ParseFrame decodes an OCPP-J message. When the frame is malformed the returned
+// error is an *Error, and the returned Frame still carries whatever type and
+// message ID could be read so that the caller can answer with a CALLERROR.
+func ParseFrame(data []byte) (*Frame, error) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return &Frame{}, NewError(FormationViolation, "message is not a JSON array")
+	}
+	if len(fields) < 2 {
+		return &Frame{}, NewError(FormationViolation, "message has %d elements", len(fields))
+	}
+
+	frame := &Frame{}
+	if err := json.Unmarshal(fields[0], &frame.Type); err != nil {
+		return &Frame{}, NewError(FormationViolation, "message type must be a number")
+	}
+	if err := json.Unmarshal(fields[1], &frame.MessageID); err != nil {
+		return &Frame{Type: frame.Type}, NewError(FormationViolation, "message ID must be a string")
+	}
+
+	switch frame.Type {
+	case CallType:
+		if len(fields) < 3 {
+			return frame, NewError(FormationViolation, "CALL without action")
+		}
+		if err := json.Unmarshal(fields[2], &frame.Action); err != nil {
+			return frame, NewError(FormationViolation, "action must be a string")
+		}
+		frame.Payload = payloadField(fields, 3)
+	case CallResultType:
+		frame.Payload = payloadField(fields, 2)
+	case CallErrorType:
+		frame.Error = &Error{Code: GenericError}
+		if len(fields) > 2 {
+			json.Unmarshal(fields[2], &frame.Error.Code)
+		}
+		if len(fields) > 3 {
+			json.Unmarshal(fields[3], &frame.Error.Description)
+		}
+		if len(fields) > 4 {
+			json.Unmarshal(fields[4], &frame.Error.Details)
+		}
+	default:
+		return frame, NewError(FormationViolation, "unknown message type %d", frame.Type)
+	}
+	return frame, nil
+}
+
+// payloadField returns fields[i], treating a missing or null payload as an empty object
+func payloadField(fields []json.RawMessage, i int) json.RawMessage {
+	if len(fields) <= i || string(fields[i]) == "null" {
+		return json.RawMessage("{}")
+	}
+	return fields[i]
+}
+
+func (f *Frame) MarshalJSON() ([]byte, error) {
+	switch f.Type {
+	case CallType:
+		return json.Marshal([]interface{}{f.Type, f.MessageID, f.Action, f.Payload})
+	case CallResultType:
+		return json.Marshal([]interface{}{f.Type, f.MessageID, f.Payload})
+	case CallErrorType:
+		details := f.Error.Details
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		return json.Marshal([]interface{}{f.Type, f.MessageID, f.Error.Code, f.Error.Description, details})
+	default:
+		return nil, fmt.Errorf("unknown message type %d", f.Type)
+	}
+}
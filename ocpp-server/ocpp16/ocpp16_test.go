@@ -0,0 +1,272 @@
+package ocpp16
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     Frame
+		wantCode ErrorCode
+	}{
+		{
+			name: "CALL",
+			data: `[2,"1","Heartbeat",{}]`,
+			want: Frame{Type: CallType, MessageID: "1", Action: "Heartbeat", Payload: json.RawMessage(`{}`)},
+		},
+		{
+			name: "CALL without payload",
+			data: `[2,"1","Heartbeat"]`,
+			want: Frame{Type: CallType, MessageID: "1", Action: "Heartbeat", Payload: json.RawMessage(`{}`)},
+		},
+		{
+			name: "CALL with a null payload",
+			data: `[2,"1","Heartbeat",null]`,
+			want: Frame{Type: CallType, MessageID: "1", Action: "Heartbeat", Payload: json.RawMessage(`{}`)},
+		},
+		{
+			name: "CALLRESULT",
+			data: `[3,"2",{"currentTime":"2024-01-01T00:00:00Z"}]`,
+			want: Frame{Type: CallResultType, MessageID: "2", Payload: json.RawMessage(`{"currentTime":"2024-01-01T00:00:00Z"}`)},
+		},
+		{
+			name: "CALLERROR",
+			data: `[4,"3","NotSupported","no way",{}]`,
+			want: Frame{Type: CallErrorType, MessageID: "3", Error: &Error{Code: NotSupported, Description: "no way"}},
+		},
+		{
+			name: "CALLERROR without code",
+			data: `[4,"3"]`,
+			want: Frame{Type: CallErrorType, MessageID: "3", Error: &Error{Code: GenericError}},
+		},
+		{
+			name:     "not an array",
+			data:     `{"type":2}`,
+			wantCode: FormationViolation,
+		},
+		{
+			name:     "too short",
+			data:     `[2]`,
+			wantCode: FormationViolation,
+		},
+		{
+			name:     "message type not a number",
+			data:     `["2","1","Heartbeat",{}]`,
+			wantCode: FormationViolation,
+		},
+		{
+			name:     "message ID not a string",
+			data:     `[2,1,"Heartbeat",{}]`,
+			want:     Frame{Type: CallType},
+			wantCode: FormationViolation,
+		},
+		{
+			name:     "CALL without action",
+			data:     `[2,"1"]`,
+			want:     Frame{Type: CallType, MessageID: "1"},
+			wantCode: FormationViolation,
+		},
+		{
+			name:     "unknown message type",
+			data:     `[5,"1",{}]`,
+			want:     Frame{Type: 5, MessageID: "1"},
+			wantCode: FormationViolation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := ParseFrame([]byte(tt.data))
+			if tt.wantCode != "" {
+				var callErr *Error
+				if !errors.As(err, &callErr) || callErr.Code != tt.wantCode {
+					t.Fatalf("error %v, want %s", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			// Even a malformed frame keeps what was read, to answer with a CALLERROR
+			if frame.Type != tt.want.Type || frame.MessageID != tt.want.MessageID || frame.Action != tt.want.Action {
+				t.Errorf("got %+v, want %+v", frame, tt.want)
+			}
+			if string(frame.Payload) != string(tt.want.Payload) {
+				t.Errorf("payload %s, want %s", frame.Payload, tt.want.Payload)
+			}
+			if (frame.Error == nil) != (tt.want.Error == nil) ||
+				frame.Error != nil && (frame.Error.Code != tt.want.Error.Code || frame.Error.Description != tt.want.Error.Description) {
+				t.Errorf("error %+v, want %+v", frame.Error, tt.want.Error)
+			}
+		})
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame *Frame
+		want  string
+	}{
+		{
+			name:  "CALL",
+			frame: &Frame{Type: CallType, MessageID: "1", Action: "Heartbeat", Payload: json.RawMessage(`{}`)},
+			want:  `[2,"1","Heartbeat",{}]`,
+		},
+		{
+			name:  "CALLRESULT",
+			frame: &Frame{Type: CallResultType, MessageID: "1", Payload: json.RawMessage(`{"status":"Accepted"}`)},
+			want:  `[3,"1",{"status":"Accepted"}]`,
+		},
+		{
+			name:  "CALLERROR without details",
+			frame: NewCallError("1", NewError(NotImplemented, "unknown action %s", "Foo")),
+			want:  `[4,"1","NotImplemented","unknown action Foo",{}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("encoded %s, want %s", data, tt.want)
+			}
+			if _, err := ParseFrame(data); err != nil {
+				t.Errorf("encoded frame does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   string
+		payload  string
+		wantCode ErrorCode
+	}{
+		{
+			name:    "valid BootNotification",
+			action:  "BootNotification",
+			payload: `{"chargePointVendor":"acme","chargePointModel":"ac22"}`,
+		},
+		{
+			name:    "valid MeterValues",
+			action:  "MeterValues",
+			payload: `{"connectorId":1,"meterValue":[{"timestamp":"2024-01-01T00:00:00Z","sampledValue":[{"value":"1234","unit":"Wh"}]}]}`,
+		},
+		{
+			name:     "unknown action",
+			action:   "Teleport",
+			payload:  `{}`,
+			wantCode: NotImplemented,
+		},
+		{
+			name:     "missing required property",
+			action:   "BootNotification",
+			payload:  `{"chargePointVendor":"acme"}`,
+			wantCode: OccurenceConstraintViolation,
+		},
+		{
+			name:     "wrong type",
+			action:   "StatusNotification",
+			payload:  `{"connectorId":"1","errorCode":"NoError","status":"Available"}`,
+			wantCode: TypeConstraintViolation,
+		},
+		{
+			name:     "unknown property",
+			action:   "Heartbeat",
+			payload:  `{"uptime":5}`,
+			wantCode: FormationViolation,
+		},
+		{
+			name:     "value outside its enumeration",
+			action:   "StatusNotification",
+			payload:  `{"connectorId":1,"errorCode":"NoError","status":"Sleeping"}`,
+			wantCode: PropertyConstraintViolation,
+		},
+		{
+			name:     "string too long",
+			action:   "Authorize",
+			payload:  `{"idTag":"0123456789012345678901"}`,
+			wantCode: PropertyConstraintViolation,
+		},
+		{
+			name:     "payload not an object",
+			action:   "Heartbeat",
+			payload:  `[]`,
+			wantCode: FormationViolation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseRequest(tt.action, json.RawMessage(tt.payload))
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if req.Action() != tt.action {
+					t.Errorf("decoded a %s request", req.Action())
+				}
+				return
+			}
+			var callErr *Error
+			if !errors.As(err, &callErr) || callErr.Code != tt.wantCode {
+				t.Errorf("error %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestParseRequestDecodes(t *testing.T) {
+	req, err := ParseRequest("StartTransaction", json.RawMessage(
+		`{"connectorId":2,"idTag":"TAG1","meterStart":1500,"timestamp":"2024-01-01T12:00:00Z"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, ok := req.(*StartTransactionRequest)
+	if !ok {
+		t.Fatalf("decoded %T", req)
+	}
+	if start.ConnectorId != 2 || start.IdTag != "TAG1" || start.MeterStart != 1500 || start.Timestamp.Hour() != 12 {
+		t.Errorf("decoded %+v", start)
+	}
+}
+
+func TestNewCallValidates(t *testing.T) {
+	if _, err := NewCall("1", &ChangeAvailabilityRequest{ConnectorId: 0, Type: "Operative"}); err != nil {
+		t.Errorf("valid request rejected: %v", err)
+	}
+	if _, err := NewCall("1", &ChangeAvailabilityRequest{ConnectorId: 0, Type: "Sometimes"}); err == nil {
+		t.Error("request outside its schema accepted")
+	}
+	if _, err := NewCallResult("1", &BootNotificationConfirmation{Status: "Maybe", Interval: 300}); err == nil {
+		t.Error("confirmation outside its schema accepted")
+	}
+	if _, err := NewCallResult("1", &HeartbeatRequest{}); err == nil {
+		t.Error("request sent as a confirmation")
+	}
+}
+
+func TestParseConfirmation(t *testing.T) {
+	conf, err := ParseConfirmation("RemoteStartTransaction", json.RawMessage(`{"status":"Rejected"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote := conf.(*RemoteStartTransactionConfirmation); remote.Status != "Rejected" {
+		t.Errorf("decoded %+v", remote)
+	}
+
+	var callErr *Error
+	_, err = ParseConfirmation("RemoteStartTransaction", json.RawMessage(`{"status":"Maybe"}`))
+	if !errors.As(err, &callErr) || callErr.Code != PropertyConstraintViolation {
+		t.Errorf("error %v, want %s", err, PropertyConstraintViolation)
+	}
+}
@@ -0,0 +1,32 @@
+package ocpp16
+
+// Remote Trigger profile messages
+
+// MessageTrigger is a message a charge point can be asked to send with TriggerMessage
+type MessageTrigger string
+
+const (
+	TriggerBootNotification              MessageTrigger = "BootNotification"
+	TriggerDiagnosticsStatusNotification MessageTrigger = "DiagnosticsStatusNotification"
+	TriggerFirmwareStatusNotification    MessageTrigger = "FirmwareStatusNotification"
+	TriggerHeartbeat                     MessageTrigger = "Heartbeat"
+	TriggerMeterValues                   MessageTrigger = "MeterValues"
+	TriggerStatusNotification            MessageTrigger = "StatusNotification"
+)
+
+// TriggerMessageRequest asks a charge point to send a specific message
+type TriggerMessageRequest struct {
+	RequestedMessage MessageTrigger `json:"requestedMessage"`
+	ConnectorId      *int           `json:"connectorId,omitempty"`
+}
+
+type TriggerMessageConfirmation struct {
+	Status string `json:"status"`
+}
+
+func (*TriggerMessageRequest) Action() string      { return "TriggerMessage" }
+func (*TriggerMessageConfirmation) Action() string { return "TriggerMessage" }
+
+func init() {
+	register(&TriggerMessageRequest{}, &TriggerMessageConfirmation{})
+}
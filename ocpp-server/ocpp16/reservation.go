@@ -0,0 +1,54 @@
+package ocpp16
+
+// Reservation profile messages
+
+// ReservationStatus is the answer to ReserveNow
+type ReservationStatus string
+
+const (
+	ReservationStatusAccepted    ReservationStatus = "Accepted"
+	ReservationStatusFaulted     ReservationStatus = "Faulted"
+	ReservationStatusOccupied    ReservationStatus = "Occupied"
+	ReservationStatusRejected    ReservationStatus = "Rejected"
+	ReservationStatusUnavailable ReservationStatus = "Unavailable"
+)
+
+// CancelReservationStatus is the answer to CancelReservation
+type CancelReservationStatus string
+
+const (
+	CancelReservationStatusAccepted CancelReservationStatus = "Accepted"
+	CancelReservationStatusRejected CancelReservationStatus = "Rejected"
+)
+
+// CancelReservationRequest asks a charge point to cancel a reservation
+type CancelReservationRequest struct {
+	ReservationId int `json:"reservationId"`
+}
+
+type CancelReservationConfirmation struct {
+	Status CancelReservationStatus `json:"status"`
+}
+
+// ReserveNowRequest asks a charge point to reserve a connector for an idTag
+type ReserveNowRequest struct {
+	ConnectorId   int      `json:"connectorId"`
+	ExpiryDate    DateTime `json:"expiryDate"`
+	IdTag         string   `json:"idTag"`
+	ParentIdTag   string   `json:"parentIdTag,omitempty"`
+	ReservationId int      `json:"reservationId"`
+}
+
+type ReserveNowConfirmation struct {
+	Status ReservationStatus `json:"status"`
+}
+
+func (*CancelReservationRequest) Action() string      { return "CancelReservation" }
+func (*CancelReservationConfirmation) Action() string { return "CancelReservation" }
+func (*ReserveNowRequest) Action() string             { return "ReserveNow" }
+func (*ReserveNowConfirmation) Action() string        { return "ReserveNow" }
+
+func init() {
+	register(&CancelReservationRequest{}, &CancelReservationConfirmation{})
+	register(&ReserveNowRequest{}, &ReserveNowConfirmation{})
+}
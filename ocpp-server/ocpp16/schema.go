@@ -0,0 +1,109 @@
+package ocpp16
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaFS holds the official OCPP 1.6 JSON schemas, one <Action>.json per
+// request and one <Action>Response.json per confirmation
+//
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+var (
+	requestSchemas      = make(map[string]*jsonschema.Schema)
+	confirmationSchemas = make(map[string]*jsonschema.Schema)
+	compileOnce         sync.Once
+)
+
+// requestSchema returns the compiled schema for the request of action
+func requestSchema(action string) *jsonschema.Schema {
+	compileOnce.Do(compileSchemas)
+	return requestSchemas[action]
+}
+
+// confirmationSchema returns the compiled schema for the confirmation of action
+func confirmationSchema(action string) *jsonschema.Schema {
+	compileOnce.Do(compileSchemas)
+	return confirmationSchemas[action]
+}
+
+// compileSchemas compiles the embedded schemas of every registered action.
+// It runs on first use, once every profile file has registered its actions.
+func compileSchemas() {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft4
+
+	compile := func(name string) *jsonschema.Schema {
+		file := path.Join("schemas", name+".json")
+		data, err := schemaFS.ReadFile(file)
+		if err != nil {
+			panic(fmt.Sprintf("ocpp16: missing schema %s: %v", file, err))
+		}
+		if err := compiler.AddResource(file, bytes.NewReader(data)); err != nil {
+			panic(fmt.Sprintf("ocpp16: invalid schema %s: %v", file, err))
+		}
+		return compiler.MustCompile(file)
+	}
+
+	for action := range actions {
+		requestSchemas[action] = compile(action)
+		confirmationSchemas[action] = compile(action + "Response")
+	}
+}
+
+// validate checks payload against schema and converts violations into the matching CALLERROR code
+func validate(schema *jsonschema.Schema, payload json.RawMessage) error {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return NewError(FormationViolation, "payload is not valid JSON: %v", err)
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return NewError(FormationViolation, "payload must be a JSON object")
+	}
+
+	err := schema.Validate(v)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return NewError(InternalError, "schema validation failed: %v", err)
+	}
+
+	leaf := validationErr
+	for len(leaf.Causes) > 0 {
+		leaf = leaf.Causes[0]
+	}
+	keyword := leaf.KeywordLocation[strings.LastIndex(leaf.KeywordLocation, "/")+1:]
+	location := leaf.InstanceLocation
+	if location == "" {
+		location = "/"
+	}
+	return NewError(errorCodeForKeyword(keyword), "%s: %s", location, leaf.Message)
+}
+
+// errorCodeForKeyword maps a failing JSON schema keyword onto an OCPP-J error code
+func errorCodeForKeyword(keyword string) ErrorCode {
+	switch keyword {
+	case "required":
+		return OccurenceConstraintViolation
+	case "type":
+		return TypeConstraintViolation
+	case "additionalProperties":
+		return FormationViolation
+	default:
+		return PropertyConstraintViolation
+	}
+}
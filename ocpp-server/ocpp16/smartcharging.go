@@ -0,0 +1,69 @@
+package ocpp16
+
+// Smart Charging profile messages
+
+// ChargingProfileStatus is the answer to SetChargingProfile
+type ChargingProfileStatus string
+
+const (
+	ChargingProfileStatusAccepted     ChargingProfileStatus = "Accepted"
+	ChargingProfileStatusRejected     ChargingProfileStatus = "Rejected"
+	ChargingProfileStatusNotSupported ChargingProfileStatus = "NotSupported"
+)
+
+// ClearChargingProfileStatus is the answer to ClearChargingProfile
+type ClearChargingProfileStatus string
+
+const (
+	ClearChargingProfileStatusAccepted ClearChargingProfileStatus = "Accepted"
+	ClearChargingProfileStatusUnknown  ClearChargingProfileStatus = "Unknown"
+)
+
+// ClearChargingProfileRequest asks a charge point to remove the profiles matching all given criteria
+type ClearChargingProfileRequest struct {
+	Id                     *int                   `json:"id,omitempty"`
+	ConnectorId            *int                   `json:"connectorId,omitempty"`
+	ChargingProfilePurpose ChargingProfilePurpose `json:"chargingProfilePurpose,omitempty"`
+	StackLevel             *int                   `json:"stackLevel,omitempty"`
+}
+
+type ClearChargingProfileConfirmation struct {
+	Status ClearChargingProfileStatus `json:"status"`
+}
+
+// GetCompositeScheduleRequest asks a charge point for its effective schedule on a connector
+type GetCompositeScheduleRequest struct {
+	ConnectorId      int              `json:"connectorId"`
+	Duration         int              `json:"duration"`
+	ChargingRateUnit ChargingRateUnit `json:"chargingRateUnit,omitempty"`
+}
+
+type GetCompositeScheduleConfirmation struct {
+	Status           string            `json:"status"`
+	ConnectorId      *int              `json:"connectorId,omitempty"`
+	ScheduleStart    *DateTime         `json:"scheduleStart,omitempty"`
+	ChargingSchedule *ChargingSchedule `json:"chargingSchedule,omitempty"`
+}
+
+// SetChargingProfileRequest installs a charging profile on a connector (0 for the whole charge point)
+type SetChargingProfileRequest struct {
+	ConnectorId        int             `json:"connectorId"`
+	CsChargingProfiles ChargingProfile `json:"csChargingProfiles"`
+}
+
+type SetChargingProfileConfirmation struct {
+	Status ChargingProfileStatus `json:"status"`
+}
+
+func (*ClearChargingProfileRequest) Action() string      { return "ClearChargingProfile" }
+func (*ClearChargingProfileConfirmation) Action() string { return "ClearChargingProfile" }
+func (*GetCompositeScheduleRequest) Action() string      { return "GetCompositeSchedule" }
+func (*GetCompositeScheduleConfirmation) Action() string { return "GetCompositeSchedule" }
+func (*SetChargingProfileRequest) Action() string        { return "SetChargingProfile" }
+func (*SetChargingProfileConfirmation) Action() string   { return "SetChargingProfile" }
+
+func init() {
+	register(&ClearChargingProfileRequest{}, &ClearChargingProfileConfirmation{})
+	register(&GetCompositeScheduleRequest{}, &GetCompositeScheduleConfirmation{})
+	register(&SetChargingProfileRequest{}, &SetChargingProfileConfirmation{})
+}
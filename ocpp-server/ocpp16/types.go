@@ -0,0 +1,228 @@
+package ocpp16
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateTime is an OCPP dateTime, serialized as RFC 3339 in UTC
+type DateTime struct {
+	time.Time
+}
+
+// NewDateTime wraps t as a DateTime
+func NewDateTime(t time.Time) *DateTime {
+	return &DateTime{Time: t}
+}
+
+func (d DateTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.UTC().Format("2006-01-02T15:04:05.000Z"))
+}
+
+func (d *DateTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("dateTime must be a string")
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid dateTime %q", s)
+	}
+	d.Time = t
+	return nil
+}
+
+// AuthorizationStatus is the status field of IdTagInfo
+type AuthorizationStatus string
+
+const (
+	AuthorizationStatusAccepted     AuthorizationStatus = "Accepted"
+	AuthorizationStatusBlocked      AuthorizationStatus = "Blocked"
+	AuthorizationStatusExpired      AuthorizationStatus = "Expired"
+	AuthorizationStatusInvalid      AuthorizationStatus = "Invalid"
+	AuthorizationStatusConcurrentTx AuthorizationStatus = "ConcurrentTx"
+)
+
+// IdTagInfo carries the authorization status of an idTag
+type IdTagInfo struct {
+	ExpiryDate  *DateTime           `json:"expiryDate,omitempty"`
+	ParentIdTag string              `json:"parentIdTag,omitempty"`
+	Status      AuthorizationStatus `json:"status"`
+}
+
+// ChargePointStatus is the status reported in a StatusNotification
+type ChargePointStatus string
+
+const (
+	ChargePointStatusAvailable     ChargePointStatus = "Available"
+	ChargePointStatusPreparing     ChargePointStatus = "Preparing"
+	ChargePointStatusCharging      ChargePointStatus = "Charging"
+	ChargePointStatusSuspendedEVSE ChargePointStatus = "SuspendedEVSE"
+	ChargePointStatusSuspendedEV   ChargePointStatus = "SuspendedEV"
+	ChargePointStatusFinishing     ChargePointStatus = "Finishing"
+	ChargePointStatusReserved      ChargePointStatus = "Reserved"
+	ChargePointStatusUnavailable   ChargePointStatus = "Unavailable"
+	ChargePointStatusFaulted       ChargePointStatus = "Faulted"
+)
+
+// ChargePointErrorCode is the errorCode reported in a StatusNotification
+type ChargePointErrorCode string
+
+const (
+	ConnectorLockFailure ChargePointErrorCode = "ConnectorLockFailure"
+	EVCommunicationError ChargePointErrorCode = "EVCommunicationError"
+	GroundFailure        ChargePointErrorCode = "GroundFailure"
+	HighTemperature      ChargePointErrorCode = "HighTemperature"
+	InternalErrorCode    ChargePointErrorCode = "InternalError"
+	LocalListConflict    ChargePointErrorCode = "LocalListConflict"
+	NoError              ChargePointErrorCode = "NoError"
+	OtherError           ChargePointErrorCode = "OtherError"
+	OverCurrentFailure   ChargePointErrorCode = "OverCurrentFailure"
+	PowerMeterFailure    ChargePointErrorCode = "PowerMeterFailure"
+	PowerSwitchFailure   ChargePointErrorCode = "PowerSwitchFailure"
+	ReaderFailure        ChargePointErrorCode = "ReaderFailure"
+	ResetFailure         ChargePointErrorCode = "ResetFailure"
+	UnderVoltage         ChargePointErrorCode = "UnderVoltage"
+	OverVoltage          ChargePointErrorCode = "OverVoltage"
+	WeakSignal           ChargePointErrorCode = "WeakSignal"
+)
+
+// Reason is the reason a transaction was stopped
+type Reason string
+
+const (
+	ReasonEmergencyStop  Reason = "EmergencyStop"
+	ReasonEVDisconnected Reason = "EVDisconnected"
+	ReasonHardReset      Reason = "HardReset"
+	ReasonLocal          Reason = "Local"
+	ReasonOther          Reason = "Other"
+	ReasonPowerLoss      Reason = "PowerLoss"
+	ReasonReboot         Reason = "Reboot"
+	ReasonRemote         Reason = "Remote"
+	ReasonSoftReset      Reason = "SoftReset"
+	ReasonUnlockCommand  Reason = "UnlockCommand"
+	ReasonDeAuthorized   Reason = "DeAuthorized"
+)
+
+// Measurand identifies the quantity of a SampledValue
+type Measurand string
+
+const (
+	MeasurandEnergyActiveExportRegister   Measurand = "Energy.Active.Export.Register"
+	MeasurandEnergyActiveImportRegister   Measurand = "Energy.Active.Import.Register"
+	MeasurandEnergyReactiveExportRegister Measurand = "Energy.Reactive.Export.Register"
+	MeasurandEnergyReactiveImportRegister Measurand = "Energy.Reactive.Import.Register"
+	MeasurandEnergyActiveExportInterval   Measurand = "Energy.Active.Export.Interval"
+	MeasurandEnergyActiveImportInterval   Measurand = "Energy.Active.Import.Interval"
+	MeasurandEnergyReactiveExportInterval Measurand = "Energy.Reactive.Export.Interval"
+	MeasurandEnergyReactiveImportInterval Measurand = "Energy.Reactive.Import.Interval"
+	MeasurandPowerActiveExport            Measurand = "Power.Active.Export"
+	MeasurandPowerActiveImport            Measurand = "Power.Active.Import"
+	MeasurandPowerOffered                 Measurand = "Power.Offered"
+	MeasurandPowerReactiveExport          Measurand = "Power.Reactive.Export"
+	MeasurandPowerReactiveImport          Measurand = "Power.Reactive.Import"
+	MeasurandPowerFactor                  Measurand = "Power.Factor"
+	MeasurandCurrentImport                Measurand = "Current.Import"
+	MeasurandCurrentExport                Measurand = "Current.Export"
+	MeasurandCurrentOffered               Measurand = "Current.Offered"
+	MeasurandVoltage                      Measurand = "Voltage"
+	MeasurandFrequency                    Measurand = "Frequency"
+	MeasurandTemperature                  Measurand = "Temperature"
+	MeasurandSoC                          Measurand = "SoC"
+	MeasurandRPM                          Measurand = "RPM"
+)
+
+// SampledValue is a single measured value within a MeterValue
+type SampledValue struct {
+	Value     string    `json:"value"`
+	Context   string    `json:"context,omitempty"`
+	Format    string    `json:"format,omitempty"`
+	Measurand Measurand `json:"measurand,omitempty"`
+	Phase     string    `json:"phase,omitempty"`
+	Location  string    `json:"location,omitempty"`
+	Unit      string    `json:"unit,omitempty"`
+}
+
+// MeterValue is a set of sampled values taken at the same point in time
+type MeterValue struct {
+	Timestamp    DateTime       `json:"timestamp"`
+	SampledValue []SampledValue `json:"sampledValue"`
+}
+
+// ChargingRateUnit is the unit of a charging schedule limit
+type ChargingRateUnit string
+
+const (
+	ChargingRateUnitAmperes ChargingRateUnit = "A"
+	ChargingRateUnitWatts   ChargingRateUnit = "W"
+)
+
+// ChargingProfilePurpose selects which profile stack a ChargingProfile belongs to
+type ChargingProfilePurpose string
+
+const (
+	ChargePointMaxProfile ChargingProfilePurpose = "ChargePointMaxProfile"
+	TxDefaultProfile      ChargingProfilePurpose = "TxDefaultProfile"
+	TxProfile             ChargingProfilePurpose = "TxProfile"
+)
+
+// ChargingProfileKind defines how a charging schedule is anchored in time
+type ChargingProfileKind string
+
+const (
+	ChargingProfileKindAbsolute  ChargingProfileKind = "Absolute"
+	ChargingProfileKindRecurring ChargingProfileKind = "Recurring"
+	ChargingProfileKindRelative  ChargingProfileKind = "Relative"
+)
+
+// RecurrencyKind is the recurrence period of a Recurring charging profile
+type RecurrencyKind string
+
+const (
+	RecurrencyKindDaily  RecurrencyKind = "Daily"
+	RecurrencyKindWeekly RecurrencyKind = "Weekly"
+)
+
+// ChargingSchedulePeriod is one limit within a charging schedule
+type ChargingSchedulePeriod struct {
+	StartPeriod  int     `json:"startPeriod"`
+	Limit        float64 `json:"limit"`
+	NumberPhases *int    `json:"numberPhases,omitempty"`
+}
+
+// ChargingSchedule is a list of limits over time
+type ChargingSchedule struct {
+	Duration               *int                     `json:"duration,omitempty"`
+	StartSchedule          *DateTime                `json:"startSchedule,omitempty"`
+	ChargingRateUnit       ChargingRateUnit         `json:"chargingRateUnit"`
+	ChargingSchedulePeriod []ChargingSchedulePeriod `json:"chargingSchedulePeriod"`
+	MinChargingRate        *float64                 `json:"minChargingRate,omitempty"`
+}
+
+// ChargingProfile is a smart charging profile as sent to a charge point
+type ChargingProfile struct {
+	ChargingProfileId      int                    `json:"chargingProfileId"`
+	TransactionId          *int                   `json:"transactionId,omitempty"`
+	StackLevel             int                    `json:"stackLevel"`
+	ChargingProfilePurpose ChargingProfilePurpose `json:"chargingProfilePurpose"`
+	ChargingProfileKind    ChargingProfileKind    `json:"chargingProfileKind"`
+	RecurrencyKind         RecurrencyKind         `json:"recurrencyKind,omitempty"`
+	ValidFrom              *DateTime              `json:"validFrom,omitempty"`
+	ValidTo                *DateTime              `json:"validTo,omitempty"`
+	ChargingSchedule       ChargingSchedule       `json:"chargingSchedule"`
+}
+
+// AuthorizationData is one entry of a local authorization list
+type AuthorizationData struct {
+	IdTag     string     `json:"idTag"`
+	IdTagInfo *IdTagInfo `json:"idTagInfo,omitempty"`
+}
+
+// KeyValue is one configuration key reported by GetConfiguration
+type KeyValue struct {
+	Key      string  `json:"key"`
+	Readonly bool    `json:"readonly"`
+	Value    *string `json:"value,omitempty"`
+}
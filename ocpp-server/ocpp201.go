@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+)
+
+// OCPP 2.0.1 chargers are stored like 1.6 ones: an EVSE is recorded as the
+// connector with the same number, IdTokens are looked up as idTags and
+// TransactionEvents fill the same transaction and meter_value rows.
+
+// energyRegisterMeasurand is the default measurand of a sampled value
+const energyRegisterMeasurand = "Energy.Active.Import.Register"
+
+// handleCallFrame201 answers a CALL from an OCPP 2.0.1 charger
+func (s *OCPPServer) handleCallFrame201(charger *Charger, frame *ocpp16.Frame) {
+	if frame.Action != "BootNotification" && charger.RegistrationStatus() != ocpp16.RegistrationStatusAccepted {
+		log.Printf("Refused %s from %s: charger not accepted", frame.Action, charger.ID)
+		s.sendCallError(charger, frame.MessageID, ocpp16.NewError(ocpp201.SecurityError, "charging station is not accepted by the CSMS"))
+		return
+	}
+
+	request, err := ocpp201.ParseRequest(frame.Action, frame.Payload)
+	if err != nil {
+		log.Printf("Rejected %s from %s: %v", frame.Action, charger.ID, err)
+		s.sendCallError(charger, frame.MessageID, toOCPPError(err))
+		return
+	}
+
+	response, err := s.handleCall201(charger.ID, request)
+	if err != nil {
+		log.Printf("Failed to handle %s from %s: %v", frame.Action, charger.ID, err)
+		s.sendCallError(charger, frame.MessageID, toOCPPError(err))
+		return
+	}
+	s.sendCallResult(charger, frame.MessageID, response)
+	s.deliverTriggered(charger, request)
+	s.afterCall(charger.ID, request)
+}
+
+// handleCall201 dispatches a validated OCPP 2.0.1 request to its handler
+func (s *OCPPServer) handleCall201(chargerID string, request ocpp201.Request) (ocpp201.Response, error) {
+	switch req := request.(type) {
+	case *ocpp201.BootNotificationRequest:
+		return s.handleBootNotification201(chargerID, req)
+	case *ocpp201.HeartbeatRequest:
+		return &ocpp201.HeartbeatResponse{CurrentTime: ocpp201.DateTime{Time: time.Now()}}, nil
+	case *ocpp201.StatusNotificationRequest:
+		return s.handleStatusNotification201(chargerID, req), nil
+	case *ocpp201.AuthorizeRequest:
+		return s.handleAuthorize201(chargerID, req)
+	case *ocpp201.TransactionEventRequest:
+		return s.handleOnce(chargerID, req, parseResponse201, func() (ocpp16.Confirmation, error) { return s.handleTransactionEvent(chargerID, req) })
+	default:
+		log.Printf("Unsupported action %s from %s", request.Action(), chargerID)
+		return nil, ocpp16.NewError(ocpp201.NotImplemented, "action %s is not implemented", request.Action())
+	}
+}
+
+// handleBootNotification201 registers a charging station through the 1.6 boot handling
+func (s *OCPPServer) handleBootNotification201(chargerID string, req *ocpp201.BootNotificationRequest) (*ocpp201.BootNotificationResponse, error) {
+	boot := &ocpp16.BootNotificationRequest{
+		ChargePointVendor:       req.ChargingStation.VendorName,
+		ChargePointModel:        req.ChargingStation.Model,
+		ChargePointSerialNumber: req.ChargingStation.SerialNumber,
+		FirmwareVersion:         req.ChargingStation.FirmwareVersion,
+	}
+	if modem := req.ChargingStation.Modem; modem != nil {
+		boot.Iccid = modem.Iccid
+		boot.Imsi = modem.Imsi
+	}
+
+	conf, err := s.handleBootNotification(chargerID, boot)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2.0.1 has no connector 0 to report on the station as a whole
+	if conf.Status == ocpp16.RegistrationStatusAccepted {
+		if err := updateChargerStatus(chargerID, string(ocpp16.ChargePointStatusAvailable)); err != nil {
+			log.Printf("DB update error for charger %s: %v", chargerID, err)
+		}
+	}
+
+	return &ocpp201.BootNotificationResponse{
+		CurrentTime: conf.CurrentTime,
+		Interval:    conf.Interval,
+		Status:      ocpp201.RegistrationStatus(conf.Status),
+	}, nil
+}
+
+// connectorStatus16 maps a 2.0.1 connector status onto the closest 1.6 status;
+// TransactionEvents refine Occupied into Charging, SuspendedEV, etc.
+func connectorStatus16(status ocpp201.ConnectorStatus) (ocpp16.ChargePointStatus, ocpp16.ChargePointErrorCode) {
+	switch status {
+	case ocpp201.ConnectorStatusOccupied:
+		return ocpp16.ChargePointStatusPreparing, ocpp16.NoError
+	case ocpp201.ConnectorStatusReserved:
+		return ocpp16.ChargePointStatusReserved, ocpp16.NoError
+	case ocpp201.ConnectorStatusUnavailable:
+		return ocpp16.ChargePointStatusUnavailable, ocpp16.NoError
+	case ocpp201.ConnectorStatusFaulted:
+		return ocpp16.ChargePointStatusFaulted, ocpp16.OtherError
+	default:
+		return ocpp16.ChargePointStatusAvailable, ocpp16.NoError
+	}
+}
+
+func (s *OCPPServer) handleStatusNotification201(chargerID string, req *ocpp201.StatusNotificationRequest) *ocpp201.StatusNotificationResponse {
+	status, errorCode := connectorStatus16(req.ConnectorStatus)
+	s.handleStatusNotification(chargerID, &ocpp16.StatusNotificationRequest{
+		ConnectorId: req.EvseId,
+		ErrorCode:   errorCode,
+		Status:      status,
+		Timestamp:   &req.Timestamp,
+	})
+	return &ocpp201.StatusNotificationResponse{}
+}
+
+// idTokenInfo converts the authorization of an idTag into a 2.0.1 IdTokenInfo
+func idTokenInfo(info ocpp16.IdTagInfo) *ocpp201.IdTokenInfo {
+	tokenInfo := &ocpp201.IdTokenInfo{
+		Status:              ocpp201.AuthorizationStatus(info.Status),
+		CacheExpiryDateTime: info.ExpiryDate,
+	}
+	if info.ParentIdTag != "" {
+		tokenInfo.GroupIdToken = &ocpp201.IdToken{IdToken: info.ParentIdTag, Type: ocpp201.IdTokenTypeCentral}
+	}
+	return tokenInfo
+}
+
+func (s *OCPPServer) handleAuthorize201(chargerID string, req *ocpp201.AuthorizeRequest) (*ocpp201.AuthorizeResponse, error) {
+	conf, err := s.handleAuthorize(chargerID, &ocpp16.AuthorizeRequest{IdTag: req.IdToken.IdToken})
+	if err != nil {
+		return nil, err
+	}
+	return &ocpp201.AuthorizeResponse{IdTokenInfo: *idTokenInfo(conf.IdTagInfo)}, nil
+}
+
+// chargingStatus16 maps the charging state of a transaction onto a 1.6 connector status
+func chargingStatus16(state ocpp201.ChargingState) (ocpp16.ChargePointStatus, bool) {
+	switch state {
+	case ocpp201.ChargingStateCharging:
+		return ocpp16.ChargePointStatusCharging, true
+	case ocpp201.ChargingStateSuspendedEV:
+		return ocpp16.ChargePointStatusSuspendedEV, true
+	case ocpp201.ChargingStateSuspendedEVSE:
+		return ocpp16.ChargePointStatusSuspendedEVSE, true
+	case ocpp201.ChargingStateEVConnected:
+		return ocpp16.ChargePointStatusPreparing, true
+	}
+	return "", false
+}
+
+// handleTransactionEvent records the start, meter values and end of a 2.0.1
+// transaction. The first event seen for a transactionId creates it, whatever its
+// eventType, so that a lost Started event does not lose the session.
+func (s *OCPPServer) handleTransactionEvent(chargerID string, req *ocpp201.TransactionEventRequest) (*ocpp201.TransactionEventResponse, error) {
+	ctx := context.Background()
+	ocppID := req.TransactionInfo.TransactionId
+	log.Printf("TransactionEvent %s #%d from %s for transaction %s (%s)", req.EventType, req.SeqNo, chargerID, ocppID, req.TriggerReason)
+
+	connectorID := 0
+	if req.Evse != nil {
+		connectorID = req.Evse.Id
+	}
+
+	var info ocpp16.IdTagInfo
+	var userID *int64
+	if req.IdToken != nil {
+		var err error
+		info, userID, err = authorizeIdTag(ctx, req.IdToken.IdToken, req.Timestamp.Time)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.GetTransactionByOCPPID(ctx, chargerID, ocppID)
+	switch {
+	case errors.Is(err, db.ErrTransactionNotFound):
+		tx = &models.Transaction{
+			OCPPTransactionID: &ocppID,
+			ChargerID:         chargerID,
+			ConnectorID:       connectorID,
+			UserID:            userID,
+			ReservationID:     req.ReservationId,
+			StartedAt:         req.Timestamp.Time,
+			Status:            models.TransactionStatusActive,
+		}
+		if req.IdToken != nil {
+			tx.IdTag = req.IdToken.IdToken
+			if err := checkConcurrentTx(ctx, tx.IdTag, &info); err != nil {
+				return nil, err
+			}
+		}
+		if wh, ok := energyRegisterWh(req.MeterValue); ok {
+			tx.MeterStart = wh
+		}
+		if err := db.CreateTransaction(ctx, tx); err != nil {
+			return nil, err
+		}
+		log.Printf("Starting transaction %d (%s) on %s EVSE %d (idTag: %s)", tx.ID, ocppID, chargerID, connectorID, tx.IdTag)
+		useReservation(ctx, chargerID, req.ReservationId, tx.ID)
+		s.events.publish(Event{Type: EventTransactionStarted, ChargerID: chargerID, Timestamp: tx.StartedAt, Data: tx})
+		if req.IdToken == nil || info.Status == ocpp16.AuthorizationStatusAccepted {
+			s.startLoadSession(ctx, tx)
+		}
+	case err != nil:
+		return nil, err
+	case tx.IdTag == "" && req.IdToken != nil:
+		// The driver was identified after the cable was plugged in
+		if err := checkConcurrentTx(ctx, req.IdToken.IdToken, &info); err != nil {
+			return nil, err
+		}
+		if err := db.SetTransactionIdTag(ctx, tx.ID, req.IdToken.IdToken, userID); err != nil {
+			return nil, err
+		}
+	}
+	if connectorID == 0 {
+		connectorID = tx.ConnectorID
+	}
+
+	values := meterValueRows201(chargerID, connectorID, &tx.ID, req.MeterValue)
+	s.recordLoadMeterValues(chargerID, connectorID, values)
+	if err := db.InsertMeterValues(ctx, values); err != nil {
+		return nil, err
+	}
+	s.publishMeterValues(chargerID, connectorID, &tx.ID, values)
+
+	if status, ok := chargingStatus16(req.TransactionInfo.ChargingState); ok && connectorID > 0 {
+		if s.loadManager.StatusChanged(chargerID, connectorID, string(status)) {
+			s.rebalance(chargerID)
+		}
+		_, err := db.UpdateConnectorStatus(ctx, &models.Connector{
+			ChargerID:   chargerID,
+			ConnectorID: connectorID,
+			Status:      string(status),
+			ErrorCode:   string(ocpp16.NoError),
+			Timestamp:   req.Timestamp.Time,
+		})
+		if err != nil {
+			log.Printf("DB update error for charger %s connector %d: %v", chargerID, connectorID, err)
+		}
+	}
+
+	if req.EventType == ocpp201.TransactionEventEnded {
+		stopped, err := stopTransaction201(ctx, tx, req)
+		if err != nil {
+			return nil, err
+		}
+		if stopped != nil {
+			s.loadManager.SessionStopped(chargerID, int(stopped.ID))
+			s.events.publish(Event{Type: EventTransactionStopped, ChargerID: chargerID, Timestamp: req.Timestamp.Time, Data: stopped})
+		}
+	}
+
+	resp := &ocpp201.TransactionEventResponse{}
+	if req.IdToken != nil {
+		resp.IdTokenInfo = idTokenInfo(info)
+	}
+	return resp, nil
+}
+
+// stopTransaction201 closes a transaction on its Ended event. The meter reading
+// is taken from the event, or from the last value stored for the transaction.
+// It returns the stopped transaction, or nil if it was stopped before.
+func stopTransaction201(ctx context.Context, tx *models.Transaction, req *ocpp201.TransactionEventRequest) (*models.Transaction, error) {
+	meterStop, ok := energyRegisterWh(req.MeterValue)
+	if !ok {
+		meterStop = tx.MeterStart
+		last, err := db.LatestMeterValue(ctx, tx.ID, energyRegisterMeasurand)
+		if err != nil {
+			return nil, err
+		}
+		if last != nil && last.SIValue != nil {
+			meterStop = int(math.Round(*last.SIValue))
+		}
+	}
+
+	stopIdTag := ""
+	if req.IdToken != nil {
+		stopIdTag = req.IdToken.IdToken
+	}
+
+	stopped, err := db.StopTransaction(ctx, tx.ChargerID, tx.ID, meterStop, req.Timestamp.Time, stopIdTag, req.TransactionInfo.StoppedReason)
+	if errors.Is(err, db.ErrTransactionNotFound) {
+		log.Printf("TransactionEvent Ended from %s for already stopped transaction %d", tx.ChargerID, tx.ID)
+		return nil, nil
+	}
+	return stopped, err
+}
+
+// sampledUnit returns the unit of a sampled value as sent, or the default unit
+// of its measurand
+func sampledUnit(sv ocpp201.SampledValue) string {
+	if sv.UnitOfMeasure != nil && sv.UnitOfMeasure.Unit != "" {
+		return sv.UnitOfMeasure.Unit
+	}
+	measurand := ocpp16.Measurand(sv.Measurand)
+	if measurand == "" {
+		measurand = ocpp16.MeasurandEnergyActiveImportRegister
+	}
+	return measurandUnits[measurand]
+}
+
+// sampledValue returns a sampled value scaled by its multiplier, in its SI unit
+func sampledValue(sv ocpp201.SampledValue) (float64, string) {
+	value := sv.Value
+	if sv.UnitOfMeasure != nil {
+		value *= math.Pow10(sv.UnitOfMeasure.Multiplier)
+	}
+	return normalizeValue(value, sampledUnit(sv))
+}
+
+// energyRegisterWh returns the last energy register reading in meterValues, in Wh
+func energyRegisterWh(meterValues []ocpp201.MeterValue) (int, bool) {
+	wh, found := 0, false
+	for _, mv := range meterValues {
+		for _, sv := range mv.SampledValue {
+			if sv.Measurand != "" && sv.Measurand != energyRegisterMeasurand {
+				continue
+			}
+			if sv.Phase != "" {
+				continue
+			}
+			value, _ := sampledValue(sv)
+			wh, found = int(math.Round(value)), true
+		}
+	}
+	return wh, found
+}
+
+// meterValueRows201 flattens 2.0.1 meter values into one row per sampled value,
+// spelling out the defaults 2.0.1 leaves implicit. As for 1.6, Value and Unit are
+// as sent, before the multiplier; SIValue holds the scaled SI value.
+func meterValueRows201(chargerID string, connectorID int, transactionID *int64, meterValues []ocpp201.MeterValue) []models.MeterValue {
+	var rows []models.MeterValue
+	for _, mv := range meterValues {
+		for _, sv := range mv.SampledValue {
+			value, unit := sampledValue(sv)
+			measurand := sv.Measurand
+			if measurand == "" {
+				measurand = energyRegisterMeasurand
+			}
+			readingContext := string(sv.Context)
+			if readingContext == "" {
+				readingContext = string(ocpp201.ReadingContextSamplePeriodic)
+			}
+			rows = append(rows, models.MeterValue{
+				TransactionID: transactionID,
+				ChargerID:     chargerID,
+				ConnectorID:   connectorID,
+				Timestamp:     mv.Timestamp.Time,
+				Value:         strconv.FormatFloat(sv.Value, 'f', -1, 64),
+				Context:       readingContext,
+				Format:        "Raw",
+				Measurand:     measurand,
+				Phase:         sv.Phase,
+				Location:      valueOr(sv.Location, defaultLocation),
+				Unit:          sampledUnit(sv),
+				SIValue:       &value,
+				SIUnit:        unit,
+			})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,50 @@
+package ocpp201
+
+// Authorization and availability functional blocks
+
+// AuthorizeRequest asks whether an IdToken may start or stop charging
+type AuthorizeRequest struct {
+	IdToken     IdToken `json:"idToken"`
+	Certificate string  `json:"certificate,omitempty"`
+}
+
+type AuthorizeResponse struct {
+	IdTokenInfo       IdTokenInfo `json:"idTokenInfo"`
+	CertificateStatus string      `json:"certificateStatus,omitempty"`
+}
+
+// ConnectorStatus is the status reported in StatusNotification
+type ConnectorStatus string
+
+const (
+	ConnectorStatusAvailable   ConnectorStatus = "Available"
+	ConnectorStatusOccupied    ConnectorStatus = "Occupied"
+	ConnectorStatusReserved    ConnectorStatus = "Reserved"
+	ConnectorStatusUnavailable ConnectorStatus = "Unavailable"
+	ConnectorStatusFaulted     ConnectorStatus = "Faulted"
+)
+
+func (s ConnectorStatus) valid() bool {
+	return oneOf(s, ConnectorStatusAvailable, ConnectorStatusOccupied, ConnectorStatusReserved,
+		ConnectorStatusUnavailable, ConnectorStatusFaulted)
+}
+
+// StatusNotificationRequest reports the status of one connector of an EVSE
+type StatusNotificationRequest struct {
+	Timestamp       DateTime        `json:"timestamp"`
+	ConnectorStatus ConnectorStatus `json:"connectorStatus"`
+	EvseId          int             `json:"evseId"`
+	ConnectorId     int             `json:"connectorId"`
+}
+
+type StatusNotificationResponse struct{}
+
+func (*AuthorizeRequest) Action() string           { return "Authorize" }
+func (*AuthorizeResponse) Action() string          { return "Authorize" }
+func (*StatusNotificationRequest) Action() string  { return "StatusNotification" }
+func (*StatusNotificationResponse) Action() string { return "StatusNotification" }
+
+func init() {
+	register(&AuthorizeRequest{}, &AuthorizeResponse{})
+	register(&StatusNotificationRequest{}, &StatusNotificationResponse{})
+}
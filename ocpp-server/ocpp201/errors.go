@@ -0,0 +1,32 @@
+package ocpp201
+
+import "ocpp-server/ocpp16"
+
+// CALLERROR codes defined by OCPP-J 2.0.1 section 4.3
+const (
+	FormatViolation               ocpp16.ErrorCode = "FormatViolation"
+	GenericError                  ocpp16.ErrorCode = "GenericError"
+	InternalError                 ocpp16.ErrorCode = "InternalError"
+	MessageTypeNotSupported       ocpp16.ErrorCode = "MessageTypeNotSupported"
+	NotImplemented                ocpp16.ErrorCode = "NotImplemented"
+	NotSupported                  ocpp16.ErrorCode = "NotSupported"
+	OccurrenceConstraintViolation ocpp16.ErrorCode = "OccurrenceConstraintViolation"
+	PropertyConstraintViolation   ocpp16.ErrorCode = "PropertyConstraintViolation"
+	ProtocolError                 ocpp16.ErrorCode = "ProtocolError"
+	RpcFrameworkError             ocpp16.ErrorCode = "RpcFrameworkError"
+	SecurityError                 ocpp16.ErrorCode = "SecurityError"
+	TypeConstraintViolation       ocpp16.ErrorCode = "TypeConstraintViolation"
+)
+
+// CallError translates an error built with 1.6 error codes into its 2.0.1
+// equivalent; 2.0.1 renamed two of them
+func CallError(err *ocpp16.Error) *ocpp16.Error {
+	translated := *err
+	switch err.Code {
+	case ocpp16.FormationViolation:
+		translated.Code = FormatViolation
+	case ocpp16.OccurenceConstraintViolation:
+		translated.Code = OccurrenceConstraintViolation
+	}
+	return &translated
+}
@@ -0,0 +1,128 @@
+// Package ocpp201 implements the OCPP 2.0.1 JSON message model for the core use
+// cases the server supports: typed requests and responses, and their encoding
+// into OCPP-J frames.
+//
+// The RPC framework of 2.0.1 is the one of 1.6, so frames are ocpp16.Frame
+// values and errors are *ocpp16.Error values carrying 2.0.1 error codes. The
+// official 2.0.1 JSON schemas are not embedded; payloads are checked against
+// the required fields and enumerations of the Go types instead.
+package ocpp201
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"ocpp-server/ocpp16"
+)
+
+// Subprotocol is the WebSocket subprotocol of OCPP 2.0.1
+const Subprotocol = "ocpp2.0.1"
+
+// Request is the payload of a CALL
+type Request interface {
+	Action() string
+}
+
+// Response is the payload of the CALLRESULT answering a Request
+type Response interface {
+	Action() string
+}
+
+type actionTypes struct {
+	request  reflect.Type
+	response reflect.Type
+}
+
+// actions maps every supported OCPP 2.0.1 action name onto its request and response types
+var actions = make(map[string]actionTypes)
+
+func register(req Request, resp Response) {
+	actions[req.Action()] = actionTypes{
+		request:  reflect.TypeOf(req).Elem(),
+		response: reflect.TypeOf(resp).Elem(),
+	}
+}
+
+// IsKnownAction reports whether action is one of the supported OCPP 2.0.1 actions
+func IsKnownAction(action string) bool {
+	_, ok := actions[action]
+	return ok
+}
+
+// ParseRequest validates a CALL payload and decodes it into the request type of action.
+// Errors are *ocpp16.Error values carrying the 2.0.1 CALLERROR code to answer with.
+func ParseRequest(action string, payload json.RawMessage) (Request, error) {
+	types, ok := actions[action]
+	if !ok {
+		return nil, ocpp16.NewError(NotImplemented, "unknown action %s", action)
+	}
+	req := reflect.New(types.request).Interface().(Request)
+	if err := decode(payload, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ParseResponse validates a CALLRESULT payload and decodes it into the response type of action
+func ParseResponse(action string, payload json.RawMessage) (Response, error) {
+	types, ok := actions[action]
+	if !ok {
+		return nil, ocpp16.NewError(NotImplemented, "unknown action %s", action)
+	}
+	resp := reflect.New(types.response).Interface().(Response)
+	if err := decode(payload, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func decode(payload json.RawMessage, v interface{}) error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &object); err != nil || object == nil {
+		return ocpp16.NewError(FormatViolation, "payload must be a JSON object")
+	}
+
+	err := json.Unmarshal(payload, v)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return ocpp16.NewError(TypeConstraintViolation, "%s: %v", typeErr.Field, err)
+	case err != nil:
+		return ocpp16.NewError(FormatViolation, "%v", err)
+	}
+	return validate(reflect.ValueOf(v).Elem(), "")
+}
+
+// NewCall builds a CALL frame, checking that req is the 2.0.1 request of its action
+func NewCall(messageID string, req Request) (*ocpp16.Frame, error) {
+	types, ok := actions[req.Action()]
+	if !ok || reflect.TypeOf(req) != reflect.PointerTo(types.request) {
+		return nil, fmt.Errorf("%s is not a supported OCPP 2.0.1 request", req.Action())
+	}
+	if err := validate(reflect.ValueOf(req).Elem(), ""); err != nil {
+		return nil, fmt.Errorf("invalid %s request: %w", req.Action(), err)
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return &ocpp16.Frame{Type: ocpp16.CallType, MessageID: messageID, Action: req.Action(), Payload: payload}, nil
+}
+
+// NewCallResult builds a CALLRESULT frame, checking that resp is the 2.0.1 response of its action
+func NewCallResult(messageID string, resp Response) (*ocpp16.Frame, error) {
+	types, ok := actions[resp.Action()]
+	if !ok || reflect.TypeOf(resp) != reflect.PointerTo(types.response) {
+		return nil, fmt.Errorf("%s is not a supported OCPP 2.0.1 response", resp.Action())
+	}
+	if err := validate(reflect.ValueOf(resp).Elem(), ""); err != nil {
+		return nil, fmt.Errorf("invalid %s response: %w", resp.Action(), err)
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ocpp16.Frame{Type: ocpp16.CallResultType, MessageID: messageID, Payload: payload}, nil
+}
@@ -0,0 +1,173 @@
+package ocpp201
+
+// Provisioning functional block: booting and device model variables
+
+// BootReason is why a charging station sent its BootNotification
+type BootReason string
+
+const (
+	BootReasonApplicationReset BootReason = "ApplicationReset"
+	BootReasonFirmwareUpdate   BootReason = "FirmwareUpdate"
+	BootReasonLocalReset       BootReason = "LocalReset"
+	BootReasonPowerUp          BootReason = "PowerUp"
+	BootReasonRemoteReset      BootReason = "RemoteReset"
+	BootReasonScheduledReset   BootReason = "ScheduledReset"
+	BootReasonTriggered        BootReason = "Triggered"
+	BootReasonUnknown          BootReason = "Unknown"
+	BootReasonWatchdog         BootReason = "Watchdog"
+)
+
+func (r BootReason) valid() bool {
+	return oneOf(r, BootReasonApplicationReset, BootReasonFirmwareUpdate, BootReasonLocalReset,
+		BootReasonPowerUp, BootReasonRemoteReset, BootReasonScheduledReset, BootReasonTriggered,
+		BootReasonUnknown, BootReasonWatchdog)
+}
+
+// RegistrationStatus is the answer to BootNotification
+type RegistrationStatus string
+
+const (
+	RegistrationStatusAccepted RegistrationStatus = "Accepted"
+	RegistrationStatusPending  RegistrationStatus = "Pending"
+	RegistrationStatusRejected RegistrationStatus = "Rejected"
+)
+
+func (s RegistrationStatus) valid() bool {
+	return oneOf(s, RegistrationStatusAccepted, RegistrationStatusPending, RegistrationStatusRejected)
+}
+
+// Modem identifies the wireless modem of a charging station
+type Modem struct {
+	Iccid string `json:"iccid,omitempty"`
+	Imsi  string `json:"imsi,omitempty"`
+}
+
+// ChargingStation identifies a charging station in its BootNotification
+type ChargingStation struct {
+	SerialNumber    string `json:"serialNumber,omitempty"`
+	Model           string `json:"model"`
+	Modem           *Modem `json:"modem,omitempty"`
+	VendorName      string `json:"vendorName"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+}
+
+// BootNotificationRequest is sent by a charging station after start-up
+type BootNotificationRequest struct {
+	ChargingStation ChargingStation `json:"chargingStation"`
+	Reason          BootReason      `json:"reason"`
+}
+
+type BootNotificationResponse struct {
+	CurrentTime DateTime           `json:"currentTime"`
+	Interval    int                `json:"interval"`
+	Status      RegistrationStatus `json:"status"`
+	StatusInfo  *StatusInfo        `json:"statusInfo,omitempty"`
+}
+
+// HeartbeatRequest is sent periodically by a charging station
+type HeartbeatRequest struct{}
+
+type HeartbeatResponse struct {
+	CurrentTime DateTime `json:"currentTime"`
+}
+
+// GetVariableStatus is the result of reading one variable
+type GetVariableStatus string
+
+const (
+	GetVariableStatusAccepted                  GetVariableStatus = "Accepted"
+	GetVariableStatusRejected                  GetVariableStatus = "Rejected"
+	GetVariableStatusUnknownComponent          GetVariableStatus = "UnknownComponent"
+	GetVariableStatusUnknownVariable           GetVariableStatus = "UnknownVariable"
+	GetVariableStatusNotSupportedAttributeType GetVariableStatus = "NotSupportedAttributeType"
+)
+
+func (s GetVariableStatus) valid() bool {
+	return oneOf(s, GetVariableStatusAccepted, GetVariableStatusRejected, GetVariableStatusUnknownComponent,
+		GetVariableStatusUnknownVariable, GetVariableStatusNotSupportedAttributeType)
+}
+
+// GetVariableData names one variable to read
+type GetVariableData struct {
+	AttributeType AttributeType `json:"attributeType,omitempty"`
+	Component     Component     `json:"component"`
+	Variable      Variable      `json:"variable"`
+}
+
+// GetVariablesRequest asks a charging station for device model variables
+type GetVariablesRequest struct {
+	GetVariableData []GetVariableData `json:"getVariableData"`
+}
+
+// GetVariableResult is the value of one variable, or why it could not be read
+type GetVariableResult struct {
+	AttributeStatus     GetVariableStatus `json:"attributeStatus"`
+	AttributeStatusInfo *StatusInfo       `json:"attributeStatusInfo,omitempty"`
+	AttributeType       AttributeType     `json:"attributeType,omitempty"`
+	AttributeValue      string            `json:"attributeValue,omitempty"`
+	Component           Component         `json:"component"`
+	Variable            Variable          `json:"variable"`
+}
+
+type GetVariablesResponse struct {
+	GetVariableResult []GetVariableResult `json:"getVariableResult"`
+}
+
+// SetVariableStatus is the result of writing one variable
+type SetVariableStatus string
+
+const (
+	SetVariableStatusAccepted                  SetVariableStatus = "Accepted"
+	SetVariableStatusRejected                  SetVariableStatus = "Rejected"
+	SetVariableStatusUnknownComponent          SetVariableStatus = "UnknownComponent"
+	SetVariableStatusUnknownVariable           SetVariableStatus = "UnknownVariable"
+	SetVariableStatusNotSupportedAttributeType SetVariableStatus = "NotSupportedAttributeType"
+	SetVariableStatusRebootRequired            SetVariableStatus = "RebootRequired"
+)
+
+func (s SetVariableStatus) valid() bool {
+	return oneOf(s, SetVariableStatusAccepted, SetVariableStatusRejected, SetVariableStatusUnknownComponent,
+		SetVariableStatusUnknownVariable, SetVariableStatusNotSupportedAttributeType, SetVariableStatusRebootRequired)
+}
+
+// SetVariableData is one variable to write
+type SetVariableData struct {
+	AttributeType  AttributeType `json:"attributeType,omitempty"`
+	AttributeValue string        `json:"attributeValue"`
+	Component      Component     `json:"component"`
+	Variable       Variable      `json:"variable"`
+}
+
+// SetVariablesRequest asks a charging station to change device model variables
+type SetVariablesRequest struct {
+	SetVariableData []SetVariableData `json:"setVariableData"`
+}
+
+// SetVariableResult is the outcome of writing one variable
+type SetVariableResult struct {
+	AttributeType       AttributeType     `json:"attributeType,omitempty"`
+	AttributeStatus     SetVariableStatus `json:"attributeStatus"`
+	AttributeStatusInfo *StatusInfo       `json:"attributeStatusInfo,omitempty"`
+	Component           Component         `json:"component"`
+	Variable            Variable          `json:"variable"`
+}
+
+type SetVariablesResponse struct {
+	SetVariableResult []SetVariableResult `json:"setVariableResult"`
+}
+
+func (*BootNotificationRequest) Action() string  { return "BootNotification" }
+func (*BootNotificationResponse) Action() string { return "BootNotification" }
+func (*HeartbeatRequest) Action() string         { return "Heartbeat" }
+func (*HeartbeatResponse) Action() string        { return "Heartbeat" }
+func (*GetVariablesRequest) Action() string      { return "GetVariables" }
+func (*GetVariablesResponse) Action() string     { return "GetVariables" }
+func (*SetVariablesRequest) Action() string      { return "SetVariables" }
+func (*SetVariablesResponse) Action() string     { return "SetVariables" }
+
+func init() {
+	register(&BootNotificationRequest{}, &BootNotificationResponse{})
+	register(&HeartbeatRequest{}, &HeartbeatResponse{})
+	register(&GetVariablesRequest{}, &GetVariablesResponse{})
+	register(&SetVariablesRequest{}, &SetVariablesResponse{})
+}
@@ -0,0 +1,118 @@
+package ocpp201
+
+import "encoding/json"
+
+// Transactions functional block
+
+// TransactionEventType is the phase of a transaction a TransactionEvent reports
+type TransactionEventType string
+
+const (
+	TransactionEventStarted TransactionEventType = "Started"
+	TransactionEventUpdated TransactionEventType = "Updated"
+	TransactionEventEnded   TransactionEventType = "Ended"
+)
+
+func (t TransactionEventType) valid() bool {
+	return oneOf(t, TransactionEventStarted, TransactionEventUpdated, TransactionEventEnded)
+}
+
+// ChargingState is the state of the energy transfer during a transaction
+type ChargingState string
+
+const (
+	ChargingStateCharging      ChargingState = "Charging"
+	ChargingStateEVConnected   ChargingState = "EVConnected"
+	ChargingStateSuspendedEV   ChargingState = "SuspendedEV"
+	ChargingStateSuspendedEVSE ChargingState = "SuspendedEVSE"
+	ChargingStateIdle          ChargingState = "Idle"
+)
+
+func (s ChargingState) valid() bool {
+	return oneOf(s, ChargingStateCharging, ChargingStateEVConnected, ChargingStateSuspendedEV,
+		ChargingStateSuspendedEVSE, ChargingStateIdle)
+}
+
+// Transaction describes the transaction a TransactionEvent belongs to. Its
+// TransactionId is chosen by the charging station.
+type Transaction struct {
+	TransactionId     string        `json:"transactionId"`
+	ChargingState     ChargingState `json:"chargingState,omitempty"`
+	TimeSpentCharging *int          `json:"timeSpentCharging,omitempty"`
+	StoppedReason     string        `json:"stoppedReason,omitempty"`
+	RemoteStartId     *int          `json:"remoteStartId,omitempty"`
+}
+
+// TransactionEventRequest reports the start, progress and end of a transaction;
+// it replaces 1.6 StartTransaction, StopTransaction and transaction MeterValues
+type TransactionEventRequest struct {
+	EventType          TransactionEventType `json:"eventType"`
+	Timestamp          DateTime             `json:"timestamp"`
+	TriggerReason      string               `json:"triggerReason"`
+	SeqNo              int                  `json:"seqNo"`
+	Offline            bool                 `json:"offline,omitempty"`
+	NumberOfPhasesUsed *int                 `json:"numberOfPhasesUsed,omitempty"`
+	CableMaxCurrent    *int                 `json:"cableMaxCurrent,omitempty"`
+	ReservationId      *int                 `json:"reservationId,omitempty"`
+	TransactionInfo    Transaction          `json:"transactionInfo"`
+	Evse               *EVSE                `json:"evse,omitempty"`
+	IdToken            *IdToken             `json:"idToken,omitempty"`
+	MeterValue         []MeterValue         `json:"meterValue,omitempty"`
+}
+
+type TransactionEventResponse struct {
+	TotalCost              *float64        `json:"totalCost,omitempty"`
+	ChargingPriority       *int            `json:"chargingPriority,omitempty"`
+	IdTokenInfo            *IdTokenInfo    `json:"idTokenInfo,omitempty"`
+	UpdatedPersonalMessage *MessageContent `json:"updatedPersonalMessage,omitempty"`
+}
+
+// RequestStartStopStatus is the answer to RequestStartTransaction and RequestStopTransaction
+type RequestStartStopStatus string
+
+const (
+	RequestStartStopStatusAccepted RequestStartStopStatus = "Accepted"
+	RequestStartStopStatusRejected RequestStartStopStatus = "Rejected"
+)
+
+func (s RequestStartStopStatus) valid() bool {
+	return oneOf(s, RequestStartStopStatusAccepted, RequestStartStopStatusRejected)
+}
+
+// RequestStartTransactionRequest asks a charging station to start a transaction
+type RequestStartTransactionRequest struct {
+	EvseId          *int            `json:"evseId,omitempty"`
+	RemoteStartId   int             `json:"remoteStartId"`
+	IdToken         IdToken         `json:"idToken"`
+	ChargingProfile json.RawMessage `json:"chargingProfile,omitempty"`
+	GroupIdToken    *IdToken        `json:"groupIdToken,omitempty"`
+}
+
+type RequestStartTransactionResponse struct {
+	Status        RequestStartStopStatus `json:"status"`
+	StatusInfo    *StatusInfo            `json:"statusInfo,omitempty"`
+	TransactionId string                 `json:"transactionId,omitempty"`
+}
+
+// RequestStopTransactionRequest asks a charging station to stop a transaction
+type RequestStopTransactionRequest struct {
+	TransactionId string `json:"transactionId"`
+}
+
+type RequestStopTransactionResponse struct {
+	Status     RequestStartStopStatus `json:"status"`
+	StatusInfo *StatusInfo            `json:"statusInfo,omitempty"`
+}
+
+func (*TransactionEventRequest) Action() string         { return "TransactionEvent" }
+func (*TransactionEventResponse) Action() string        { return "TransactionEvent" }
+func (*RequestStartTransactionRequest) Action() string  { return "RequestStartTransaction" }
+func (*RequestStartTransactionResponse) Action() string { return "RequestStartTransaction" }
+func (*RequestStopTransactionRequest) Action() string   { return "RequestStopTransaction" }
+func (*RequestStopTransactionResponse) Action() string  { return "RequestStopTransaction" }
+
+func init() {
+	register(&TransactionEventRequest{}, &TransactionEventResponse{})
+	register(&RequestStartTransactionRequest{}, &RequestStartTransactionResponse{})
+	register(&RequestStopTransactionRequest{}, &RequestStopTransactionResponse{})
+}
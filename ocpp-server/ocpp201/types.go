@@ -0,0 +1,164 @@
+package ocpp201
+
+import "ocpp-server/ocpp16"
+
+// DateTime is an OCPP dateTime; 2.0.1 uses the same RFC 3339 format as 1.6
+type DateTime = ocpp16.DateTime
+
+// NewDateTime wraps t as a DateTime
+var NewDateTime = ocpp16.NewDateTime
+
+// StatusInfo gives details about a status in a response
+type StatusInfo struct {
+	ReasonCode     string `json:"reasonCode"`
+	AdditionalInfo string `json:"additionalInfo,omitempty"`
+}
+
+// EVSE identifies an EVSE and optionally one of its connectors
+type EVSE struct {
+	Id          int  `json:"id"`
+	ConnectorId *int `json:"connectorId,omitempty"`
+}
+
+// IdTokenType is the kind of identifier in an IdToken
+type IdTokenType string
+
+const (
+	IdTokenTypeCentral         IdTokenType = "Central"
+	IdTokenTypeEMAID           IdTokenType = "eMAID"
+	IdTokenTypeISO14443        IdTokenType = "ISO14443"
+	IdTokenTypeISO15693        IdTokenType = "ISO15693"
+	IdTokenTypeKeyCode         IdTokenType = "KeyCode"
+	IdTokenTypeLocal           IdTokenType = "Local"
+	IdTokenTypeMacAddress      IdTokenType = "MacAddress"
+	IdTokenTypeNoAuthorization IdTokenType = "NoAuthorization"
+)
+
+func (t IdTokenType) valid() bool {
+	return oneOf(t, IdTokenTypeCentral, IdTokenTypeEMAID, IdTokenTypeISO14443, IdTokenTypeISO15693,
+		IdTokenTypeKeyCode, IdTokenTypeLocal, IdTokenTypeMacAddress, IdTokenTypeNoAuthorization)
+}
+
+// AdditionalInfo carries an extra identifier of an IdToken
+type AdditionalInfo struct {
+	AdditionalIdToken string `json:"additionalIdToken"`
+	Type              string `json:"type"`
+}
+
+// IdToken identifies the user of a transaction; it replaces the 1.6 idTag
+type IdToken struct {
+	IdToken        string           `json:"idToken"`
+	Type           IdTokenType      `json:"type"`
+	AdditionalInfo []AdditionalInfo `json:"additionalInfo,omitempty"`
+}
+
+// AuthorizationStatus is the status field of IdTokenInfo
+type AuthorizationStatus string
+
+const (
+	AuthorizationStatusAccepted           AuthorizationStatus = "Accepted"
+	AuthorizationStatusBlocked            AuthorizationStatus = "Blocked"
+	AuthorizationStatusConcurrentTx       AuthorizationStatus = "ConcurrentTx"
+	AuthorizationStatusExpired            AuthorizationStatus = "Expired"
+	AuthorizationStatusInvalid            AuthorizationStatus = "Invalid"
+	AuthorizationStatusNoCredit           AuthorizationStatus = "NoCredit"
+	AuthorizationStatusNotAllowedTypeEVSE AuthorizationStatus = "NotAllowedTypeEVSE"
+	AuthorizationStatusNotAtThisLocation  AuthorizationStatus = "NotAtThisLocation"
+	AuthorizationStatusNotAtThisTime      AuthorizationStatus = "NotAtThisTime"
+	AuthorizationStatusUnknown            AuthorizationStatus = "Unknown"
+)
+
+func (s AuthorizationStatus) valid() bool {
+	return oneOf(s, AuthorizationStatusAccepted, AuthorizationStatusBlocked, AuthorizationStatusConcurrentTx,
+		AuthorizationStatusExpired, AuthorizationStatusInvalid, AuthorizationStatusNoCredit,
+		AuthorizationStatusNotAllowedTypeEVSE, AuthorizationStatusNotAtThisLocation,
+		AuthorizationStatusNotAtThisTime, AuthorizationStatusUnknown)
+}
+
+// MessageContent is a message to show to the user
+type MessageContent struct {
+	Format   string `json:"format"`
+	Language string `json:"language,omitempty"`
+	Content  string `json:"content"`
+}
+
+// IdTokenInfo is the authorization status of an IdToken; it replaces the 1.6 IdTagInfo
+type IdTokenInfo struct {
+	Status              AuthorizationStatus `json:"status"`
+	CacheExpiryDateTime *DateTime           `json:"cacheExpiryDateTime,omitempty"`
+	ChargingPriority    *int                `json:"chargingPriority,omitempty"`
+	Language1           string              `json:"language1,omitempty"`
+	Language2           string              `json:"language2,omitempty"`
+	GroupIdToken        *IdToken            `json:"groupIdToken,omitempty"`
+	EvseId              []int               `json:"evseId,omitempty"`
+	PersonalMessage     *MessageContent     `json:"personalMessage,omitempty"`
+}
+
+// ReadingContext says why a value was sampled
+type ReadingContext string
+
+const (
+	ReadingContextInterruptionBegin ReadingContext = "Interruption.Begin"
+	ReadingContextInterruptionEnd   ReadingContext = "Interruption.End"
+	ReadingContextOther             ReadingContext = "Other"
+	ReadingContextSampleClock       ReadingContext = "Sample.Clock"
+	ReadingContextSamplePeriodic    ReadingContext = "Sample.Periodic"
+	ReadingContextTransactionBegin  ReadingContext = "Transaction.Begin"
+	ReadingContextTransactionEnd    ReadingContext = "Transaction.End"
+	ReadingContextTrigger           ReadingContext = "Trigger"
+)
+
+func (c ReadingContext) valid() bool {
+	return oneOf(c, ReadingContextInterruptionBegin, ReadingContextInterruptionEnd, ReadingContextOther,
+		ReadingContextSampleClock, ReadingContextSamplePeriodic, ReadingContextTransactionBegin,
+		ReadingContextTransactionEnd, ReadingContextTrigger)
+}
+
+// UnitOfMeasure is the unit of a sampled value, scaled by 10^Multiplier
+type UnitOfMeasure struct {
+	Unit       string `json:"unit,omitempty"`
+	Multiplier int    `json:"multiplier,omitempty"`
+}
+
+// SampledValue is a single measurement; unlike 1.6 its value is a number
+type SampledValue struct {
+	Value         float64        `json:"value"`
+	Context       ReadingContext `json:"context,omitempty"`
+	Measurand     string         `json:"measurand,omitempty"`
+	Phase         string         `json:"phase,omitempty"`
+	Location      string         `json:"location,omitempty"`
+	UnitOfMeasure *UnitOfMeasure `json:"unitOfMeasure,omitempty"`
+}
+
+// MeterValue is a set of sampled values taken at the same time
+type MeterValue struct {
+	Timestamp    DateTime       `json:"timestamp"`
+	SampledValue []SampledValue `json:"sampledValue"`
+}
+
+// AttributeType selects which attribute of a variable is read or written
+type AttributeType string
+
+const (
+	AttributeTypeActual AttributeType = "Actual"
+	AttributeTypeTarget AttributeType = "Target"
+	AttributeTypeMinSet AttributeType = "MinSet"
+	AttributeTypeMaxSet AttributeType = "MaxSet"
+)
+
+func (a AttributeType) valid() bool {
+	return oneOf(a, AttributeTypeActual, AttributeTypeTarget, AttributeTypeMinSet, AttributeTypeMaxSet)
+}
+
+// Component is a part of the device model, optionally tied to an EVSE
+type Component struct {
+	Name     string `json:"name"`
+	Instance string `json:"instance,omitempty"`
+	Evse     *EVSE  `json:"evse,omitempty"`
+}
+
+// Variable is a property of a component
+type Variable struct {
+	Name     string `json:"name"`
+	Instance string `json:"instance,omitempty"`
+}
@@ -0,0 +1,87 @@
+package ocpp201
+
+import (
+	"reflect"
+	"strings"
+
+	"ocpp-server/ocpp16"
+)
+
+// enum is implemented by the enumeration types of this package
+type enum interface {
+	valid() bool
+}
+
+// oneOf reports whether value is one of values
+func oneOf[T ~string](value T, values ...T) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the required fields and enumerations of v. A field is required
+// when its json tag has no omitempty; required arrays must not be empty, as in the
+// 2.0.1 schemas.
+func validate(v reflect.Value, path string) error {
+	if e, ok := v.Interface().(enum); ok && !(v.Kind() == reflect.String && v.Len() == 0) && !e.valid() {
+		return ocpp16.NewError(PropertyConstraintViolation, "%s: invalid value %q", path, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return validate(v.Elem(), path)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := validate(v.Index(i), path); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "" || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			value := v.Field(i)
+			if !strings.Contains(opts, "omitempty") && missing(value) {
+				return ocpp16.NewError(OccurrenceConstraintViolation, "%s is required", fieldPath)
+			}
+			if err := validate(value, fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missing reports whether a required field was left out of a payload
+func missing(v reflect.Value) bool {
+	if t, ok := v.Interface().(DateTime); ok {
+		return t.IsZero()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Map:
+		return v.IsNil()
+	case reflect.Slice:
+		return v.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// remoteCommandTimeout bounds how long SendRemoteCommand waits for a charger to answer
+const remoteCommandTimeout = 30 * time.Second
+
+// errChargerNotConnected is returned when a command targets a charger without an open connection
+var errChargerNotConnected = errors.New("charger not connected")
+
+// errInvalidCommand is returned when a command does not conform to its OCPP schema
+var errInvalidCommand = errors.New("invalid command")
+
+// errChargerDisconnected is returned to callers still waiting when the charger's socket closes
+var errChargerDisconnected = errors.New("charger disconnected before answering")
+
+// callResponse carries the outcome of a server-initiated CALL back to the waiting sender
+type callResponse struct {
+	payload json.RawMessage
+	err     error
+}
+
+// pendingCall is a server-initiated CALL waiting for its CALLRESULT or CALLERROR.
+// It belongs to the connection it was sent on, not just to the charger identity,
+// so that a reconnecting charger cannot answer or abort CALLs of its old socket.
+type pendingCall struct {
+	charger  *Charger
+	action   string
+	response chan callResponse
+}
+
+// registerPendingCall records a CALL so that the matching answer can be routed back to the sender
+func (s *OCPPServer) registerPendingCall(charger *Charger, messageID, action string) *pendingCall {
+	call := &pendingCall{
+		charger:  charger,
+		action:   action,
+		response: make(chan callResponse, 1),
+	}
+
+	s.pendingMu.Lock()
+	s.pendingCalls[messageID] = call
+	s.pendingMu.Unlock()
+	return call
+}
+
+// removePendingCall forgets a CALL, e.g. once its sender gave up waiting
+func (s *OCPPServer) removePendingCall(messageID string) {
+	s.pendingMu.Lock()
+	delete(s.pendingCalls, messageID)
+	s.pendingMu.Unlock()
+}
+
+// resolvePendingCall delivers an answer from a charger to the sender of the matching CALL
+func (s *OCPPServer) resolvePendingCall(charger *Charger, messageID string, resp callResponse) {
+	s.pendingMu.Lock()
+	call, exists := s.pendingCalls[messageID]
+	if exists && call.charger == charger {
+		delete(s.pendingCalls, messageID)
+	}
+	s.pendingMu.Unlock()
+
+	if !exists || call.charger != charger {
+		log.Printf("Received answer from %s for unknown message %s", charger.ID, messageID)
+		return
+	}
+	call.response <- resp
+}
+
+// failPendingCalls aborts every CALL still waiting on a connection, e.g. after it closed
+func (s *OCPPServer) failPendingCalls(charger *Charger, err error) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	for messageID, call := range s.pendingCalls {
+		if call.charger != charger {
+			continue
+		}
+		delete(s.pendingCalls, messageID)
+		call.response <- callResponse{err: err}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// BootNotification intervals, in seconds, per registration status. For Pending and
+// Rejected the interval tells the charger when to retry its BootNotification.
+const (
+	heartbeatInterval    = 300
+	pendingBootInterval  = 60
+	rejectedBootInterval = 300
+)
+
+// registrationStatus applies the registration policy to a charger identity: an
+// operator decision wins, otherwise identities known in charging_point are
+// accepted and everything else waits for approval
+func registrationStatus(ctx context.Context, chargerID string) (ocpp16.RegistrationStatus, error) {
+	reg, err := db.GetRegistration(ctx, chargerID)
+	if err == nil && reg.Status != string(ocpp16.RegistrationStatusPending) {
+		return ocpp16.RegistrationStatus(reg.Status), nil
+	}
+	if err != nil && !errors.Is(err, db.ErrRegistrationNotFound) {
+		return "", err
+	}
+
+	_, err = db.FindChargingPoint(ctx, chargerID)
+	if errors.Is(err, db.ErrChargingPointNotFound) {
+		return ocpp16.RegistrationStatusPending, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return ocpp16.RegistrationStatusAccepted, nil
+}
+
+// bootInterval returns the interval sent in the BootNotification answer for status
+func bootInterval(status ocpp16.RegistrationStatus) int {
+	switch status {
+	case ocpp16.RegistrationStatusPending:
+		return pendingBootInterval
+	case ocpp16.RegistrationStatusRejected:
+		return rejectedBootInterval
+	default:
+		return heartbeatInterval
+	}
+}
+
+// handleRegistrations lists charger registrations, e.g. ?status=Pending for the approval queue
+func (s *OCPPServer) handleRegistrations(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	regs, err := db.ListRegistrations(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"registrations": regs}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// registrationDecisionHandler serves POST /api/registrations/{id}/accept and /reject
+func (s *OCPPServer) registrationDecisionHandler(status ocpp16.RegistrationStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enableCORS(w)
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireOperator(w, r) {
+			return
+		}
+
+		chargerID := r.PathValue("id")
+		reg, err := db.DecideRegistration(r.Context(), chargerID, string(status))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Registration of %s set to %s", chargerID, status)
+
+		// Ask a waiting charger to boot again so that it picks up the decision now
+		// instead of after its retry interval
+		if status == ocpp16.RegistrationStatusAccepted {
+			go s.triggerBootNotification(chargerID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(reg); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// triggerBootNotification sends TriggerMessage(BootNotification) to a connected charger
+func (s *OCPPServer) triggerBootNotification(chargerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteCommandTimeout)
+	defer cancel()
+
+	_, err := s.SendRemoteCommand(ctx, chargerID, &ocpp16.TriggerMessageRequest{
+		RequestedMessage: ocpp16.TriggerBootNotification,
+	})
+	if err != nil && !errors.Is(err, errChargerNotConnected) {
+		log.Printf("Failed to trigger BootNotification on %s: %v", chargerID, err)
+	}
+}
+
+// recordPendingBoot queues an unknown charger for operator approval
+func recordPendingBoot(ctx context.Context, chargerID string, req *ocpp16.BootNotificationRequest) {
+	now := time.Now()
+	err := db.RecordPendingRegistration(ctx, &models.ChargerRegistration{
+		ChargerID:   chargerID,
+		Status:      string(ocpp16.RegistrationStatusPending),
+		Vendor:      req.ChargePointVendor,
+		Model:       req.ChargePointModel,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	})
+	if err != nil {
+		log.Printf("DB update error for registration of %s: %v", chargerID, err)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+)
+
+// Chargers queue StartTransaction, StopTransaction and MeterValues, or in OCPP
+// 2.0.1 TransactionEvent, while they are offline and send them once reconnected,
+// with their original timestamps. A message whose answer was lost is sent again,
+// so the same message may arrive several times.
+
+const (
+	// processedMessageRetention is how long the answers to transaction messages are
+	// kept for chargers replaying them
+	processedMessageRetention = 30 * 24 * time.Hour
+
+	// processedMessagePruneInterval is how often expired answers are deleted
+	processedMessagePruneInterval = time.Hour
+)
+
+// messageDigest identifies a message of a charger by its content. Payloads are
+// re-encoded from the parsed request, so the digest does not depend on how the
+// charger laid out its JSON, nor on the protocol it spoke.
+func messageDigest(request ocpp16.Request) (string, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	sum.Write([]byte(request.Action()))
+	sum.Write([]byte{0})
+	sum.Write(payload)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// handleOnce answers a transaction message with handle, unless the charger sent
+// the very same message before, in which case it gets the answer it was given
+// then, decoded with parse. Every one of these messages carries a timestamp, so
+// two identical ones are the same message sent twice. OCPP 2.0.1 messages go
+// through it too, their request and response types having the same methods.
+func (s *OCPPServer) handleOnce(chargerID string, request ocpp16.Request, parse func(action string, payload json.RawMessage) (ocpp16.Confirmation, error), handle func() (ocpp16.Confirmation, error)) (ocpp16.Confirmation, error) {
+	ctx := context.Background()
+	digest, err := messageDigest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := db.GetProcessedMessage(ctx, chargerID, digest)
+	switch {
+	case err == nil:
+		log.Printf("%s from %s was processed on %s, answering as then", request.Action(), chargerID, msg.CreatedAt.Format(time.RFC3339))
+		return parse(request.Action(), msg.Response)
+	case !errors.Is(err, db.ErrMessageNotProcessed):
+		return nil, err
+	}
+
+	conf, err := handle()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	err = db.SaveProcessedMessage(ctx, &models.ProcessedMessage{
+		ChargerID: chargerID,
+		Digest:    digest,
+		Action:    request.Action(),
+		Response:  response,
+	})
+	if err != nil {
+		// The message was handled; only a later replay of it would be affected
+		log.Printf("DB update error for charger %s: %v", chargerID, err)
+	}
+	return conf, nil
+}
+
+// parseResponse201 decodes a stored OCPP 2.0.1 answer for handleOnce
+func parseResponse201(action string, payload json.RawMessage) (ocpp16.Confirmation, error) {
+	return ocpp201.ParseResponse(action, payload)
+}
+
+// pruneProcessedMessages periodically forgets the answers kept for replays once
+// no charger can still be holding their message
+func pruneProcessedMessages(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := db.DeleteProcessedMessages(ctx, now.Add(-processedMessageRetention))
+			if err != nil {
+				log.Printf("Failed to prune processed messages: %v", err)
+			} else if n > 0 {
+				log.Printf("Pruned %d processed message(s)", n)
+			}
+		}
+	}
+}
+
+// reconcileStopTransaction resolves a StopTransaction whose transactionId matches
+// no running transaction of the charger. It returns the transaction the stop
+// belongs to and whether the stop closed it:
+//   - a transaction stopped before keeps its first stop; a differing one is noted
+//   - an unknown transactionId, e.g. one the charger made up while offline, stops
+//     the running transaction of the same idTag
+//   - otherwise the session is recorded from the StopTransaction alone
+func reconcileStopTransaction(ctx context.Context, chargerID string, req *ocpp16.StopTransactionRequest) (*models.Transaction, bool, error) {
+	ocppID := strconv.Itoa(req.TransactionId)
+	tx, err := db.GetTransaction(ctx, chargerID, int64(req.TransactionId))
+	if errors.Is(err, db.ErrTransactionNotFound) {
+		// Recorded by an earlier reconciliation
+		tx, err = db.GetTransactionByOCPPID(ctx, chargerID, ocppID)
+	}
+	switch {
+	case err == nil:
+		if tx.Status == models.TransactionStatusActive {
+			// Only an OCPP 2.0.1 transaction can still be running here
+			return nil, false, ocpp16.NewError(ocpp16.PropertyConstraintViolation, "transaction %d is not an OCPP 1.6 transaction", req.TransactionId)
+		}
+		if tx.MeterStop != nil && *tx.MeterStop == req.MeterStop && tx.StoppedAt != nil && tx.StoppedAt.Equal(req.Timestamp.Time) {
+			log.Printf("StopTransaction from %s repeats the stop of transaction %d", chargerID, tx.ID)
+			return tx, false, nil
+		}
+		note := fmt.Sprintf("stopped again at %s with meterStop %d", req.Timestamp.UTC().Format(time.RFC3339), req.MeterStop)
+		log.Printf("StopTransaction from %s conflicts with the stop of transaction %d: %s", chargerID, tx.ID, note)
+		if err := db.AddTransactionReconciliation(ctx, tx.ID, note); err != nil {
+			return nil, false, err
+		}
+		return tx, false, nil
+	case !errors.Is(err, db.ErrTransactionNotFound):
+		return nil, false, err
+	}
+
+	note := fmt.Sprintf("stopped by StopTransaction for unknown transactionId %d", req.TransactionId)
+	if match, err := matchUnknownStop(ctx, chargerID, req); err != nil {
+		return nil, false, err
+	} else if match != nil {
+		tx, err := db.StopTransaction(ctx, chargerID, match.ID, req.MeterStop, req.Timestamp.Time, req.IdTag, string(req.Reason))
+		if err != nil {
+			return nil, false, err
+		}
+		log.Printf("StopTransaction from %s for unknown transaction %d stops transaction %d", chargerID, req.TransactionId, tx.ID)
+		if err := db.AddTransactionReconciliation(ctx, tx.ID, note); err != nil {
+			return nil, false, err
+		}
+		return tx, true, nil
+	}
+
+	// Nothing was recorded for this session: it runs from the first reading of
+	// its transaction data, or is only known to have ended
+	stoppedAt, meterStop := req.Timestamp.Time, req.MeterStop
+	tx = &models.Transaction{
+		OCPPTransactionID: &ocppID,
+		ChargerID:         chargerID,
+		IdTag:             req.IdTag,
+		MeterStart:        req.MeterStop,
+		MeterStop:         &meterStop,
+		StartedAt:         stoppedAt,
+		StoppedAt:         &stoppedAt,
+		StopIdTag:         req.IdTag,
+		StopReason:        string(req.Reason),
+		Status:            models.TransactionStatusCompleted,
+		Reconciliation:    "recorded from StopTransaction for unknown transactionId " + ocppID,
+	}
+	if startedAt, meterStart, ok := transactionBegin(req.TransactionData); ok {
+		tx.StartedAt, tx.MeterStart = startedAt, meterStart
+	}
+	if req.IdTag != "" {
+		_, userID, err := authorizeIdTag(ctx, req.IdTag, req.Timestamp.Time)
+		if err != nil {
+			return nil, false, err
+		}
+		tx.UserID = userID
+	}
+	if err := db.CreateTransaction(ctx, tx); err != nil {
+		return nil, false, err
+	}
+	log.Printf("StopTransaction from %s for unknown transaction %d recorded as transaction %d", chargerID, req.TransactionId, tx.ID)
+	return tx, true, nil
+}
+
+// matchUnknownStop finds the running transaction a StopTransaction with an unknown
+// transactionId stands for: the only one of the charger that the same idTag
+// started before the stop. A stop without idTag is matched with none, as it could
+// belong to any connector.
+func matchUnknownStop(ctx context.Context, chargerID string, req *ocpp16.StopTransactionRequest) (*models.Transaction, error) {
+	if req.IdTag == "" {
+		return nil, nil
+	}
+	active, err := db.ListChargerActiveTransactions(ctx, chargerID)
+	if err != nil {
+		return nil, err
+	}
+	var match *models.Transaction
+	for i := range active {
+		tx := &active[i]
+		if tx.IdTag != req.IdTag || tx.StartedAt.After(req.Timestamp.Time) || tx.MeterStart > req.MeterStop {
+			continue
+		}
+		if match != nil {
+			return nil, nil
+		}
+		match = tx
+	}
+	return match, nil
+}
+
+// transactionBegin returns the time and energy register, in Wh, of the earliest
+// reading in the transaction data of a StopTransaction
+func transactionBegin(data []ocpp16.MeterValue) (time.Time, int, bool) {
+	var begin time.Time
+	meterStart, found := 0, false
+	for _, mv := range data {
+		if found && !mv.Timestamp.Before(begin) {
+			continue
+		}
+		for _, sv := range mv.SampledValue {
+			if measurandOf(sv) != ocpp16.MeasurandEnergyActiveImportRegister || sv.Phase != "" {
+				continue
+			}
+			value, _, ok := sampledValueSI(sv)
+			if !ok {
+				continue
+			}
+			begin, meterStart, found = mv.Timestamp.Time, int(math.Round(value)), true
+			break
+		}
+	}
+	return begin, meterStart, found
+}
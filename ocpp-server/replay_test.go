@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+	"ocpp-server/ocpp201"
+)
+
+// testDatabase connects db.DB to the Postgres database named by
+// OCPP_TEST_DATABASE_URL, skipping the test when there is none
+func testDatabase(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("OCPP_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("OCPP_TEST_DATABASE_URL not set")
+	}
+	testDatabaseOnce.Do(func() {
+		os.Setenv("DATABASE_URL", dsn)
+		testDatabaseErr = db.Init()
+	})
+	if testDatabaseErr != nil {
+		t.Fatalf("test database: %v", testDatabaseErr)
+	}
+}
+
+var (
+	testDatabaseOnce sync.Once
+	testDatabaseErr  error
+)
+
+func TestMessageDigest(t *testing.T) {
+	at := ocpp16.DateTime{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	start := func(meterStart int) ocpp16.Request {
+		return &ocpp16.StartTransactionRequest{ConnectorId: 1, IdTag: "TAG1", MeterStart: meterStart, Timestamp: at}
+	}
+	digest := func(t *testing.T, request ocpp16.Request) string {
+		t.Helper()
+		d, err := messageDigest(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		a, b ocpp16.Request
+		same bool
+	}{
+		{
+			name: "same message",
+			a:    start(100),
+			b:    start(100),
+			same: true,
+		},
+		{
+			name: "same message laid out differently",
+			a:    mustParseRequest(t, "StopTransaction", `{"transactionId":7,"meterStop":900,"timestamp":"2024-01-01T12:00:00Z"}`),
+			b:    mustParseRequest(t, "StopTransaction", `{ "timestamp": "2024-01-01T12:00:00.000Z", "meterStop": 900, "transactionId": 7 }`),
+			same: true,
+		},
+		{
+			name: "different payload",
+			a:    start(100),
+			b:    start(101),
+		},
+		{
+			name: "same payload, different action",
+			a:    &ocpp16.HeartbeatRequest{},
+			b:    &ocpp16.ClearCacheRequest{},
+		},
+		{
+			name: "2.0.1 events differing by seqNo",
+			a:    &ocpp201.TransactionEventRequest{EventType: ocpp201.TransactionEventUpdated, Timestamp: ocpp201.DateTime{Time: at.Time}, SeqNo: 1},
+			b:    &ocpp201.TransactionEventRequest{EventType: ocpp201.TransactionEventUpdated, Timestamp: ocpp201.DateTime{Time: at.Time}, SeqNo: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := digest(t, tt.a) == digest(t, tt.b); same != tt.same {
+				t.Errorf("same digest %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func mustParseRequest(t *testing.T, action, payload string) ocpp16.Request {
+	t.Helper()
+	req, err := ocpp16.ParseRequest(action, []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestHandleOnce(t *testing.T) {
+	testDatabase(t)
+	ctx := context.Background()
+	s := &OCPPServer{}
+	chargerID := "test-replay-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		db.DB.NewDelete().Model((*models.ProcessedMessage)(nil)).Where("charger_id = ?", chargerID).Exec(ctx)
+	})
+
+	at := ocpp16.DateTime{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	transactionID := 0
+	handle := func() (ocpp16.Confirmation, error) {
+		transactionID++
+		return &ocpp16.StartTransactionConfirmation{
+			TransactionId: transactionID,
+			IdTagInfo:     ocpp16.IdTagInfo{Status: ocpp16.AuthorizationStatusAccepted},
+		}, nil
+	}
+	start := func(meterStart int) ocpp16.Request {
+		return &ocpp16.StartTransactionRequest{ConnectorId: 1, IdTag: "TAG1", MeterStart: meterStart, Timestamp: at}
+	}
+
+	tests := []struct {
+		name    string
+		request ocpp16.Request
+		want    int
+	}{
+		{name: "first message is handled", request: start(100), want: 1},
+		{name: "replay gets the same answer", request: start(100), want: 1},
+		{name: "another message is handled", request: start(200), want: 2},
+		{name: "replay of the first one still answered as then", request: start(100), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := s.handleOnce(chargerID, tt.request, ocpp16.ParseConfirmation, handle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := conf.(*ocpp16.StartTransactionConfirmation).TransactionId; got != tt.want {
+				t.Errorf("transactionId %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if transactionID != 2 {
+		t.Errorf("handled %d messages, want 2", transactionID)
+	}
+}
+
+func TestHandleOnceTransactionEvent(t *testing.T) {
+	testDatabase(t)
+	ctx := context.Background()
+	s := &OCPPServer{}
+	chargerID := "test-replay-201-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		db.DB.NewDelete().Model((*models.ProcessedMessage)(nil)).Where("charger_id = ?", chargerID).Exec(ctx)
+	})
+
+	event := &ocpp201.TransactionEventRequest{
+		EventType:       ocpp201.TransactionEventUpdated,
+		Timestamp:       ocpp201.DateTime{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+		TriggerReason:   "MeterValuePeriodic",
+		SeqNo:           3,
+		TransactionInfo: ocpp201.Transaction{TransactionId: "tx-1"},
+	}
+	handled := 0
+	handle := func() (ocpp16.Confirmation, error) {
+		handled++
+		priority := handled
+		return &ocpp201.TransactionEventResponse{ChargingPriority: &priority}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		conf, err := s.handleOnce(chargerID, event, parseResponse201, handle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := *conf.(*ocpp201.TransactionEventResponse).ChargingPriority; got != 1 {
+			t.Errorf("answer %d: chargingPriority %d, want 1", i, got)
+		}
+	}
+	if handled != 1 {
+		t.Errorf("handled %d events, want 1", handled)
+	}
+}
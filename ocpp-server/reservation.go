@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// reservationSweepInterval is how often scheduled reservations are sent to their
+// charger and lapsed ones expired
+const reservationSweepInterval = 15 * time.Second
+
+// reservationRequest is the body a driver posts to reserve a connector
+type reservationRequest struct {
+	ChargerID   string    `json:"charger_id"`
+	ConnectorID int       `json:"connector_id"`
+	IdTag       string    `json:"id_tag"`
+	StartsAt    time.Time `json:"starts_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// newReservation validates a reservation request of userID against the idTag and
+// charging point stores
+func newReservation(ctx context.Context, userID int64, req *reservationRequest, now time.Time) (*models.Reservation, error) {
+	if req.ChargerID == "" || req.IdTag == "" {
+		return nil, fmt.Errorf("%w: charger_id and id_tag are required", errInvalidCommand)
+	}
+	if req.ConnectorID < 0 {
+		return nil, fmt.Errorf("%w: connector_id must be 0 or greater", errInvalidCommand)
+	}
+	if req.StartsAt.IsZero() {
+		req.StartsAt = now
+	}
+	if req.ExpiresAt.IsZero() || !req.ExpiresAt.After(req.StartsAt) {
+		return nil, fmt.Errorf("%w: expires_at must be after starts_at", errInvalidCommand)
+	}
+	if !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at is in the past", errInvalidCommand)
+	}
+
+	if _, err := db.FindChargingPoint(ctx, req.ChargerID); err != nil {
+		return nil, err
+	}
+
+	tag, err := db.GetIdTag(ctx, req.IdTag)
+	if errors.Is(err, db.ErrIdTagNotFound) || (err == nil && tag.UserID != userID) {
+		return nil, fmt.Errorf("%w: id_tag %s does not belong to you", errInvalidCommand, req.IdTag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := idTagInfoFor(tag, now)
+	if info.Status != ocpp16.AuthorizationStatusAccepted {
+		return nil, fmt.Errorf("%w: id_tag %s is %s", errInvalidCommand, req.IdTag, info.Status)
+	}
+
+	return &models.Reservation{
+		ChargerID:   req.ChargerID,
+		ConnectorID: req.ConnectorID,
+		UserID:      &userID,
+		IdTag:       tag.Tag,
+		ParentIdTag: tag.ParentIdTag,
+		StartsAt:    req.StartsAt,
+		ExpiresAt:   req.ExpiresAt,
+		Status:      models.ReservationStatusScheduled,
+	}, nil
+}
+
+// activateReservation sends ReserveNow for a scheduled reservation whose window
+// has opened. A reservation the charger refuses is marked Failed; one that could
+// not be sent stays Scheduled and is retried on the next sweep.
+func (s *OCPPServer) activateReservation(ctx context.Context, res *models.Reservation) error {
+	conf, err := s.SendRemoteCommand(ctx, res.ChargerID, &ocpp16.ReserveNowRequest{
+		ConnectorId:   res.ConnectorID,
+		ExpiryDate:    *ocpp16.NewDateTime(res.ExpiresAt),
+		IdTag:         res.IdTag,
+		ParentIdTag:   res.ParentIdTag,
+		ReservationId: int(res.ID),
+	})
+	if errors.Is(err, errChargerNotConnected) || errors.Is(err, errChargerDisconnected) ||
+		errors.Is(err, errConnectionClosed) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if err != nil {
+		return db.UpdateReservationStatus(ctx, res, models.ReservationStatusFailed, err.Error())
+	}
+
+	status := conf.(*ocpp16.ReserveNowConfirmation).Status
+	if status != ocpp16.ReservationStatusAccepted {
+		return db.UpdateReservationStatus(ctx, res, models.ReservationStatusFailed, string(status))
+	}
+	return db.UpdateReservationStatus(ctx, res, models.ReservationStatusActive, "")
+}
+
+// cancelReservation withdraws a reservation, sending CancelReservation when the
+// charger already holds it. A charger that cannot be reached lets the reservation
+// lapse on its own at expiryDate.
+func (s *OCPPServer) cancelReservation(ctx context.Context, res *models.Reservation) error {
+	var errMsg string
+	if res.Status == models.ReservationStatusActive {
+		conf, err := s.SendRemoteCommand(ctx, res.ChargerID, &ocpp16.CancelReservationRequest{ReservationId: int(res.ID)})
+		switch {
+		case err != nil:
+			errMsg = err.Error()
+		case conf.(*ocpp16.CancelReservationConfirmation).Status != ocpp16.CancelReservationStatusAccepted:
+			errMsg = "charger answered " + string(conf.(*ocpp16.CancelReservationConfirmation).Status)
+		}
+	}
+	return db.UpdateReservationStatus(ctx, res, models.ReservationStatusCancelled, errMsg)
+}
+
+// sweepReservations periodically activates due reservations and expires lapsed ones
+func (s *OCPPServer) sweepReservations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n, err := db.ExpireReservations(ctx, now); err != nil {
+				log.Printf("Failed to expire reservations: %v", err)
+			} else if n > 0 {
+				log.Printf("Expired %d reservation(s)", n)
+			}
+
+			due, err := db.DueReservations(ctx, now)
+			if err != nil {
+				log.Printf("Failed to list due reservations: %v", err)
+				continue
+			}
+			for i := range due {
+				if s.getCharger(due[i].ChargerID) == nil {
+					continue
+				}
+				if err := s.activateReservation(ctx, &due[i]); err != nil {
+					log.Printf("Failed to activate reservation %d on %s: %v", due[i].ID, due[i].ChargerID, err)
+				}
+			}
+		}
+	}
+}
+
+// useReservation links the reservation a StartTransaction refers to with its transaction
+func useReservation(ctx context.Context, chargerID string, reservationID *int, transactionID int64) {
+	if reservationID == nil {
+		return
+	}
+	err := db.UseReservation(ctx, int64(*reservationID), chargerID, transactionID)
+	if errors.Is(err, db.ErrReservationNotFound) {
+		log.Printf("Transaction %d on %s refers to unknown or closed reservation %d", transactionID, chargerID, *reservationID)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to link reservation %d to transaction %d: %v", *reservationID, transactionID, err)
+	}
+}
+
+func writeReservationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidCommand):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, db.ErrReservationConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, db.ErrReservationNotFound), errors.Is(err, db.ErrChargingPointNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleReservations lists (GET) or creates (POST) the reservations of the
+// authenticated driver
+func (s *OCPPServer) handleReservations(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := authenticatedUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		reservations, err := db.ListReservations(r.Context(), &userID, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"reservations": reservations,
+		})
+
+	case http.MethodPost:
+		var req reservationRequest
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		res, err := newReservation(r.Context(), userID, &req, now)
+		if err != nil {
+			writeReservationError(w, err)
+			return
+		}
+		if err := db.CreateReservation(r.Context(), res); err != nil {
+			writeReservationError(w, err)
+			return
+		}
+
+		// A window that is already open is reserved on the charger right away
+		if !res.StartsAt.After(now) && s.getCharger(res.ChargerID) != nil {
+			if err := s.activateReservation(r.Context(), res); err != nil {
+				log.Printf("Failed to activate reservation %d on %s: %v", res.ID, res.ChargerID, err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(res)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleReservation reads (GET) or cancels (DELETE) one reservation of the
+// authenticated driver
+func (s *OCPPServer) handleReservation(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := authenticatedUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+	res, err := db.GetReservation(r.Context(), id)
+	if err == nil && (res.UserID == nil || *res.UserID != userID) {
+		err = db.ErrReservationNotFound
+	}
+	if err != nil {
+		writeReservationError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodDelete:
+		if res.Status != models.ReservationStatusScheduled && res.Status != models.ReservationStatusActive {
+			http.Error(w, "reservation is "+res.Status, http.StatusConflict)
+			return
+		}
+		if err := s.cancelReservation(r.Context(), res); err != nil {
+			writeReservationError(w, err)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleChargerReservations lists the reservations of one charger
+func (s *OCPPServer) handleChargerReservations(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	reservations, err := db.ListReservations(r.Context(), nil, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reservations": reservations,
+	})
+}
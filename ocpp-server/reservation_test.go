@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestNewReservationWindow covers the checks made before the charger and idTag
+// are looked up
+func TestNewReservationWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		req  reservationRequest
+	}{
+		{
+			name: "charger missing",
+			req:  reservationRequest{IdTag: "TAG1", ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name: "idTag missing",
+			req:  reservationRequest{ChargerID: "cp1", ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name: "negative connector",
+			req:  reservationRequest{ChargerID: "cp1", IdTag: "TAG1", ConnectorID: -1, ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name: "no expiry",
+			req:  reservationRequest{ChargerID: "cp1", IdTag: "TAG1"},
+		},
+		{
+			name: "expires when it starts",
+			req:  reservationRequest{ChargerID: "cp1", IdTag: "TAG1", StartsAt: now.Add(time.Hour), ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name: "expires before it starts",
+			req:  reservationRequest{ChargerID: "cp1", IdTag: "TAG1", StartsAt: now.Add(2 * time.Hour), ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name: "starting now by default, already expired",
+			req:  reservationRequest{ChargerID: "cp1", IdTag: "TAG1", ExpiresAt: now},
+		},
+		{
+			name: "window in the past",
+			req:  reservationRequest{ChargerID: "cp1", IdTag: "TAG1", StartsAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newReservation(context.Background(), 1, &tt.req, now)
+			if !errors.Is(err, errInvalidCommand) {
+				t.Errorf("error %v, want %v", err, errInvalidCommand)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Security profiles of the OCPP 1.6 security whitepaper
+const (
+	SecurityProfileNone          = 0
+	SecurityProfileBasicAuth     = 1
+	SecurityProfileTLSBasicAuth  = 2
+	SecurityProfileTLSClientCert = 3
+)
+
+// AuthorizationKey length limits of the security whitepaper
+const (
+	minAuthorizationKeyLength = 16
+	maxAuthorizationKeyLength = 40
+)
+
+// securityConfig is the server-wide security configuration, read from the environment
+type securityConfig struct {
+	DefaultProfile int    // profile of chargers without a charger_security row
+	TLSAddr        string // listen address of the TLS endpoint, e.g. :9443
+	CertFile       string // server certificate (profiles 2 and 3)
+	KeyFile        string
+	ClientCAFile   string // CA bundle used to verify charger certificates (profile 3)
+}
+
+// loadSecurityConfig reads OCPP_DEFAULT_SECURITY_PROFILE, OCPP_TLS_ADDR,
+// OCPP_TLS_CERT, OCPP_TLS_KEY and OCPP_TLS_CLIENT_CA
+func loadSecurityConfig() (securityConfig, error) {
+	cfg := securityConfig{
+		TLSAddr:      os.Getenv("OCPP_TLS_ADDR"),
+		CertFile:     os.Getenv("OCPP_TLS_CERT"),
+		KeyFile:      os.Getenv("OCPP_TLS_KEY"),
+		ClientCAFile: os.Getenv("OCPP_TLS_CLIENT_CA"),
+	}
+	if cfg.TLSAddr == "" {
+		cfg.TLSAddr = ":9443"
+	}
+	if v := os.Getenv("OCPP_DEFAULT_SECURITY_PROFILE"); v != "" {
+		profile, err := strconv.Atoi(v)
+		if err != nil || profile < SecurityProfileNone || profile > SecurityProfileTLSClientCert {
+			return cfg, fmt.Errorf("invalid OCPP_DEFAULT_SECURITY_PROFILE %q", v)
+		}
+		cfg.DefaultProfile = profile
+	}
+	return cfg, nil
+}
+
+// TLSEnabled reports whether a server certificate is configured
+func (cfg securityConfig) TLSEnabled() bool {
+	return cfg.CertFile != "" && cfg.KeyFile != ""
+}
+
+// TLSConfig builds the TLS configuration of the secure endpoint. Client certificates
+// are verified when presented but not required, so that profile 2 chargers can share it.
+func (cfg securityConfig) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// authError is a failed WebSocket handshake authentication
+type authError struct {
+	status  int
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+// authenticateCharger enforces the security profile of chargerID on its WebSocket handshake
+func (s *OCPPServer) authenticateCharger(r *http.Request, chargerID string) error {
+	sec, err := db.GetChargerSecurity(r.Context(), chargerID)
+	if err != nil {
+		return &authError{http.StatusInternalServerError, err.Error()}
+	}
+	if sec == nil {
+		sec = &models.ChargerSecurity{ChargerID: chargerID, SecurityProfile: s.defaultSecurityProfile}
+	}
+
+	// A verified client certificate always has to belong to the identity in the URL
+	cert := verifiedClientCertificate(r)
+	if cert != nil && cert.Subject.CommonName != chargerID {
+		return &authError{http.StatusForbidden, fmt.Sprintf("client certificate issued to %q", cert.Subject.CommonName)}
+	}
+
+	switch sec.SecurityProfile {
+	case SecurityProfileNone:
+		return nil
+	case SecurityProfileBasicAuth:
+		return checkBasicAuth(r, chargerID, sec)
+	case SecurityProfileTLSBasicAuth:
+		if r.TLS == nil {
+			return &authError{http.StatusForbidden, "security profile 2 requires TLS"}
+		}
+		return checkBasicAuth(r, chargerID, sec)
+	case SecurityProfileTLSClientCert:
+		if cert == nil {
+			return &authError{http.StatusForbidden, "security profile 3 requires a client certificate"}
+		}
+		if sec.CertificateFingerprint != "" && !strings.EqualFold(certificateFingerprint(cert), sec.CertificateFingerprint) {
+			return &authError{http.StatusForbidden, "client certificate does not match the pinned fingerprint"}
+		}
+		return nil
+	default:
+		return &authError{http.StatusInternalServerError, fmt.Sprintf("unknown security profile %d", sec.SecurityProfile)}
+	}
+}
+
+// checkBasicAuth verifies the HTTP Basic credentials: the username is the charger
+// identity and the password its AuthorizationKey
+func checkBasicAuth(r *http.Request, chargerID string, sec *models.ChargerSecurity) error {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return &authError{http.StatusUnauthorized, "basic authentication required"}
+	}
+	if subtle.ConstantTimeCompare([]byte(username), []byte(chargerID)) != 1 ||
+		sec.PasswordHash == "" ||
+		bcrypt.CompareHashAndPassword([]byte(sec.PasswordHash), []byte(password)) != nil {
+		return &authError{http.StatusUnauthorized, "invalid credentials"}
+	}
+	return nil
+}
+
+// verifiedClientCertificate returns the client certificate of the connection if it chained to a trusted CA
+func verifiedClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// certificateFingerprint returns the hex SHA-256 fingerprint of a certificate
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// handleChargerSecurity reads (GET) or sets (PUT) the security profile of a charger.
+// Only operators may, as the profile holds the charger credentials.
+func (s *OCPPServer) handleChargerSecurity(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	chargerID := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		sec, err := db.GetChargerSecurity(r.Context(), chargerID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sec == nil {
+			sec = &models.ChargerSecurity{ChargerID: chargerID, SecurityProfile: s.defaultSecurityProfile}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sec)
+
+	case http.MethodPut:
+		var req struct {
+			SecurityProfile        int    `json:"security_profile"`
+			Password               string `json:"password"`
+			CertificateFingerprint string `json:"certificate_fingerprint"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.SecurityProfile < SecurityProfileNone || req.SecurityProfile > SecurityProfileTLSClientCert {
+			http.Error(w, "security_profile must be between 0 and 3", http.StatusBadRequest)
+			return
+		}
+
+		sec := &models.ChargerSecurity{
+			ChargerID:              chargerID,
+			SecurityProfile:        req.SecurityProfile,
+			CertificateFingerprint: strings.ToLower(strings.ReplaceAll(req.CertificateFingerprint, ":", "")),
+		}
+		if req.SecurityProfile == SecurityProfileBasicAuth || req.SecurityProfile == SecurityProfileTLSBasicAuth {
+			if len(req.Password) < minAuthorizationKeyLength || len(req.Password) > maxAuthorizationKeyLength {
+				http.Error(w, fmt.Sprintf("password must be %d to %d characters", minAuthorizationKeyLength, maxAuthorizationKeyLength), http.StatusBadRequest)
+				return
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+				return
+			}
+			sec.PasswordHash = string(hash)
+		}
+
+		if err := db.SaveChargerSecurity(r.Context(), sec); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Security profile of %s set to %d", chargerID, sec.SecurityProfile)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sec)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
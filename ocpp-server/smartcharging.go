@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	db "ocpp-server/db"
+	"ocpp-server/models"
+	"ocpp-server/ocpp16"
+)
+
+// validateChargingProfile checks a profile against the rules of the Smart Charging
+// profile before it is sent, so that obviously broken profiles never reach a charger
+func validateChargingProfile(connectorID int, profile *ocpp16.ChargingProfile) error {
+	if connectorID < 0 {
+		return errors.New("connectorId must not be negative")
+	}
+	if profile.ChargingProfileId <= 0 {
+		return errors.New("chargingProfileId must be positive")
+	}
+	if profile.StackLevel < 0 {
+		return errors.New("stackLevel must not be negative")
+	}
+
+	switch profile.ChargingProfilePurpose {
+	case ocpp16.ChargePointMaxProfile:
+		if connectorID != 0 {
+			return errors.New("ChargePointMaxProfile can only be set on connector 0")
+		}
+	case ocpp16.TxDefaultProfile:
+	case ocpp16.TxProfile:
+		if connectorID == 0 {
+			return errors.New("TxProfile must be set on a connector with a transaction")
+		}
+		if profile.TransactionId == nil {
+			return errors.New("a TxProfile needs the transactionId it applies to")
+		}
+	default:
+		return fmt.Errorf("unknown chargingProfilePurpose %q", profile.ChargingProfilePurpose)
+	}
+	if profile.TransactionId != nil && profile.ChargingProfilePurpose != ocpp16.TxProfile {
+		return errors.New("transactionId is only allowed in a TxProfile")
+	}
+
+	schedule := &profile.ChargingSchedule
+	switch profile.ChargingProfileKind {
+	case ocpp16.ChargingProfileKindAbsolute:
+		if schedule.StartSchedule == nil {
+			return errors.New("an Absolute profile needs a startSchedule")
+		}
+	case ocpp16.ChargingProfileKindRecurring:
+		if profile.RecurrencyKind == "" {
+			return errors.New("a Recurring profile needs a recurrencyKind")
+		}
+		if schedule.StartSchedule == nil {
+			return errors.New("a Recurring profile needs a startSchedule")
+		}
+	case ocpp16.ChargingProfileKindRelative:
+	default:
+		return fmt.Errorf("unknown chargingProfileKind %q", profile.ChargingProfileKind)
+	}
+	if profile.RecurrencyKind != "" && profile.ChargingProfileKind != ocpp16.ChargingProfileKindRecurring {
+		return errors.New("recurrencyKind is only allowed in a Recurring profile")
+	}
+	if profile.ValidFrom != nil && profile.ValidTo != nil && !profile.ValidFrom.Before(profile.ValidTo.Time) {
+		return errors.New("validFrom must be before validTo")
+	}
+
+	return validateChargingSchedule(schedule)
+}
+
+// validateChargingSchedule checks the periods of a schedule: they start at 0, are
+// strictly increasing, fit in the duration and carry sensible limits
+func validateChargingSchedule(schedule *ocpp16.ChargingSchedule) error {
+	if schedule.ChargingRateUnit != ocpp16.ChargingRateUnitAmperes && schedule.ChargingRateUnit != ocpp16.ChargingRateUnitWatts {
+		return fmt.Errorf("unknown chargingRateUnit %q", schedule.ChargingRateUnit)
+	}
+	if schedule.Duration != nil && *schedule.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if schedule.MinChargingRate != nil && *schedule.MinChargingRate < 0 {
+		return errors.New("minChargingRate must not be negative")
+	}
+
+	periods := schedule.ChargingSchedulePeriod
+	if len(periods) == 0 {
+		return errors.New("chargingSchedulePeriod must not be empty")
+	}
+	if periods[0].StartPeriod != 0 {
+		return errors.New("the first chargingSchedulePeriod must start at 0")
+	}
+	for i, period := range periods {
+		if i > 0 && period.StartPeriod <= periods[i-1].StartPeriod {
+			return fmt.Errorf("chargingSchedulePeriod %d does not start after the previous one", i)
+		}
+		if schedule.Duration != nil && period.StartPeriod >= *schedule.Duration {
+			return fmt.Errorf("chargingSchedulePeriod %d starts after the end of the schedule", i)
+		}
+		if period.Limit < 0 {
+			return fmt.Errorf("chargingSchedulePeriod %d has a negative limit", i)
+		}
+		if period.NumberPhases != nil && (*period.NumberPhases < 1 || *period.NumberPhases > 3) {
+			return fmt.Errorf("chargingSchedulePeriod %d must use 1 to 3 phases", i)
+		}
+	}
+	return nil
+}
+
+// setChargingProfile validates a profile, sends it to the charger and stores it once accepted
+func (s *OCPPServer) setChargingProfile(ctx context.Context, chargerID string, req *ocpp16.SetChargingProfileRequest) (*ocpp16.SetChargingProfileConfirmation, *models.ChargingProfile, error) {
+	if err := validateChargingProfile(req.ConnectorId, &req.CsChargingProfiles); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidCommand, err)
+	}
+
+	response, err := s.SendRemoteCommand(ctx, chargerID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf := response.(*ocpp16.SetChargingProfileConfirmation)
+	if conf.Status != ocpp16.ChargingProfileStatusAccepted {
+		return conf, nil, nil
+	}
+
+	profile, err := chargingProfileRow(chargerID, req)
+	if err != nil {
+		return conf, nil, err
+	}
+	if err := db.SaveChargingProfile(ctx, profile); err != nil {
+		return conf, nil, err
+	}
+	log.Printf("Charging profile %d installed on %s connector %d", profile.ChargingProfileID, chargerID, profile.ConnectorID)
+	return conf, profile, nil
+}
+
+// chargingProfileRow converts an accepted SetChargingProfile into its stored form
+func chargingProfileRow(chargerID string, req *ocpp16.SetChargingProfileRequest) (*models.ChargingProfile, error) {
+	p := req.CsChargingProfiles
+	schedule, err := json.Marshal(p.ChargingSchedule)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &models.ChargingProfile{
+		ChargerID:         chargerID,
+		ChargingProfileID: p.ChargingProfileId,
+		ConnectorID:       req.ConnectorId,
+		StackLevel:        p.StackLevel,
+		Purpose:           string(p.ChargingProfilePurpose),
+		Kind:              string(p.ChargingProfileKind),
+		RecurrencyKind:    string(p.RecurrencyKind),
+		TransactionID:     p.TransactionId,
+		Schedule:          schedule,
+	}
+	if p.ValidFrom != nil {
+		profile.ValidFrom = &p.ValidFrom.Time
+	}
+	if p.ValidTo != nil {
+		profile.ValidTo = &p.ValidTo.Time
+	}
+	return profile, nil
+}
+
+// clearChargingProfiles asks the charger to remove the matching profiles and forgets them.
+// Stored profiles are removed on Unknown as well: the charger does not have them anyway.
+func (s *OCPPServer) clearChargingProfiles(ctx context.Context, chargerID string, req *ocpp16.ClearChargingProfileRequest) (*ocpp16.ClearChargingProfileConfirmation, int64, error) {
+	response, err := s.SendRemoteCommand(ctx, chargerID, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	conf := response.(*ocpp16.ClearChargingProfileConfirmation)
+
+	removed, err := db.DeleteChargingProfiles(ctx, chargerID, db.ChargingProfileFilter{
+		ChargingProfileID: req.Id,
+		ConnectorID:       req.ConnectorId,
+		Purpose:           string(req.ChargingProfilePurpose),
+		StackLevel:        req.StackLevel,
+	})
+	if err != nil {
+		return conf, 0, err
+	}
+	return conf, removed, nil
+}
+
+// handleChargingProfiles lists (GET), sets (POST) or clears (DELETE) the charging profiles
+// of a charger. POST takes a SetChargingProfile request; DELETE takes the ClearChargingProfile
+// criteria as query parameters: id, connectorId, chargingProfilePurpose and stackLevel.
+func (s *OCPPServer) handleChargingProfiles(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	chargerID := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		profiles, err := db.ListChargingProfiles(r.Context(), chargerID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"charging_profiles": profiles,
+		})
+
+	case http.MethodPost:
+		req := new(ocpp16.SetChargingProfileRequest)
+		r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		conf, profile, err := s.setChargingProfile(r.Context(), chargerID, req)
+		if err != nil {
+			writeCommandResponse(w, req.Action(), nil, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action":           req.Action(),
+			"response":         conf,
+			"charging_profile": profile,
+		})
+
+	case http.MethodDelete:
+		req, err := clearChargingProfileQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		conf, removed, err := s.clearChargingProfiles(r.Context(), chargerID, req)
+		if err != nil {
+			writeCommandResponse(w, req.Action(), nil, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action":   req.Action(),
+			"response": conf,
+			"removed":  removed,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// clearChargingProfileQuery builds a ClearChargingProfile request from query parameters
+func clearChargingProfileQuery(r *http.Request) (*ocpp16.ClearChargingProfileRequest, error) {
+	query := r.URL.Query()
+	req := &ocpp16.ClearChargingProfileRequest{
+		ChargingProfilePurpose: ocpp16.ChargingProfilePurpose(query.Get("chargingProfilePurpose")),
+	}
+
+	for name, field := range map[string]**int{
+		"id":          &req.Id,
+		"connectorId": &req.ConnectorId,
+		"stackLevel":  &req.StackLevel,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		*field = &n
+	}
+	return req, nil
+}
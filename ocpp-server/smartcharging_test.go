@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"ocpp-server/ocpp16"
+)
+
+func TestValidateChargingProfile(t *testing.T) {
+	transactionID := 42
+	start := &ocpp16.DateTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	// profile returns a valid TxDefaultProfile limited to 16 A, modified by edit
+	profile := func(edit func(p *ocpp16.ChargingProfile)) *ocpp16.ChargingProfile {
+		p := &ocpp16.ChargingProfile{
+			ChargingProfileId:      1,
+			StackLevel:             0,
+			ChargingProfilePurpose: ocpp16.TxDefaultProfile,
+			ChargingProfileKind:    ocpp16.ChargingProfileKindRelative,
+			ChargingSchedule: ocpp16.ChargingSchedule{
+				ChargingRateUnit: ocpp16.ChargingRateUnitAmperes,
+				ChargingSchedulePeriod: []ocpp16.ChargingSchedulePeriod{
+					{StartPeriod: 0, Limit: 16},
+					{StartPeriod: 3600, Limit: 8},
+				},
+			},
+		}
+		if edit != nil {
+			edit(p)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name        string
+		connectorID int
+		profile     *ocpp16.ChargingProfile
+		wantErr     bool
+	}{
+		{
+			name:        "valid TxDefaultProfile",
+			connectorID: 1,
+			profile:     profile(nil),
+		},
+		{
+			name:        "valid TxProfile",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingProfilePurpose = ocpp16.TxProfile
+				p.TransactionId = &transactionID
+			}),
+		},
+		{
+			name:        "valid Recurring profile",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingProfileKind = ocpp16.ChargingProfileKindRecurring
+				p.RecurrencyKind = ocpp16.RecurrencyKindDaily
+				p.ChargingSchedule.StartSchedule = start
+			}),
+		},
+		{
+			name:        "empty chargingSchedulePeriod",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingSchedule.ChargingSchedulePeriod = nil
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "periods out of order",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingSchedule.ChargingSchedulePeriod = []ocpp16.ChargingSchedulePeriod{
+					{StartPeriod: 0, Limit: 16},
+					{StartPeriod: 3600, Limit: 8},
+					{StartPeriod: 1800, Limit: 10},
+				}
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "first period not at 0",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingSchedule.ChargingSchedulePeriod[0].StartPeriod = 60
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "negative limit",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingSchedule.ChargingSchedulePeriod[1].Limit = -1
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "Recurring without recurrencyKind",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingProfileKind = ocpp16.ChargingProfileKindRecurring
+				p.ChargingSchedule.StartSchedule = start
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "TxProfile without transactionId",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingProfilePurpose = ocpp16.TxProfile
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "TxProfile on connector 0",
+			connectorID: 0,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingProfilePurpose = ocpp16.TxProfile
+				p.TransactionId = &transactionID
+			}),
+			wantErr: true,
+		},
+		{
+			name:        "ChargePointMaxProfile on a connector",
+			connectorID: 1,
+			profile: profile(func(p *ocpp16.ChargingProfile) {
+				p.ChargingProfilePurpose = ocpp16.ChargePointMaxProfile
+			}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateChargingProfile(tt.connectorID, tt.profile)
+			if tt.wantErr && err == nil {
+				t.Error("profile accepted, want an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("profile rejected: %v", err)
+			}
+		})
+	}
+}
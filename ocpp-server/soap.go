@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ocpp-server/ocpp15"
+	"ocpp-server/ocpp16"
+
+	"github.com/google/uuid"
+)
+
+// soapPath is where OCPP 1.5 charge points post their CentralSystemService requests
+const soapPath = "/Ocpp/CentralSystemService"
+
+// soapCharger is an OCPP 1.5 charge point. It keeps no connection open: it posts
+// each request to the CentralSystemService and is called back at the
+// ChargePointService address it reports in wsa:From.
+type soapCharger struct {
+	ID                string
+	Endpoint          string
+	LastSeen          time.Time
+	HeartbeatInterval time.Duration
+}
+
+// silenceTimeout is how long a SOAP charger may go without posting a request
+func (c *soapCharger) silenceTimeout() time.Duration {
+	return missedHeartbeats * c.HeartbeatInterval
+}
+
+// touchSOAPCharger records an authenticated request from an OCPP 1.5 charger
+func (s *OCPPServer) touchSOAPCharger(chargerID string) {
+	s.soapMu.Lock()
+	charger, known := s.soapChargers[chargerID]
+	if !known {
+		charger = &soapCharger{ID: chargerID, HeartbeatInterval: heartbeatInterval * time.Second}
+		s.soapChargers[chargerID] = charger
+	}
+	charger.LastSeen = time.Now()
+	s.soapMu.Unlock()
+
+	if !known {
+		s.events.publish(Event{
+			Type:      EventChargerOnline,
+			ChargerID: chargerID,
+			Data: map[string]interface{}{
+				"protocol": ocpp15.Protocol,
+			},
+		})
+	}
+}
+
+// setSOAPEndpoint records the ChargePointService address a charger reported in
+// wsa:From of a request that was answered, once validated by soapEndpoint
+func (s *OCPPServer) setSOAPEndpoint(r *http.Request, chargerID, from string) {
+	if from == "" || from == ocpp15.AnonymousAddress {
+		return
+	}
+	endpoint, err := soapEndpoint(r, from)
+	if err != nil {
+		log.Printf("Ignored ChargePointService address of %s: %v", chargerID, err)
+		return
+	}
+
+	s.soapMu.Lock()
+	defer s.soapMu.Unlock()
+	if charger, ok := s.soapChargers[chargerID]; ok && charger.Endpoint != endpoint {
+		log.Printf("Charger %s reachable at %s", chargerID, endpoint)
+		charger.Endpoint = endpoint
+	}
+}
+
+// soapEndpoint checks a ChargePointService address: an http or https URL on the
+// host the request came from, so that a charger cannot make the server send its
+// commands to any other host
+func soapEndpoint(r *http.Request, from string) (string, error) {
+	u, err := url.Parse(from)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return "", fmt.Errorf("%q is not an http(s) URL", from)
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+	remoteIP := net.ParseIP(remote)
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if !ip.Equal(remoteIP) {
+			return "", fmt.Errorf("%s is not the address of the charger, %s", ip, remote)
+		}
+		return u.String(), nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(r.Context(), u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if !addr.IP.Equal(remoteIP) {
+			continue
+		}
+		// Without TLS nothing ties the name to the charger once it resolves elsewhere
+		if u.Scheme == "http" {
+			port := u.Port()
+			if port == "" {
+				port = "80"
+			}
+			u.Host = net.JoinHostPort(remoteIP.String(), port)
+		}
+		return u.String(), nil
+	}
+	return "", fmt.Errorf("%s does not resolve to the address of the charger, %s", u.Hostname(), remote)
+}
+
+func (s *OCPPServer) setSOAPHeartbeatInterval(chargerID string, interval time.Duration) {
+	s.soapMu.Lock()
+	defer s.soapMu.Unlock()
+	if charger, ok := s.soapChargers[chargerID]; ok {
+		charger.HeartbeatInterval = interval
+	}
+}
+
+// getSOAPCharger returns a copy of the OCPP 1.5 charger with the given ID, or nil
+func (s *OCPPServer) getSOAPCharger(chargerID string) *soapCharger {
+	s.soapMu.RLock()
+	defer s.soapMu.RUnlock()
+	charger, ok := s.soapChargers[chargerID]
+	if !ok {
+		return nil
+	}
+	c := *charger
+	return &c
+}
+
+// sweepSOAPChargers forgets the OCPP 1.5 chargers that stopped posting requests
+// and marks them offline
+func (s *OCPPServer) sweepSOAPChargers(now time.Time) {
+	s.soapMu.Lock()
+	var silent []soapCharger
+	for id, charger := range s.soapChargers {
+		if now.Sub(charger.LastSeen) > charger.silenceTimeout() {
+			silent = append(silent, *charger)
+			delete(s.soapChargers, id)
+		}
+	}
+	s.soapMu.Unlock()
+
+	for _, charger := range silent {
+		log.Printf("Charger %s silent since %s, marking offline", charger.ID, charger.LastSeen.Format(time.RFC3339))
+		if err := updateChargerStatus(charger.ID, chargerStatusOffline); err != nil {
+			log.Printf("DB update error for charger %s: %v", charger.ID, err)
+		}
+		s.events.publish(Event{
+			Type:      EventChargerOffline,
+			ChargerID: charger.ID,
+			Data: map[string]interface{}{
+				"reason":    "heartbeat timeout",
+				"last_seen": charger.LastSeen,
+			},
+		})
+	}
+}
+
+// HandleSOAP serves the OCPP 1.5 CentralSystemService. Requests are converted to
+// their 1.6 equivalent and answered by the same handlers as OCPP-J CALLs.
+func (s *OCPPServer) HandleSOAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	env, err := ocpp15.ParseEnvelope(data)
+	if err != nil {
+		log.Printf("Invalid SOAP message from %s: %v", r.RemoteAddr, err)
+		writeSOAPFault(w, ocpp15.Header{}, toOCPPError(err), 0)
+		return
+	}
+	chargerID := env.Header.ChargeBoxIdentity
+	if chargerID == "" {
+		writeSOAPFault(w, env.Header, ocpp16.NewError(ocpp16.ProtocolError, "chargeBoxIdentity header missing"), 0)
+		return
+	}
+
+	if err := s.authenticateCharger(r, chargerID); err != nil {
+		log.Printf("Refused SOAP request of %s from %s: %v", chargerID, r.RemoteAddr, err)
+		status := http.StatusUnauthorized
+		if authErr, ok := err.(*authError); ok {
+			status = authErr.status
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="OCPP"`)
+		}
+		writeSOAPFault(w, env.Header, ocpp16.NewError(ocpp16.SecurityError, "%s", http.StatusText(status)), status)
+		return
+	}
+
+	log.Printf("Received from %s (SOAP): %s", chargerID, data)
+	s.touchSOAPCharger(chargerID)
+
+	request, err := ocpp15.ParseRequest(env)
+	if err != nil {
+		log.Printf("Rejected %s from %s: %v", env.Name, chargerID, err)
+		writeSOAPFault(w, env.Header, toOCPPError(err), 0)
+		return
+	}
+
+	// Until its BootNotification is accepted a charger may not send anything else
+	if request.Action() != "BootNotification" {
+		status, err := registrationStatus(r.Context(), chargerID)
+		if err != nil {
+			writeSOAPFault(w, env.Header, toOCPPError(err), 0)
+			return
+		}
+		if status != ocpp16.RegistrationStatusAccepted {
+			log.Printf("Refused %s from %s: charger not accepted", request.Action(), chargerID)
+			writeSOAPFault(w, env.Header, ocpp16.NewError(ocpp16.SecurityError, "charge point is not accepted by the central system"), 0)
+			return
+		}
+	}
+
+	response, err := s.handleCall(chargerID, request)
+	if err != nil {
+		log.Printf("Failed to handle %s from %s: %v", request.Action(), chargerID, err)
+		writeSOAPFault(w, env.Header, toOCPPError(err), 0)
+		return
+	}
+	if conf, ok := response.(*ocpp16.BootNotificationConfirmation); ok {
+		s.setSOAPHeartbeatInterval(chargerID, time.Duration(conf.Interval)*time.Second)
+	}
+	s.setSOAPEndpoint(r, chargerID, env.Header.From)
+
+	message, err := ocpp15.NewResponse(response)
+	if err != nil {
+		writeSOAPFault(w, env.Header, toOCPPError(err), 0)
+		return
+	}
+	body, err := ocpp15.Marshal(ocpp15.Header{
+		MessageID: "urn:uuid:" + uuid.New().String(),
+		RelatesTo: env.Header.MessageID,
+		Action:    ocpp15.ResponseAction(request.Action()),
+		To:        ocpp15.AnonymousAddress,
+	}, message)
+	if err != nil {
+		log.Printf("Error building response to %s: %v", chargerID, err)
+		writeSOAPFault(w, env.Header, ocpp16.NewError(ocpp16.InternalError, "failed to build %s response", request.Action()), 0)
+		return
+	}
+
+	w.Header().Set("Content-Type", ocpp15.ContentType)
+	w.Write(body)
+	log.Printf("Sent to %s (SOAP): %s", chargerID, body)
+
+	// The charger may only handle our requests once it has its answer
+	go s.afterCall(chargerID, request)
+}
+
+// writeSOAPFault answers a SOAP request with a fault. status overrides the HTTP
+// status the fault is normally sent with.
+func writeSOAPFault(w http.ResponseWriter, request ocpp15.Header, callErr *ocpp16.Error, status int) {
+	fault, faultStatus := ocpp15.Fault(callErr)
+	if status == 0 {
+		status = faultStatus
+	}
+	body, err := ocpp15.Marshal(ocpp15.Header{
+		MessageID: "urn:uuid:" + uuid.New().String(),
+		RelatesTo: request.MessageID,
+		Action:    "http://www.w3.org/2005/08/addressing/soap/fault",
+		To:        ocpp15.AnonymousAddress,
+	}, fault)
+	if err != nil {
+		http.Error(w, callErr.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ocpp15.ContentType)
+	w.WriteHeader(status)
+	w.Write(body)
+	log.Printf("Sent fault to %s: %v", request.ChargeBoxIdentity, callErr)
+}
+
+// sendSOAPCommand calls the ChargePointService of an OCPP 1.5 charger. Errors are
+// reported like those of SendRemoteCommand.
+func (s *OCPPServer) sendSOAPCommand(ctx context.Context, charger *soapCharger, request ocpp16.Request) (ocpp16.Confirmation, error) {
+	if charger.Endpoint == "" {
+		return nil, fmt.Errorf("charger %s did not report its ChargePointService address: %w", charger.ID, errChargerNotConnected)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remoteCommandTimeout)
+	defer cancel()
+
+	log.Printf("Sending command %s to %s at %s (SOAP)", request.Action(), charger.ID, charger.Endpoint)
+	conf, err := s.soapClient.Call(ctx, charger.Endpoint, charger.ID, request)
+
+	var callErr *ocpp16.Error
+	switch {
+	case err == nil:
+		return conf, nil
+	case errors.As(err, &callErr):
+		return nil, err
+	case errors.Is(err, ocpp15.ErrNotSupported):
+		return nil, fmt.Errorf("%w: %v", errInvalidCommand, err)
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("no answer from %s to %s: %w", charger.ID, request.Action(), ctx.Err())
+	default:
+		return nil, fmt.Errorf("charger %s: %w: %v", charger.ID, errChargerNotConnected, err)
+	}
+}
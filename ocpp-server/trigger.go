@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"ocpp-server/ocpp16"
+)
+
+// triggerSettleDelay is how long a trigger covering every connector keeps
+// collecting messages after the last one arrived
+const triggerSettleDelay = 2 * time.Second
+
+// triggeredMessage is a CALL a charger sent in answer to a TriggerMessage
+type triggeredMessage struct {
+	Action  string         `json:"action"`
+	Payload ocpp16.Request `json:"payload"`
+}
+
+// triggerWaiter collects the CALLs matching a TriggerMessage. Like a pendingCall
+// it belongs to one connection.
+type triggerWaiter struct {
+	charger     *Charger
+	action      string
+	connectorID *int
+	messages    chan triggeredMessage
+}
+
+// matches reports whether request from charger is one the waiter asked for
+func (t *triggerWaiter) matches(charger *Charger, request ocpp16.Request) bool {
+	if charger != t.charger || request.Action() != t.action {
+		return false
+	}
+	if t.connectorID == nil {
+		return true
+	}
+	switch req := request.(type) {
+	case *ocpp16.StatusNotificationRequest:
+		return req.ConnectorId == *t.connectorID
+	case *ocpp16.MeterValuesRequest:
+		return req.ConnectorId == *t.connectorID
+	}
+	return true
+}
+
+// single reports whether the trigger yields exactly one message; StatusNotification
+// and MeterValues without a connectorId are sent once per connector
+func (t *triggerWaiter) single() bool {
+	if t.connectorID != nil {
+		return true
+	}
+	return t.action != string(ocpp16.TriggerStatusNotification) && t.action != string(ocpp16.TriggerMeterValues)
+}
+
+func (s *OCPPServer) addTriggerWaiter(t *triggerWaiter) {
+	s.triggerMu.Lock()
+	s.triggerWaiters[t] = struct{}{}
+	s.triggerMu.Unlock()
+}
+
+func (s *OCPPServer) removeTriggerWaiter(t *triggerWaiter) {
+	s.triggerMu.Lock()
+	delete(s.triggerWaiters, t)
+	s.triggerMu.Unlock()
+}
+
+// deliverTriggered hands a CALL the charger sent, once answered, to the
+// TriggerMessage callers waiting for it
+func (s *OCPPServer) deliverTriggered(charger *Charger, request ocpp16.Request) {
+	s.triggerMu.Lock()
+	defer s.triggerMu.Unlock()
+
+	for t := range s.triggerWaiters {
+		if !t.matches(charger, request) {
+			continue
+		}
+		select {
+		case t.messages <- triggeredMessage{Action: request.Action(), Payload: request}:
+		default:
+			log.Printf("Dropped triggered %s from %s: waiter full", request.Action(), charger.ID)
+		}
+	}
+}
+
+// triggerMessage sends TriggerMessage and, when the charger accepts it, waits for
+// the requested message(s) to arrive. The waiter is registered before the CALL goes
+// out, so a message the charger sends ahead of its CALLRESULT is not missed.
+func (s *OCPPServer) triggerMessage(ctx context.Context, chargerID string, req *ocpp16.TriggerMessageRequest) (*ocpp16.TriggerMessageConfirmation, []triggeredMessage, error) {
+	charger := s.getCharger(chargerID)
+	if charger == nil {
+		return nil, nil, fmt.Errorf("charger %s: %w", chargerID, errChargerNotConnected)
+	}
+
+	waiter := &triggerWaiter{
+		charger:     charger,
+		action:      string(req.RequestedMessage),
+		connectorID: req.ConnectorId,
+		messages:    make(chan triggeredMessage, 16),
+	}
+	s.addTriggerWaiter(waiter)
+	defer s.removeTriggerWaiter(waiter)
+
+	response, err := s.SendRemoteCommand(ctx, chargerID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf := response.(*ocpp16.TriggerMessageConfirmation)
+	if conf.Status != "Accepted" {
+		return conf, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remoteCommandTimeout)
+	defer cancel()
+
+	var messages []triggeredMessage
+	select {
+	case msg := <-waiter.messages:
+		messages = append(messages, msg)
+	case <-charger.closed():
+		return nil, nil, fmt.Errorf("charger %s: %w", chargerID, errChargerDisconnected)
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("no %s from %s after TriggerMessage: %w", req.RequestedMessage, chargerID, ctx.Err())
+	}
+	if waiter.single() {
+		return conf, messages, nil
+	}
+
+	settle := time.NewTimer(triggerSettleDelay)
+	defer settle.Stop()
+	for {
+		select {
+		case msg := <-waiter.messages:
+			messages = append(messages, msg)
+			settle.Reset(triggerSettleDelay)
+		case <-settle.C:
+			return conf, messages, nil
+		case <-charger.closed():
+			return conf, messages, nil
+		case <-ctx.Done():
+			return conf, messages, nil
+		}
+	}
+}
+
+// handleTriggerMessage asks a charger to send a message and replies with the
+// message itself once it arrived
+func (s *OCPPServer) handleTriggerMessage(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	req := new(ocpp16.TriggerMessageRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conf, messages, err := s.triggerMessage(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		writeCommandResponse(w, req.Action(), nil, err)
+		return
+	}
+	if messages == nil {
+		messages = []triggeredMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action":   req.Action(),
+		"response": conf,
+		"messages": messages,
+	})
+}
+
+// refreshConnectors triggers a StatusNotification for every connector of a
+// connected charger and waits until they have been stored
+func (s *OCPPServer) refreshConnectors(ctx context.Context, chargerID string) {
+	_, _, err := s.triggerMessage(ctx, chargerID, &ocpp16.TriggerMessageRequest{
+		RequestedMessage: ocpp16.TriggerStatusNotification,
+	})
+	if err != nil {
+		log.Printf("Failed to refresh connectors of %s: %v", chargerID, err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"unicode/utf8"
+
+	"ocpp-server/datatransfer"
+)
+
+// defaultVendorID is the vendorId of our own DataTransfer extensions
+const defaultVendorID = "cpm"
+
+// displayTextParams is the data of a DisplayText DataTransfer: a message shown on
+// the charger screen, for every connector when ConnectorId is 0
+type displayTextParams struct {
+	ConnectorId int    `json:"connectorId"`
+	Text        string `json:"text"`
+	Duration    int    `json:"duration,omitempty"` // seconds, 0 until replaced
+}
+
+// qrCodeParams is the data of a ShowQRCode DataTransfer: a QR code shown next to
+// a connector, e.g. a payment or start link
+type qrCodeParams struct {
+	ConnectorId int    `json:"connectorId"`
+	Content     string `json:"content"`
+}
+
+// jsonOutbound sends params decoded into a new P, checked by validate, as JSON data
+func jsonOutbound[P any](validate func(*P) error) datatransfer.Outbound {
+	return datatransfer.Outbound{
+		Encode: func(raw json.RawMessage) (string, error) {
+			params := new(P)
+			decoder := json.NewDecoder(bytes.NewReader(raw))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(params); err != nil {
+				return "", fmt.Errorf("%w: %v", datatransfer.ErrInvalidParams, err)
+			}
+			if err := validate(params); err != nil {
+				return "", fmt.Errorf("%w: %v", datatransfer.ErrInvalidParams, err)
+			}
+			data, err := json.Marshal(params)
+			return string(data), err
+		},
+	}
+}
+
+// registerVendorExtensions registers our display-text and QR-code extensions under
+// the vendorId from OCPP_VENDOR_ID
+func registerVendorExtensions(registry *datatransfer.Registry) {
+	vendorID := os.Getenv("OCPP_VENDOR_ID")
+	if vendorID == "" {
+		vendorID = defaultVendorID
+	}
+
+	registry.RegisterOutbound(vendorID, "DisplayText", jsonOutbound(func(p *displayTextParams) error {
+		if p.ConnectorId < 0 {
+			return errors.New("connectorId must be 0 or greater")
+		}
+		if p.Text == "" || utf8.RuneCountInString(p.Text) > 255 {
+			return errors.New("text must be 1 to 255 characters")
+		}
+		if p.Duration < 0 {
+			return errors.New("duration must not be negative")
+		}
+		return nil
+	}))
+	registry.RegisterOutbound(vendorID, "ShowQRCode", jsonOutbound(func(p *qrCodeParams) error {
+		if p.ConnectorId < 0 {
+			return errors.New("connectorId must be 0 or greater")
+		}
+		if p.Content == "" || len(p.Content) > 512 {
+			return errors.New("content must be 1 to 512 bytes")
+		}
+		return nil
+	}))
+}
+
+// handleDataTransferMessages lists the DataTransfer messages the server can send
+func (s *OCPPServer) handleDataTransferMessages(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": s.dataTransfer.OutboundMessages(),
+	})
+}
+
+// handleVendorDataTransfer sends a registered DataTransfer message to a charger,
+// built from the JSON parameters in the body
+func (s *OCPPServer) handleVendorDataTransfer(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOperator(w, r) {
+		return
+	}
+
+	var params json.RawMessage
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.dataTransfer.Send(r.Context(), s, r.PathValue("id"), r.PathValue("vendor"), r.PathValue("message"), params)
+	switch {
+	case errors.Is(err, datatransfer.ErrUnknownMessage):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, datatransfer.ErrInvalidParams):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeCommandResponse(w, "DataTransfer", nil, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action":   "DataTransfer",
+		"response": result,
+	})
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"gocrud/db"
+	"gocrud/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserTags récupère les badges d'un utilisateur
+func GetUserTags(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	tags := []models.IdTag{}
+	err := db.DB.NewSelect().Model(&tags).Where("user_id = ?", user.ID).Order("id ASC").Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// GetUserTag récupère un badge d'un utilisateur
+func GetUserTag(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	tag, ok := findTagParam(c, user.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// CreateUserTag associe un nouveau badge à un utilisateur
+func CreateUserTag(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.IdTagCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Vérifier si le badge existe déjà
+	exists, err := db.DB.NewSelect().Model((*models.IdTag)(nil)).Where("tag = ?", req.IdTag).Exists(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "IdTag already exists"})
+		return
+	}
+
+	tag := models.IdTag{
+		Tag:         req.IdTag,
+		UserID:      user.ID,
+		Status:      req.Status,
+		ExpiryDate:  req.ExpiryDate,
+		ParentIdTag: req.ParentIdTag,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if tag.Status == "" {
+		tag.Status = models.IdTagStatusAccepted
+	}
+
+	_, err = db.DB.NewInsert().Model(&tag).Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateUserTag met à jour le statut, l'expiration ou le parent d'un badge
+func UpdateUserTag(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	tag, ok := findTagParam(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req models.IdTagUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Mettre à jour uniquement les champs fournis
+	if req.Status != "" {
+		tag.Status = req.Status
+	}
+	if req.ExpiryDate != nil {
+		tag.ExpiryDate = req.ExpiryDate
+	}
+	if req.ParentIdTag != nil {
+		tag.ParentIdTag = *req.ParentIdTag
+	}
+	tag.UpdatedAt = time.Now()
+
+	_, err := db.DB.NewUpdate().Model(tag).WherePK().Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteUserTag supprime un badge d'un utilisateur
+func DeleteUserTag(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	tag, ok := findTagParam(c, user.ID)
+	if !ok {
+		return
+	}
+
+	_, err := db.DB.NewDelete().Model(tag).WherePK().Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IdTag deleted successfully"})
+}
+
+// findUserParam charge l'utilisateur désigné par :id, ou répond avec une erreur
+func findUserParam(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return nil, false
+	}
+
+	user := new(models.User)
+	err = db.DB.NewSelect().Model(user).Where("id = ?", id).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// findTagParam charge le badge :tagId appartenant à l'utilisateur, ou répond avec une erreur
+func findTagParam(c *gin.Context, userID int64) (*models.IdTag, bool) {
+	tagID, err := strconv.ParseInt(c.Param("tagId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID format"})
+		return nil, false
+	}
+
+	tag := new(models.IdTag)
+	err = db.DB.NewSelect().Model(tag).Where("id = ?", tagID).Where("user_id = ?", userID).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "IdTag not found"})
+		return nil, false
+	}
+	return tag, true
+}
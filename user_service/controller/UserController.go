@@ -191,6 +191,13 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Supprimer les badges de l'utilisateur
+	_, err = db.DB.NewDelete().Model((*models.IdTag)(nil)).Where("user_id = ?", id).Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Supprimer l'utilisateur
 	_, err = db.DB.NewDelete().Model(user).Where("id = ?", id).Exec(c)
 	if err != nil {
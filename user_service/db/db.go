@@ -141,6 +141,7 @@ func createSchema(db *bun.DB) error {
 
 	models := []interface{}{
 		(*models.User)(nil),
+		(*models.IdTag)(nil),
 	}
 
 	for _, model := range models {
@@ -0,0 +1,44 @@
+// models/id_tag.go
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Statuts d'un badge, identiques à l'AuthorizationStatus OCPP
+const (
+	IdTagStatusAccepted = "Accepted"
+	IdTagStatusBlocked  = "Blocked"
+	IdTagStatusExpired  = "Expired"
+	IdTagStatusInvalid  = "Invalid"
+)
+
+// IdTag relie un badge RFID ou un jeton OCPP à un utilisateur
+type IdTag struct {
+	bun.BaseModel `bun:"table:id_tag" json:"-"`
+	ID            int64      `bun:",pk,autoincrement" json:"id"`
+	Tag           string     `bun:"tag,unique,notnull" json:"id_tag"`
+	UserID        int64      `bun:"user_id,notnull" json:"user_id"`
+	Status        string     `bun:"status,notnull" json:"status"`
+	ExpiryDate    *time.Time `bun:"expiry_date" json:"expiry_date"`
+	ParentIdTag   string     `bun:"parent_id_tag" json:"parent_id_tag,omitempty"`
+	CreatedAt     time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time  `bun:"updated_at,nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// IdTagCreateRequest - struct de validation pour la création d'un badge
+type IdTagCreateRequest struct {
+	IdTag       string     `json:"id_tag" binding:"required,max=20"`
+	Status      string     `json:"status" binding:"omitempty,oneof=Accepted Blocked Expired Invalid"`
+	ExpiryDate  *time.Time `json:"expiry_date"`
+	ParentIdTag string     `json:"parent_id_tag" binding:"omitempty,max=20"`
+}
+
+// IdTagUpdateRequest - struct de validation pour la mise à jour d'un badge
+type IdTagUpdateRequest struct {
+	Status      string     `json:"status" binding:"omitempty,oneof=Accepted Blocked Expired Invalid"`
+	ExpiryDate  *time.Time `json:"expiry_date"`
+	ParentIdTag *string    `json:"parent_id_tag" binding:"omitempty,max=20"`
+}
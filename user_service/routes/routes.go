@@ -43,6 +43,13 @@ func SetupRoutes(r *gin.Engine) {
 			users.PUT("/:id", controller.UpdateUser)
 			users.DELETE("/:id", controller.DeleteUser)
 
+			// Badges RFID / idTags OCPP de l'utilisateur
+			users.GET("/:id/tags", controller.GetUserTags)
+			users.GET("/:id/tags/:tagId", controller.GetUserTag)
+			users.POST("/:id/tags", controller.CreateUserTag)
+			users.PUT("/:id/tags/:tagId", controller.UpdateUserTag)
+			users.DELETE("/:id/tags/:tagId", controller.DeleteUserTag)
+
 		}
 	}
 }